@@ -0,0 +1,264 @@
+package main
+
+import (
+	"GolangOM/controller"
+	"GolangOM/logs"
+	"GolangOM/model"
+	"GolangOM/util"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// run command line subcommand
+func runCommand(args []string) error {
+	switch args[0] {
+	case "rotate-key":
+		return rotateMasterKey(args[1:])
+	case "import":
+		return importServers(args[1:])
+	case "export-config":
+		return exportConfig(args[1:])
+	case "import-config":
+		return importConfig(args[1:])
+	default:
+		return fmt.Errorf("unknown command %s, available commands: rotate-key, import, export-config, import-config", args[0])
+	}
+}
+
+// rotateMasterKey rewrap all credentials with a new master key
+// usage: rotate-key [new base64 key], a random key is generated if omitted
+// a file based key is replaced automatically, a key from env or config is printed to be updated by hand
+// the service must be stopped: it loads the master key once, and would keep encrypting with the old key
+func rotateMasterKey(args []string) error {
+	if address, running := serviceRunning(); running {
+		return fmt.Errorf("GolangOM is running on %s, stop it before rotating the master key", address)
+	}
+
+	oldKey, keyFile, err := util.LoadMasterKey()
+	if err != nil {
+		return fmt.Errorf("load current master key failed: %w", err)
+	}
+	oldBox, err := util.NewSecretBox(oldKey)
+	if err != nil {
+		return err
+	}
+
+	newKey := util.GenerateMasterKey()
+	if len(args) > 0 {
+		if newKey, err = util.ParseMasterKey(args[0]); err != nil {
+			return err
+		}
+	}
+	newBox, err := util.NewSecretBox(newKey)
+	if err != nil {
+		return err
+	}
+	if newBox.KeyID() == oldBox.KeyID() {
+		return fmt.Errorf("new master key is the same as the current one")
+	}
+
+	// keep the new key on disk before the database refers to it, so a crash cannot lose it
+	pendingFile := ""
+	if keyFile != "" {
+		pendingFile = keyFile + ".new"
+		if err := util.SaveMasterKeyFile(pendingFile, newKey); err != nil {
+			return fmt.Errorf("save new master key failed: %w", err)
+		}
+	}
+
+	count, err := model.RotateCredentialKey(oldBox, newBox)
+	if err != nil {
+		if pendingFile != "" {
+			os.Remove(pendingFile)
+		}
+		return fmt.Errorf("rotate credentials failed, nothing changed: %w", err)
+	}
+	logs.Logger.Info("master key rotated",
+		zap.String("old_key_id", oldBox.KeyID()),
+		zap.String("new_key_id", newBox.KeyID()),
+		zap.Int("credentials", count))
+
+	if pendingFile != "" {
+		if err := os.Rename(pendingFile, keyFile); err != nil {
+			return fmt.Errorf("credentials use the new key in %s, move it to %s by hand: %w", pendingFile, keyFile, err)
+		}
+		fmt.Printf("master key rotated, %d credentials rewrapped, new key saved to %s\n", count, keyFile)
+		return nil
+	}
+	fmt.Printf("master key rotated, %d credentials rewrapped\n", count)
+	fmt.Printf("set %s or Security.MasterKey to the new key before restarting:\n%s\n", util.MasterKeyEnv, util.EncodeMasterKey(newKey))
+	return nil
+}
+
+// serviceRunning whether something answers on the web UI port of this config, most likely GolangOM itself
+func serviceRunning() (string, bool) {
+	address := net.JoinHostPort("127.0.0.1", strconv.Itoa(viper.GetInt("Server.WebUIPort")))
+	conn, err := net.DialTimeout("tcp", address, time.Second)
+	if err != nil {
+		return address, false
+	}
+	conn.Close()
+	return address, true
+}
+
+// importServers import servers from an OpenSSH client config or an Ansible inventory
+// usage: import [-format f] [-user u] [-port p] [-apply] [-skip-errors] [file], file defaults to ~/.ssh/config
+// without -apply only the preview is printed
+func importServers(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "ssh_config, ansible_ini or ansible_yaml, detected if empty")
+	user := flags.String("user", "", "user of hosts that do not set one")
+	port := flags.Int("port", 22, "port of hosts that do not set one")
+	apply := flags.Bool("apply", false, "save the servers, otherwise only print the preview")
+	skipErrors := flags.Bool("skip-errors", false, "save the valid hosts even if some cannot be imported")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	file := flags.Arg(0)
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return err
+		}
+		file = filepath.Join(home, ".ssh", "config")
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+
+	plan, err := controller.PlanServerImport(*format, string(content), controller.ServerImportOptions{DefaultUser: *user, DefaultPort: *port})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s as %s\n", file, plan.Format)
+	for _, item := range plan.Items {
+		switch {
+		case item.Action == controller.ImportError:
+			fmt.Printf("  %-9s %s (line %d): %s\n", item.Action, item.Alias, item.Line, item.Error)
+		case item.Jump != "":
+			fmt.Printf("  %-9s %s %s@%s:%d via %s\n", item.Action, item.Alias, item.Server.User, item.Server.IP, item.Server.Port, item.Jump)
+		default:
+			fmt.Printf("  %-9s %s %s@%s:%d\n", item.Action, item.Alias, item.Server.User, item.Server.IP, item.Server.Port)
+		}
+	}
+	fmt.Printf("%d to create, %d to update, %d unchanged, %d errors\n",
+		plan.Count(controller.ImportCreate), plan.Count(controller.ImportUpdate),
+		plan.Count(controller.ImportUnchanged), plan.Count(controller.ImportError))
+	if !*apply {
+		fmt.Println("nothing saved, run again with -apply to import")
+		return nil
+	}
+
+	if err := controller.ApplyServerImport(plan, *skipErrors); err != nil {
+		return err
+	}
+	logs.Logger.Info("servers imported",
+		zap.String("file", file),
+		zap.String("format", plan.Format),
+		zap.Int("created", plan.Count(controller.ImportCreate)),
+		zap.Int("updated", plan.Count(controller.ImportUpdate)))
+	fmt.Println("servers saved, they connect when the service starts")
+	return nil
+}
+
+// exportConfig write all servers and apps to a versioned document
+// usage: export-config [-format yaml|json] [-secrets none|encrypted] [file], the document goes to stdout without file
+func exportConfig(args []string) error {
+	flags := flag.NewFlagSet("export-config", flag.ContinueOnError)
+	format := flags.String("format", controller.ExportYAML, "yaml or json")
+	secrets := flags.String("secrets", controller.ExportSecretsNone, "none leaves passwords out, encrypted keeps them encrypted with the master key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	doc, err := controller.ExportConfig(*secrets)
+	if err != nil {
+		return err
+	}
+	data, err := controller.MarshalConfigExport(doc, *format)
+	if err != nil {
+		return err
+	}
+	if flags.Arg(0) == "" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	// encrypted secrets are still secrets, keep the file private
+	if err := os.WriteFile(flags.Arg(0), data, 0600); err != nil {
+		return err
+	}
+	fmt.Printf("%d servers and %d apps exported to %s\n", len(doc.Servers), len(doc.Apps), flags.Arg(0))
+	return nil
+}
+
+// importConfig import a document written by export-config
+// usage: import-config [-format yaml|json] [-dry-run] file, servers and apps start when the service starts
+func importConfig(args []string) error {
+	flags := flag.NewFlagSet("import-config", flag.ContinueOnError)
+	format := flags.String("format", "", "yaml or json, detected if empty")
+	dryRun := flags.Bool("dry-run", false, "only print what would change")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.Arg(0) == "" {
+		return fmt.Errorf("usage: import-config [-format yaml|json] [-dry-run] file")
+	}
+	content, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	doc, err := controller.ParseConfigExport(*format, content)
+	if err != nil {
+		return err
+	}
+	plan, err := controller.PlanConfigImport(doc)
+	if err != nil {
+		return err
+	}
+	for _, item := range plan.Servers.Items {
+		printImportItem("server", item.Alias, item.Action, item.Error, item.Changes)
+	}
+	for _, item := range plan.Apps {
+		printImportItem("app", fmt.Sprintf("%s on server %d", item.Name, item.Server), item.Action, item.Error, item.Changes)
+	}
+	fmt.Printf("%d to create, %d to update, %d unchanged, %d errors\n",
+		plan.Count(controller.ImportCreate), plan.Count(controller.ImportUpdate),
+		plan.Count(controller.ImportUnchanged), plan.Count(controller.ImportError))
+	if *dryRun {
+		fmt.Println("dry run, nothing saved")
+		return nil
+	}
+
+	if err := controller.ApplyConfigImport(plan); err != nil {
+		return err
+	}
+	logs.Logger.Info("config imported",
+		zap.String("file", flags.Arg(0)),
+		zap.Int("created", plan.Count(controller.ImportCreate)),
+		zap.Int("updated", plan.Count(controller.ImportUpdate)))
+	fmt.Println("config saved, servers connect and apps are checked when the service starts")
+	return nil
+}
+
+func printImportItem(kind string, name string, action string, message string, changes []string) {
+	switch {
+	case message != "":
+		fmt.Printf("  %-9s %s %s: %s\n", action, kind, name, message)
+	case len(changes) > 0:
+		fmt.Printf("  %-9s %s %s: %s\n", action, kind, name, strings.Join(changes, ", "))
+	default:
+		fmt.Printf("  %-9s %s %s\n", action, kind, name)
+	}
+}
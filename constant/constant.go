@@ -3,8 +3,17 @@ package constant
 type AuthMethod string
 
 const (
-	AuthMethodPassword AuthMethod = "password" // password authentication
-	AuthMethodKey      AuthMethod = "key"      // key authentication
+	AuthMethodPassword    AuthMethod = "password"    // password authentication
+	AuthMethodKey         AuthMethod = "key"         // key authentication
+	AuthMethodAgent       AuthMethod = "agent"       // keys held by ssh-agent at SSH_AUTH_SOCK
+	AuthMethodCertificate AuthMethod = "certificate" // key plus OpenSSH user certificate
+)
+
+type BecomeMethod string
+
+const (
+	BecomeSudo BecomeMethod = "sudo" // sudo -u, become password is the login user's password
+	BecomeSu   BecomeMethod = "su"   // su, become password is the target user's password
 )
 
 type ConnectStatus string
@@ -13,6 +22,38 @@ const (
 	Connected    ConnectStatus = "connected"
 	Disconnected ConnectStatus = "disconnected"
 	Connecting   ConnectStatus = "connecting"
+	Idle         ConnectStatus = "idle" // lazy mode, no open connection until needed
+)
+
+type AlertStatus string
+
+const (
+	AlertFiring   AlertStatus = "firing"
+	AlertResolved AlertStatus = "resolved"
+)
+
+type ForwardType string
+
+const (
+	ForwardLocal  ForwardType = "local"  // listen on this host, connect to the target from the server
+	ForwardRemote ForwardType = "remote" // listen on the server, connect to the target from this host
+)
+
+type ForwardStatus string
+
+const (
+	ForwardRunning ForwardStatus = "running" // listening and forwarding connections
+	ForwardWaiting ForwardStatus = "waiting" // connection to the server lost, re-established once it reconnects
+	ForwardStopped ForwardStatus = "stopped"
+)
+
+type HostKeyStatus string
+
+const (
+	HostKeyNone    HostKeyStatus = "none"    // no key pinned or presented yet
+	HostKeyPending HostKeyStatus = "pending" // key presented by host, waiting for approval
+	HostKeyTrusted HostKeyStatus = "trusted" // key pinned in known_hosts
+	HostKeyChanged HostKeyStatus = "changed" // host presented a key different from the pinned one
 )
 
 type AppCheckType string
@@ -21,6 +62,9 @@ const (
 	AppCheckTypePid  AppCheckType = "pid"
 	AppCheckTypePort AppCheckType = "port"
 	AppCheckTypeHttp AppCheckType = "http"
+	// checks run by GolangOM itself instead of over SSH, they test reachability from the monitoring side
+	AppCheckTypeTCP        AppCheckType = "tcp"         // dial host:port, or port on the server address
+	AppCheckTypeHttpNative AppCheckType = "http_native" // GET of the URL, 2xx or 3xx is up
 )
 
 // local server ID
@@ -35,4 +79,6 @@ const (
 	SessionError       ServiceErrorCode = 10003 // session error
 	ServerConnectError ServiceErrorCode = 10004 // server connection error
 	TargetNotFound     ServiceErrorCode = 10005 // target not found
+	HostKeyUntrusted   ServiceErrorCode = 10006 // server connection error: host key waiting for approval
+	HostKeyMismatch    ServiceErrorCode = 10007 // server connection error: host key differs from pinned key
 )
@@ -0,0 +1,313 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/model"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type alertRuleVo struct {
+	ID       uint   `json:"id"`
+	Name     string `json:"name"`
+	ServerID uint   `json:"server_id"` // 0 means every server
+	Selector string `json:"selector"`  // label selector such as env=prod, empty means every server
+	Expr     string `json:"expr"`
+	Enabled  bool   `json:"enabled"`
+}
+
+func newAlertRuleVo(rule *model.AlertRuleModel) alertRuleVo {
+	return alertRuleVo{
+		ID:       rule.ID,
+		Name:     rule.Name,
+		ServerID: rule.ServerID,
+		Selector: rule.Selector,
+		Expr:     rule.Expr,
+		Enabled:  rule.Enabled,
+	}
+}
+
+type alertVo struct {
+	ID         uint                 `json:"id"`
+	RuleID     uint                 `json:"rule_id"`
+	RuleName   string               `json:"rule_name"`
+	ServerID   uint                 `json:"server_id"`
+	Metric     string               `json:"metric"`
+	Labels     string               `json:"labels"`
+	Value      float64              `json:"value"`
+	Status     constant.AlertStatus `json:"status"`
+	StartedAt  time.Time            `json:"started_at"`
+	ResolvedAt *time.Time           `json:"resolved_at"`
+}
+
+// LoadAlertRules pass enabled rules to the alert manager, called at startup and after every rule change
+func LoadAlertRules() error {
+	rules, err := model.GetAlertRuleList()
+	if err != nil {
+		return err
+	}
+	alertRules := make([]*pkg.AlertRule, 0, len(rules))
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		alertRule, err := pkg.NewAlertRule(rule.ID, rule.Name, rule.ServerID, rule.Selector, rule.Expr)
+		if err != nil {
+			// saved rules are validated, only hand edited rows get here
+			logs.Logger.Error("invalid alert rule", zap.String("rule_id", strconv.Itoa(int(rule.ID))), zap.Error(err))
+			continue
+		}
+		alertRules = append(alertRules, alertRule)
+	}
+	pkg.GetAlertManager().SetRules(alertRules)
+	return nil
+}
+
+// RestoreFiringAlerts let the alert manager resolve alerts that were firing before a restart
+func RestoreFiringAlerts() error {
+	alerts, err := model.GetAlerts(constant.AlertFiring, 0, -1)
+	if err != nil {
+		return err
+	}
+	events := make([]pkg.AlertEvent, 0, len(alerts))
+	for _, alert := range alerts {
+		events = append(events, pkg.AlertEvent{
+			RuleID:    alert.RuleID,
+			RuleName:  alert.RuleName,
+			ServerID:  alert.ServerID,
+			Metric:    alert.Metric,
+			Labels:    alert.Labels,
+			Value:     alert.Value,
+			Status:    alert.Status,
+			StartedAt: alert.StartedAt,
+			Time:      alert.StartedAt,
+		})
+	}
+	pkg.GetAlertManager().RestoreFiring(events)
+	return nil
+}
+
+// SaveAlertEvent persist fired and resolved alerts, used as the alert handler of the alert manager
+func SaveAlertEvent(event pkg.AlertEvent) {
+	if event.Status == constant.AlertResolved {
+		if err := model.ResolveAlert(event.RuleID, event.ServerID, event.Labels, event.Value, event.Time); err != nil {
+			logs.Logger.Error("ResolveAlert failed", zap.String("rule_id", strconv.Itoa(int(event.RuleID))), zap.Error(err))
+		}
+		logs.Logger.Info("alert resolved",
+			zap.String("rule", event.RuleName),
+			zap.String("server_id", strconv.Itoa(int(event.ServerID))),
+			zap.String("labels", event.Labels))
+		return
+	}
+
+	alert := &model.AlertModel{
+		RuleID:    event.RuleID,
+		RuleName:  event.RuleName,
+		ServerID:  event.ServerID,
+		Metric:    event.Metric,
+		Labels:    event.Labels,
+		Value:     event.Value,
+		Status:    event.Status,
+		StartedAt: event.StartedAt,
+	}
+	if err := alert.CreateAlert(); err != nil {
+		logs.Logger.Error("CreateAlert failed", zap.String("rule_id", strconv.Itoa(int(event.RuleID))), zap.Error(err))
+	}
+	logs.Logger.Warn("alert firing",
+		zap.String("rule", event.RuleName),
+		zap.String("server_id", strconv.Itoa(int(event.ServerID))),
+		zap.String("labels", event.Labels),
+		zap.Float64("value", event.Value))
+}
+
+// validate rule, false if a failure response was sent
+func validateAlertRule(c *gin.Context, rule *model.AlertRuleModel) bool {
+	if _, err := pkg.NewAlertRule(rule.ID, rule.Name, rule.ServerID, rule.Selector, rule.Expr); err != nil {
+		response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+		return false
+	}
+	if rule.ServerID != 0 && pkg.GetConnectionPool().GetServerByID(rule.ServerID) == nil {
+		response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not exists")
+		return false
+	}
+	return true
+}
+
+// reload rules after a change, the change itself is saved already
+func reloadAlertRules() {
+	if err := LoadAlertRules(); err != nil {
+		logs.Logger.Error("load alert rules failed: ", zap.Error(err))
+	}
+}
+
+func GetAlertRuleListFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules, err := model.GetAlertRuleList()
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "get alert rule list failed")
+			logs.Logger.Error("get alert rule list failed: ", zap.Error(err))
+			return
+		}
+		result := make([]alertRuleVo, 0, len(rules))
+		for i := range rules {
+			result = append(result, newAlertRuleVo(&rules[i]))
+		}
+		response.Success(c, gin.H{"rules": result})
+	}
+}
+
+// CreateAlertRuleFunc expr is metric{label="value",...} op threshold [for duration], such as disk_used_percent{mount="/"} > 90 for 5m
+func CreateAlertRuleFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name     string `json:"name" binding:"required"`
+			ServerID uint   `json:"server_id"`
+			Selector string `json:"selector"`
+			Expr     string `json:"expr" binding:"required"`
+			Enabled  *bool  `json:"enabled"` // default true
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		rule := &model.AlertRuleModel{
+			Name:     req.Name,
+			ServerID: req.ServerID,
+			Selector: req.Selector,
+			Expr:     req.Expr,
+			Enabled:  req.Enabled == nil || *req.Enabled,
+		}
+		if !validateAlertRule(c, rule) {
+			return
+		}
+		if err := rule.CreateAlertRule(); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "alert rule create failed")
+			logs.Logger.Error("alert rule create failed: ", zap.Error(err))
+			return
+		}
+		reloadAlertRules()
+		response.Success(c, gin.H{"rule": newAlertRuleVo(rule)})
+	}
+}
+
+func UpdateAlertRuleFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID       uint   `json:"id" binding:"required"`
+			Name     string `json:"name" binding:"required"`
+			ServerID uint   `json:"server_id"`
+			Selector string `json:"selector"`
+			Expr     string `json:"expr" binding:"required"`
+			Enabled  bool   `json:"enabled"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		rule := &model.AlertRuleModel{Model: gorm.Model{ID: req.ID}}
+		if !rule.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "alert rule not exists")
+			return
+		}
+		rule.Name = req.Name
+		rule.ServerID = req.ServerID
+		rule.Selector = req.Selector
+		rule.Expr = req.Expr
+		rule.Enabled = req.Enabled
+		if !validateAlertRule(c, rule) {
+			return
+		}
+		if err := rule.UpdateAlertRule(); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "alert rule update failed")
+			logs.Logger.Error("alert rule update failed: ", zap.Error(err))
+			return
+		}
+		reloadAlertRules()
+		response.Success(c, gin.H{"rule": newAlertRuleVo(rule)})
+	}
+}
+
+// DeleteAlertRuleFunc firing alerts of the rule are resolved
+func DeleteAlertRuleFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID uint `json:"id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		rule := &model.AlertRuleModel{Model: gorm.Model{ID: req.ID}}
+		if !rule.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "alert rule not exists")
+			return
+		}
+		if err := rule.DeleteAlertRule(); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "alert rule delete failed")
+			logs.Logger.Error("alert rule delete failed: ", zap.Error(err))
+			return
+		}
+		reloadAlertRules()
+		response.Success(c, gin.H{"message": "alert rule deleted successfully"})
+	}
+}
+
+// GetAlertListFunc alerts newest first, status is firing or resolved, empty means both
+func GetAlertListFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Status   constant.AlertStatus `json:"status"`
+			ServerID uint                 `json:"server_id"`
+			Limit    int                  `json:"limit"` // default 100
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+		if req.Status != "" && req.Status != constant.AlertFiring && req.Status != constant.AlertResolved {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "status must be firing or resolved")
+			return
+		}
+		if req.Limit <= 0 || req.Limit > 1000 {
+			req.Limit = 100
+		}
+
+		alerts, err := model.GetAlerts(req.Status, req.ServerID, req.Limit)
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "get alert list failed")
+			logs.Logger.Error("get alert list failed: ", zap.Error(err))
+			return
+		}
+		result := make([]alertVo, 0, len(alerts))
+		for _, alert := range alerts {
+			result = append(result, alertVo{
+				ID:         alert.ID,
+				RuleID:     alert.RuleID,
+				RuleName:   alert.RuleName,
+				ServerID:   alert.ServerID,
+				Metric:     alert.Metric,
+				Labels:     alert.Labels,
+				Value:      alert.Value,
+				Status:     alert.Status,
+				StartedAt:  alert.StartedAt,
+				ResolvedAt: alert.ResolvedAt,
+			})
+		}
+		response.Success(c, gin.H{"alerts": result})
+	}
+}
@@ -23,15 +23,116 @@ type appVo struct {
 	StartScript   string                `json:"start_script"`
 	CheckInterval int                   `json:"check_interval"`
 	AutoRestart   bool                  `json:"auto_restart"`
+	RunAs         string                `json:"run_as"`
 	CheckResult   bool                  `json:"check_result"`
 	CheckTime     time.Time             `json:"last_check_time"`
+	CheckError    string                `json:"last_check_error,omitempty"` // assertion or reason the last check failed
+	Labels        map[string]string     `json:"labels"`
+	HTTPCheck     *pkg.HTTPCheckSpec    `json:"http_check,omitempty"`
 }
 
+// NewAppCheckConfig checker config of app record
+func NewAppCheckConfig(app *model.AppModel) *pkg.AppCheckConfig {
+	return &pkg.AppCheckConfig{
+		AutoRestart:   app.AutoRestart,
+		CheckInterval: app.CheckInterval,
+		CheckTarget:   app.CheckTarget,
+		CheckType:     app.CheckType,
+		ID:            app.ID,
+		Name:          app.Name,
+		ServerID:      app.ServerID,
+		StartScript:   app.StartScript,
+		RunAs:         app.RunAs,
+		Labels:        app.Labels,
+		HTTPCheck:     newHTTPCheckSpec(app.HTTPCheck),
+	}
+}
+
+// runtime http check spec of stored spec
+func newHTTPCheckSpec(spec *model.HTTPCheckSpec) *pkg.HTTPCheckSpec {
+	if spec == nil {
+		return nil
+	}
+	result := &pkg.HTTPCheckSpec{
+		Method:        spec.Method,
+		Headers:       spec.Headers,
+		Body:          spec.Body,
+		ExpectStatus:  spec.ExpectStatus,
+		BodyContains:  spec.BodyContains,
+		BodyRegex:     spec.BodyRegex,
+		MaxLatency:    spec.MaxLatency,
+		TLSSkipVerify: spec.TLSSkipVerify,
+	}
+	for _, assertion := range spec.JSON {
+		result.JSON = append(result.JSON, pkg.JSONAssertion{Path: assertion.Path, Equals: assertion.Equals})
+	}
+	return result
+}
+
+// stored http check spec of runtime spec
+func newHTTPCheckSpecModel(spec *pkg.HTTPCheckSpec) *model.HTTPCheckSpec {
+	if spec == nil {
+		return nil
+	}
+	result := &model.HTTPCheckSpec{
+		Method:        spec.Method,
+		Headers:       spec.Headers,
+		Body:          spec.Body,
+		ExpectStatus:  spec.ExpectStatus,
+		BodyContains:  spec.BodyContains,
+		BodyRegex:     spec.BodyRegex,
+		MaxLatency:    spec.MaxLatency,
+		TLSSkipVerify: spec.TLSSkipVerify,
+	}
+	for _, assertion := range spec.JSON {
+		result.JSON = append(result.JSON, model.JSONAssertion{Path: assertion.Path, Equals: assertion.Equals})
+	}
+	return result
+}
+
+// check type, target and http check spec of app
+func validateAppCheck(app *model.AppModel) error {
+	if err := pkg.ValidateAppCheck(app.CheckType, app.CheckTarget); err != nil {
+		return err
+	}
+	return pkg.ValidateHTTPCheck(app.CheckType, newHTTPCheckSpec(app.HTTPCheck))
+}
+
+// GetAppListFunc ?selector= filters apps by their labels, ?server_selector= by the labels of their servers
 func GetAppListFunc() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var query struct {
+			Selector       string `form:"selector"`
+			ServerSelector string `form:"server_selector"`
+		}
+		if err := c.ShouldBindQuery(&query); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+		selector, err := pkg.ParseLabelSelector(query.Selector)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+		serverSelector, err := pkg.ParseLabelSelector(query.ServerSelector)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+
 		apps := pkg.GetAppCheckerManager().GetAppCheckers()
 		result := make([]appVo, 0, len(apps))
 		for _, app := range apps {
+			if !selector.Matches(app.Labels) {
+				continue
+			}
+			if !serverSelector.Empty() {
+				server := pkg.GetConnectionPool().GetServerByID(app.ServerID)
+				if server == nil || !serverSelector.Matches(server.Labels) {
+					continue
+				}
+			}
 			result = append(result, appVo{
 				ID:          app.ID,
 				Name:        app.Name,
@@ -40,8 +141,12 @@ func GetAppListFunc() gin.HandlerFunc {
 				CheckTarget: app.CheckTarget,
 				StartScript: app.StartScript,
 				AutoRestart: app.AutoRestart,
+				RunAs:       app.RunAs,
 				CheckResult: app.LastCheckResult,
 				CheckTime:   app.LastCheckTime,
+				CheckError:  app.LastCheckError,
+				Labels:      app.Labels,
+				HTTPCheck:   app.HTTPCheck,
 			})
 		}
 		response.Success(c, gin.H{"apps": result})
@@ -78,8 +183,12 @@ func GetAppFunc() gin.HandlerFunc {
 			StartScript:   appInfo.StartScript,
 			CheckInterval: appInfo.CheckInterval,
 			AutoRestart:   appInfo.AutoRestart,
+			RunAs:         appInfo.RunAs,
 			CheckResult:   appInfo.LastCheckResult, // do not return sensitive information
 			CheckTime:     appInfo.LastCheckTime,
+			CheckError:    appInfo.LastCheckError,
+			Labels:        appInfo.Labels,
+			HTTPCheck:     appInfo.HTTPCheck,
 		}
 
 		response.Success(c, gin.H{"app": result})
@@ -94,22 +203,23 @@ func CreateAppFunc() gin.HandlerFunc {
 			return
 		}
 
+		if err := pkg.ValidateLabels(app.Labels); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+
+		if err := validateAppCheck(app); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+
 		if err := app.CreateApp(); err != nil {
 			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, err.Error())
 			logs.Logger.Error("app create failed", zap.Error(err))
 			return
 		}
 
-		if err := pkg.GetAppCheckerManager().NewAppChecker(&pkg.AppCheckConfig{
-			AutoRestart:   app.AutoRestart,
-			CheckInterval: app.CheckInterval,
-			CheckTarget:   app.CheckTarget,
-			CheckType:     app.CheckType,
-			ID:            app.ID,
-			Name:          app.Name,
-			ServerID:      app.ServerID,
-			StartScript:   app.StartScript,
-		}); err != nil {
+		if err := pkg.GetAppCheckerManager().NewAppChecker(NewAppCheckConfig(app)); err != nil {
 			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "app create failed")
 			logs.Logger.Error("app create failed", zap.Error(err))
 		}
@@ -132,6 +242,16 @@ func UpdateAppFunc() gin.HandlerFunc {
 			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "app not exists")
 		}
 
+		if err := pkg.ValidateLabels(app.Labels); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+
+		if err := validateAppCheck(app); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+
 		if err := app.UpdateApp(); err != nil {
 			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "update app failed")
 			logs.Logger.Error("update app failed", zap.Error(err))
@@ -140,16 +260,7 @@ func UpdateAppFunc() gin.HandlerFunc {
 
 		pkg.GetAppCheckerManager().RemoveAppCheckerByID(app.ID)
 
-		if err := pkg.GetAppCheckerManager().NewAppChecker(&pkg.AppCheckConfig{
-			AutoRestart:   app.AutoRestart,
-			CheckInterval: app.CheckInterval,
-			CheckTarget:   app.CheckTarget,
-			CheckType:     app.CheckType,
-			ID:            app.ID,
-			Name:          app.Name,
-			ServerID:      app.ServerID,
-			StartScript:   app.StartScript,
-		}); err != nil {
+		if err := pkg.GetAppCheckerManager().NewAppChecker(NewAppCheckConfig(app)); err != nil {
 			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "update app failed")
 			return
 		}
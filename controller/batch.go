@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type batchResultVo struct {
+	ServerID   uint   `json:"server_id"`
+	Stdout     string `json:"stdout"`
+	Stderr     string `json:"stderr"`
+	ExitCode   int    `json:"exit_code"`
+	Signal     string `json:"signal"`
+	Truncated  bool   `json:"truncated"`
+	Error      string `json:"error"`
+	DurationMs int64  `json:"duration_ms"`
+	Success    bool   `json:"success"`
+}
+
+// BatchExecuteFunc run one command on many servers, progress is pushed over /api/ws with the batch_id,
+// the client may choose batch_id to match progress before the response arrives, a random one is used otherwise
+// servers are given by server_ids, selector or group_id, see serverSelection
+// the batch stops starting servers and cancels running commands when the request is abandoned
+func BatchExecuteFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Command string `json:"command" binding:"required"`
+			BatchID string `json:"batch_id"` // letters, digits, _ and -, at most 64 characters
+			serverSelection
+			Parallelism int `json:"parallelism"` // 0 means Batch.MaxParallelism
+			Timeout     int `json:"timeout"`     // per server timeout in seconds, 0 means Server.CommandTimeout
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		if req.BatchID != "" && !pkg.ValidBatchID(req.BatchID) {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "batch_id may only contain letters, digits, _ and -, at most 64 characters")
+			return
+		}
+		if req.serverSelection.empty() {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "server_ids, selector or group_id is required")
+			return
+		}
+		// duplicated server IDs are dropped, request order is kept
+		serverIDs, err := req.serverSelection.resolve()
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+		if len(serverIDs) == 0 {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "no server selected")
+			return
+		}
+
+		username, _ := c.Get("username")
+		batchID := req.BatchID
+		if batchID == "" {
+			batchID = pkg.NewBatchID()
+		}
+		logs.Logger.Info("batch command started",
+			zap.Any("username", username),
+			zap.String("batch_id", batchID),
+			zap.String("cmd", req.Command),
+			zap.Int("servers", len(serverIDs)))
+
+		results := pkg.GetConnectionPool().ExecuteBatch(c.Request.Context(), batchID, req.Command, serverIDs, req.Parallelism, time.Duration(req.Timeout)*time.Second)
+
+		result := make([]batchResultVo, 0, len(results))
+		succeeded := 0
+		for _, r := range results {
+			if r.Success {
+				succeeded++
+			}
+			result = append(result, batchResultVo{
+				ServerID:   r.ServerID,
+				Stdout:     r.Stdout,
+				Stderr:     r.Stderr,
+				ExitCode:   r.ExitCode,
+				Signal:     r.Signal,
+				Truncated:  r.Truncated,
+				Error:      r.Error,
+				DurationMs: r.Duration.Milliseconds(),
+				Success:    r.Success,
+			})
+		}
+
+		response.Success(c, gin.H{
+			"batch_id":  batchID,
+			"total":     len(results),
+			"succeeded": succeeded,
+			"failed":    len(results) - succeeded,
+			"results":   result,
+		})
+	}
+}
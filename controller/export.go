@@ -0,0 +1,648 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/model"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"GolangOM/util"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"go.yaml.in/yaml/v3"
+)
+
+// ConfigExportVersion version of the export document written by this build, older versions are still read
+const ConfigExportVersion = 1
+
+// export document formats
+const (
+	ExportYAML = "yaml"
+	ExportJSON = "json"
+)
+
+// secrets in an export document
+const (
+	ExportSecretsNone      = "none"      // passwords are left out, an import keeps the saved ones
+	ExportSecretsEncrypted = "encrypted" // encrypted as stored, only instances with the same master key can import them
+)
+
+// ConfigExport servers and apps of an instance, references between them use the IDs of the exporting instance
+type ConfigExport struct {
+	Version    int            `json:"version" yaml:"version"`
+	ExportedAt time.Time      `json:"exported_at" yaml:"exported_at"`
+	Secrets    string         `json:"secrets" yaml:"secrets"`
+	Servers    []ServerExport `json:"servers" yaml:"servers"`
+	Apps       []AppExport    `json:"apps" yaml:"apps"`
+}
+
+// ServerExport server of an export document, the local server only carries its labels
+type ServerExport struct {
+	ID             uint                  `json:"id" yaml:"id"`
+	Local          bool                  `json:"local,omitempty" yaml:"local,omitempty"`
+	IP             string                `json:"ip,omitempty" yaml:"ip,omitempty"`
+	Port           int                   `json:"port,omitempty" yaml:"port,omitempty"`
+	User           string                `json:"user,omitempty" yaml:"user,omitempty"`
+	AuthMethod     constant.AuthMethod   `json:"auth_method,omitempty" yaml:"auth_method,omitempty"`
+	Credential     string                `json:"credential,omitempty" yaml:"credential,omitempty"`
+	Password       string                `json:"password,omitempty" yaml:"password,omitempty"`
+	JumpServer     uint                  `json:"jump_server,omitempty" yaml:"jump_server,omitempty"` // id of another server of the document
+	SSHKey         string                `json:"ssh_key,omitempty" yaml:"ssh_key,omitempty"`         // name of a managed key, keys are not exported
+	Certificate    string                `json:"certificate,omitempty" yaml:"certificate,omitempty"`
+	BecomeMethod   constant.BecomeMethod `json:"become_method,omitempty" yaml:"become_method,omitempty"`
+	BecomePassword string                `json:"become_password,omitempty" yaml:"become_password,omitempty"`
+	Labels         map[string]string     `json:"labels,omitempty" yaml:"labels,omitempty"`
+}
+
+// AppExport app of an export document
+type AppExport struct {
+	Name          string                `json:"name" yaml:"name"`
+	Server        uint                  `json:"server" yaml:"server"` // id of a server of the document
+	CheckType     constant.AppCheckType `json:"check_type" yaml:"check_type"`
+	CheckTarget   string                `json:"check_target" yaml:"check_target"`
+	CheckInterval int                   `json:"check_interval" yaml:"check_interval"`
+	StartScript   string                `json:"start_script,omitempty" yaml:"start_script,omitempty"`
+	AutoRestart   bool                  `json:"auto_restart" yaml:"auto_restart"`
+	RunAs         string                `json:"run_as,omitempty" yaml:"run_as,omitempty"`
+	Labels        map[string]string     `json:"labels,omitempty" yaml:"labels,omitempty"`
+	HTTPCheck     *pkg.HTTPCheckSpec    `json:"http_check,omitempty" yaml:"http_check,omitempty"`
+}
+
+// ExportConfig export all servers and apps, secrets is none or encrypted
+func ExportConfig(secrets string) (*ConfigExport, error) {
+	if secrets == "" {
+		secrets = ExportSecretsNone
+	}
+	if secrets != ExportSecretsNone && secrets != ExportSecretsEncrypted {
+		return nil, fmt.Errorf("secrets must be %s or %s", ExportSecretsNone, ExportSecretsEncrypted)
+	}
+	servers, err := model.GetServerList()
+	if err != nil {
+		return nil, err
+	}
+	apps, err := model.GetAppList()
+	if err != nil {
+		return nil, err
+	}
+	keys, err := model.GetSSHKeyList()
+	if err != nil {
+		return nil, err
+	}
+	keyNames := make(map[uint]string, len(keys))
+	for _, key := range keys {
+		keyNames[key.ID] = key.Name
+	}
+
+	doc := &ConfigExport{
+		Version:    ConfigExportVersion,
+		ExportedAt: time.Now().UTC().Truncate(time.Second),
+		Secrets:    secrets,
+		Servers:    make([]ServerExport, 0, len(servers)),
+		Apps:       make([]AppExport, 0, len(apps)),
+	}
+	slices.SortFunc(servers, func(a, b model.ServerModel) int { return int(a.ID) - int(b.ID) })
+	for _, server := range servers {
+		if server.ID == constant.LocalServerID {
+			doc.Servers = append(doc.Servers, ServerExport{ID: server.ID, Local: true, Labels: server.Labels})
+			continue
+		}
+		item := ServerExport{
+			ID:           server.ID,
+			IP:           server.IP,
+			Port:         server.Port,
+			User:         server.User,
+			AuthMethod:   server.AuthMethod,
+			Credential:   server.Credential,
+			JumpServer:   server.JumpServerID,
+			SSHKey:       keyNames[server.SSHKeyID],
+			Certificate:  server.Certificate,
+			BecomeMethod: server.BecomeMethod,
+			Labels:       server.Labels,
+		}
+		if secrets == ExportSecretsEncrypted {
+			item.Password = server.Password
+			item.BecomePassword = server.BecomePassword
+		}
+		doc.Servers = append(doc.Servers, item)
+	}
+	slices.SortFunc(apps, func(a, b model.AppModel) int { return int(a.ID) - int(b.ID) })
+	for _, app := range apps {
+		doc.Apps = append(doc.Apps, AppExport{
+			Name:          app.Name,
+			Server:        app.ServerID,
+			CheckType:     app.CheckType,
+			CheckTarget:   app.CheckTarget,
+			CheckInterval: app.CheckInterval,
+			StartScript:   app.StartScript,
+			AutoRestart:   app.AutoRestart,
+			RunAs:         app.RunAs,
+			Labels:        app.Labels,
+			HTTPCheck:     newHTTPCheckSpec(app.HTTPCheck),
+		})
+	}
+	return doc, nil
+}
+
+// MarshalConfigExport encode export document as yaml or json
+func MarshalConfigExport(doc *ConfigExport, format string) ([]byte, error) {
+	switch format {
+	case ExportYAML, "":
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), encoder.Close()
+	case ExportJSON:
+		data, err := json.MarshalIndent(doc, "", "  ")
+		return append(data, '\n'), err
+	}
+	return nil, fmt.Errorf("format must be %s or %s", ExportYAML, ExportJSON)
+}
+
+// ParseConfigExport decode export document, an empty format detects json by its leading brace,
+// unknown fields are rejected so a typo does not silently drop a setting
+func ParseConfigExport(format string, content []byte) (*ConfigExport, error) {
+	if format == "" {
+		format = ExportYAML
+		if strings.HasPrefix(strings.TrimSpace(string(content)), "{") {
+			format = ExportJSON
+		}
+	}
+	doc := &ConfigExport{}
+	switch format {
+	case ExportYAML:
+		decoder := yaml.NewDecoder(bytes.NewReader(content))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(doc); err != nil {
+			return nil, fmt.Errorf("parse yaml failed: %w", err)
+		}
+	case ExportJSON:
+		decoder := json.NewDecoder(bytes.NewReader(content))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(doc); err != nil {
+			return nil, fmt.Errorf("parse json failed: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("format must be %s or %s", ExportYAML, ExportJSON)
+	}
+	if doc.Version == 0 {
+		return nil, fmt.Errorf("version is missing, not an export document")
+	}
+	if doc.Version > ConfigExportVersion {
+		return nil, fmt.Errorf("export version %d is newer than the supported version %d", doc.Version, ConfigExportVersion)
+	}
+	return doc, nil
+}
+
+// AppImportItem app row to be created or updated for one app of the document
+type AppImportItem struct {
+	Name        string
+	Server      uint // server id in the document
+	Action      string
+	Error       string
+	Changes     []string
+	App         *model.AppModel
+	serverIndex int // item of the server in the server plan, -1 if the app is in error
+}
+
+// ConfigImportPlan preview of an import, nothing is saved until ApplyConfigImport
+type ConfigImportPlan struct {
+	Version int
+	Servers *ServerImportPlan
+	Apps    []*AppImportItem
+}
+
+// Count number of servers and apps with action
+func (p *ConfigImportPlan) Count(action string) int {
+	count := p.Servers.Count(action)
+	for _, item := range p.Apps {
+		if item.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+// PlanConfigImport match servers of the document with existing servers by address and port, the local server
+// with the local server, and apps by server and name, document IDs are remapped to the IDs of this instance
+func PlanConfigImport(doc *ConfigExport) (*ConfigImportPlan, error) {
+	servers, err := model.GetServerList()
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*model.ServerModel, len(servers))
+	var local *model.ServerModel
+	for i := range servers {
+		if servers[i].ID == constant.LocalServerID {
+			local = &servers[i]
+			continue
+		}
+		existing[importKey(servers[i].IP, servers[i].Port)] = &servers[i]
+	}
+	keys, err := model.GetSSHKeyList()
+	if err != nil {
+		return nil, err
+	}
+	keyIDs := make(map[string]uint, len(keys))
+	for _, key := range keys {
+		if _, ok := keyIDs[key.Name]; !ok {
+			keyIDs[key.Name] = key.ID
+		}
+	}
+
+	plan := &ConfigImportPlan{Version: doc.Version, Servers: &ServerImportPlan{Format: "export"}}
+	byID := make(map[uint]int)
+	byKey := make(map[string]int)
+	for _, entry := range doc.Servers {
+		item := planExportedServer(entry, local, existing, keyIDs)
+		if item.Action != ImportError {
+			if _, ok := byID[entry.ID]; ok {
+				item.Action, item.Error = ImportError, fmt.Sprintf("duplicate id %d", entry.ID)
+			}
+		}
+		if item.Action != ImportError && !entry.Local {
+			key := importKey(item.Server.IP, item.Server.Port)
+			if other, ok := byKey[key]; ok {
+				item.Action, item.Error = ImportError, "same address as "+plan.Servers.Items[other].Alias
+			} else {
+				byKey[key] = len(plan.Servers.Items)
+			}
+		}
+		if _, ok := byID[entry.ID]; !ok {
+			byID[entry.ID] = len(plan.Servers.Items)
+		}
+		plan.Servers.Items = append(plan.Servers.Items, item)
+	}
+	for i, entry := range doc.Servers {
+		item := plan.Servers.Items[i]
+		if item.Action == ImportError || entry.JumpServer == 0 {
+			continue
+		}
+		if index, ok := byID[entry.JumpServer]; ok && doc.Servers[index].Local {
+			item.Action, item.Error = ImportError, "local server cannot be used as jump server"
+		} else if ok && index != i {
+			item.jumpIndex = index
+		} else {
+			item.Action, item.Error = ImportError, fmt.Sprintf("jump server %d is not in the document", entry.JumpServer)
+		}
+	}
+	plan.Servers.checkJumps()
+	plan.Servers.markUnchanged(servers)
+
+	apps, err := model.GetAppList()
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	for _, entry := range doc.Apps {
+		item := planExportedApp(entry, plan.Servers, byID, apps)
+		if item.Action != ImportError {
+			key := fmt.Sprintf("%d/%s", entry.Server, entry.Name)
+			if seen[key] {
+				item.Action, item.Error = ImportError, "duplicate app name on the same server"
+			}
+			seen[key] = true
+		}
+		plan.Apps = append(plan.Apps, item)
+	}
+	return plan, nil
+}
+
+func planExportedServer(entry ServerExport, local *model.ServerModel, existing map[string]*model.ServerModel, keyIDs map[string]uint) *ServerImportItem {
+	item := &ServerImportItem{Alias: strconv.Itoa(int(entry.ID)), Jump: strconv.Itoa(int(entry.JumpServer)), jumpIndex: -1}
+	if entry.JumpServer == 0 {
+		item.Jump = ""
+	}
+	fail := func(message string) *ServerImportItem {
+		item.Action, item.Error = ImportError, message
+		return item
+	}
+	if entry.ID == 0 {
+		return fail("id is required")
+	}
+	if err := pkg.ValidateLabels(entry.Labels); err != nil {
+		return fail(err.Error())
+	}
+	if entry.Local {
+		item.Alias = "local"
+		if local == nil {
+			return fail("local server not exists")
+		}
+		server := *local
+		server.Labels = entry.Labels
+		item.Action, item.Server = ImportUpdate, &server
+		return item
+	}
+
+	item.Alias = importKey(entry.IP, entry.Port)
+	if entry.IP == "" || entry.Port == 0 || entry.User == "" {
+		return fail("ip, port and user are required")
+	}
+	switch entry.AuthMethod {
+	case constant.AuthMethodPassword, constant.AuthMethodKey, constant.AuthMethodAgent, constant.AuthMethodCertificate:
+	default:
+		return fail("auth method must be password, key, agent or certificate")
+	}
+	if entry.BecomeMethod != "" && entry.BecomeMethod != constant.BecomeSudo && entry.BecomeMethod != constant.BecomeSu {
+		return fail("become method must be sudo or su")
+	}
+	// encrypted secrets must be readable with the master key of this instance
+	for _, secret := range []string{entry.Password, entry.BecomePassword} {
+		if _, err := util.DecryptSecret(secret); err != nil {
+			return fail("secrets are encrypted with another master key: " + err.Error())
+		}
+	}
+	server := &model.ServerModel{
+		IP:             entry.IP,
+		Port:           entry.Port,
+		User:           entry.User,
+		AuthMethod:     entry.AuthMethod,
+		Credential:     entry.Credential,
+		Password:       entry.Password,
+		Certificate:    entry.Certificate,
+		BecomeMethod:   entry.BecomeMethod,
+		BecomePassword: entry.BecomePassword,
+		Labels:         entry.Labels,
+	}
+	if entry.SSHKey != "" {
+		id, ok := keyIDs[entry.SSHKey]
+		if !ok {
+			return fail("ssh key " + entry.SSHKey + " not exists, create or import it first")
+		}
+		server.SSHKeyID = id
+	}
+
+	item.Action = ImportCreate
+	if current := existing[item.Alias]; current != nil {
+		item.Action = ImportUpdate
+		server.Model = current.Model
+		// a document without secrets keeps the saved ones
+		if server.Password == "" && server.AuthMethod == current.AuthMethod {
+			server.Password = current.Password
+		}
+		if server.BecomePassword == "" {
+			server.BecomePassword = current.BecomePassword
+		}
+	}
+	item.Server = server
+	return item
+}
+
+func planExportedApp(entry AppExport, servers *ServerImportPlan, byID map[uint]int, apps []model.AppModel) *AppImportItem {
+	item := &AppImportItem{Name: entry.Name, Server: entry.Server, serverIndex: -1}
+	fail := func(message string) *AppImportItem {
+		item.Action, item.Error = ImportError, message
+		return item
+	}
+	if entry.Name == "" {
+		return fail("name is required")
+	}
+	if err := pkg.ValidateAppCheck(entry.CheckType, entry.CheckTarget); err != nil {
+		return fail(err.Error())
+	}
+	if err := pkg.ValidateHTTPCheck(entry.CheckType, entry.HTTPCheck); err != nil {
+		return fail(err.Error())
+	}
+	if err := pkg.ValidateLabels(entry.Labels); err != nil {
+		return fail(err.Error())
+	}
+	index, ok := byID[entry.Server]
+	if !ok {
+		return fail(fmt.Sprintf("server %d is not in the document", entry.Server))
+	}
+	server := servers.Items[index]
+	if server.Action == ImportError {
+		return fail("server " + server.Alias + " cannot be imported")
+	}
+	item.serverIndex = index
+
+	app := &model.AppModel{
+		ServerID:      server.Server.ID,
+		Name:          entry.Name,
+		CheckType:     entry.CheckType,
+		CheckTarget:   entry.CheckTarget,
+		CheckInterval: entry.CheckInterval,
+		StartScript:   entry.StartScript,
+		AutoRestart:   entry.AutoRestart,
+		RunAs:         entry.RunAs,
+		Labels:        entry.Labels,
+		HTTPCheck:     newHTTPCheckSpecModel(entry.HTTPCheck),
+	}
+	item.Action, item.App = ImportCreate, app
+	if server.Action == ImportCreate {
+		return item
+	}
+	for i := range apps {
+		current := &apps[i]
+		if current.ServerID != app.ServerID || current.Name != app.Name {
+			continue
+		}
+		app.Model = current.Model
+		item.Action = ImportUpdate
+		item.Changes = appChanges(app, current)
+		if len(item.Changes) == 0 {
+			item.Action = ImportUnchanged
+		}
+		break
+	}
+	return item
+}
+
+// fields of saved app that app changes
+func appChanges(app *model.AppModel, current *model.AppModel) []string {
+	var changes []string
+	for _, field := range []struct {
+		name    string
+		changed bool
+	}{
+		{"check_type", app.CheckType != current.CheckType},
+		{"check_target", app.CheckTarget != current.CheckTarget},
+		{"check_interval", app.CheckInterval != current.CheckInterval},
+		{"start_script", app.StartScript != current.StartScript},
+		{"auto_restart", app.AutoRestart != current.AutoRestart},
+		{"run_as", app.RunAs != current.RunAs},
+		{"labels", !maps.Equal(app.Labels, current.Labels) && len(app.Labels)+len(current.Labels) > 0},
+		{"http_check", httpCheckChanged(app.HTTPCheck, current.HTTPCheck)},
+	} {
+		if field.changed {
+			changes = append(changes, field.name)
+		}
+	}
+	return changes
+}
+
+// compared as JSON, values of json assertions decoded from yaml and from the database differ in type
+func httpCheckChanged(spec *model.HTTPCheckSpec, current *model.HTTPCheckSpec) bool {
+	a, errA := json.Marshal(spec)
+	b, errB := json.Marshal(current)
+	return errA != nil || errB != nil || !bytes.Equal(a, b)
+}
+
+// ApplyConfigImport save created and updated servers and apps in one transaction,
+// nothing is saved if the plan has errors
+func ApplyConfigImport(plan *ConfigImportPlan) error {
+	if errors := plan.Count(ImportError); errors > 0 {
+		return fmt.Errorf("%d servers or apps cannot be imported, nothing saved", errors)
+	}
+	servers, jumpIndex, position := plan.Servers.ordered()
+	apps := make([]*model.AppModel, 0, len(plan.Apps))
+	serverIndex := make([]int, 0, len(plan.Apps))
+	for _, item := range plan.Apps {
+		if item.Action != ImportCreate && item.Action != ImportUpdate {
+			continue
+		}
+		index := -1
+		if p, ok := position[plan.Servers.Items[item.serverIndex]]; ok {
+			index = p
+		}
+		apps = append(apps, item.App)
+		serverIndex = append(serverIndex, index)
+	}
+	return model.ImportServersAndApps(servers, jumpIndex, apps, serverIndex)
+}
+
+// StartImportedConfig connect created and updated servers of an applied plan and restart the checkers of its apps
+func StartImportedConfig(plan *ConfigImportPlan) {
+	ConnectImportedServers(plan.Servers)
+	for _, item := range plan.Apps {
+		if item.Action != ImportCreate && item.Action != ImportUpdate {
+			continue
+		}
+		pkg.GetAppCheckerManager().RemoveAppCheckerByID(item.App.ID)
+		if err := pkg.GetAppCheckerManager().NewAppChecker(NewAppCheckConfig(item.App)); err != nil {
+			logs.Logger.Error("NewAppChecker failed", zap.String("app_id", strconv.Itoa(int(item.App.ID))), zap.Error(err))
+		}
+	}
+}
+
+type configImportItemVo struct {
+	Kind     string   `json:"kind"` // server or app
+	Name     string   `json:"name"` // address of servers, name of apps
+	ID       uint     `json:"id,omitempty"`
+	Server   uint     `json:"server,omitempty"` // server id in the document of apps
+	Action   string   `json:"action"`
+	Error    string   `json:"error,omitempty"`
+	Changes  []string `json:"changes,omitempty"`
+	TargetID uint     `json:"target_id,omitempty"` // ID on this instance, known for updates and after apply
+}
+
+func newConfigImportItemVos(plan *ConfigImportPlan, doc *ConfigExport) []configImportItemVo {
+	items := make([]configImportItemVo, 0, len(plan.Servers.Items)+len(plan.Apps))
+	for i, item := range plan.Servers.Items {
+		vo := configImportItemVo{Kind: "server", Name: item.Alias, ID: doc.Servers[i].ID, Action: item.Action, Error: item.Error, Changes: item.Changes}
+		if item.Server != nil {
+			vo.TargetID = item.Server.ID
+		}
+		items = append(items, vo)
+	}
+	for _, item := range plan.Apps {
+		vo := configImportItemVo{Kind: "app", Name: item.Name, Server: item.Server, Action: item.Action, Error: item.Error, Changes: item.Changes}
+		if item.App != nil {
+			vo.TargetID = item.App.ID
+		}
+		items = append(items, vo)
+	}
+	return items
+}
+
+// ExportConfigFunc download all servers and apps, ?format=yaml|json, ?secrets=none|encrypted
+func ExportConfigFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var query struct {
+			Format  string `form:"format"`
+			Secrets string `form:"secrets"`
+		}
+		if err := c.ShouldBindQuery(&query); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+		if query.Format == "" {
+			query.Format = ExportYAML
+		}
+
+		doc, err := ExportConfig(query.Secrets)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+		data, err := MarshalConfigExport(doc, query.Format)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+		username, _ := c.Get("username")
+		logs.Logger.Info("config exported", zap.Any("username", username), zap.String("secrets", doc.Secrets))
+
+		contentType := "application/yaml"
+		if query.Format == ExportJSON {
+			contentType = "application/json"
+		}
+		filename := fmt.Sprintf("golang-om-%s.%s", doc.ExportedAt.Format("20060102-150405"), query.Format)
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Data(http.StatusOK, contentType, data)
+	}
+}
+
+// ImportConfigFunc import an export document, with dry_run only the changes are reported
+func ImportConfigFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Format  string `json:"format"` // yaml or json, empty detects it
+			Content string `json:"content" binding:"required"`
+			DryRun  bool   `json:"dry_run"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		doc, err := ParseConfigExport(req.Format, []byte(req.Content))
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+		plan, err := PlanConfigImport(doc)
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "plan config import failed")
+			logs.Logger.Error("plan config import failed: ", zap.Error(err))
+			return
+		}
+		if !req.DryRun {
+			if err := ApplyConfigImport(plan); err != nil {
+				response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+				logs.Logger.Error("config import failed: ", zap.Error(err))
+				return
+			}
+			username, _ := c.Get("username")
+			logs.Logger.Info("config imported",
+				zap.Any("username", username),
+				zap.Int("created", plan.Count(ImportCreate)),
+				zap.Int("updated", plan.Count(ImportUpdate)))
+			go StartImportedConfig(plan)
+		}
+
+		response.Success(c, gin.H{
+			"version":   plan.Version,
+			"dry_run":   req.DryRun,
+			"create":    plan.Count(ImportCreate),
+			"update":    plan.Count(ImportUpdate),
+			"unchanged": plan.Count(ImportUnchanged),
+			"errors":    plan.Count(ImportError),
+			"items":     newConfigImportItemVos(plan, doc),
+		})
+	}
+}
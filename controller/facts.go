@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/model"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"context"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type hostFactsVo struct {
+	Hostname      string         `json:"hostname"`
+	Distro        string         `json:"distro"`
+	DistroVersion string         `json:"distro_version"`
+	OSName        string         `json:"os_name"`
+	Kernel        string         `json:"kernel"`
+	Arch          string         `json:"arch"`
+	CPUCount      int            `json:"cpu_count"`
+	MemoryTotal   uint64         `json:"memory_total"` // bytes
+	Uptime        int64          `json:"uptime"`       // seconds, at collected_at
+	Filesystems   []filesystemVo `json:"filesystems"`
+	IPs           []string       `json:"ips"`
+	CollectedAt   time.Time      `json:"collected_at"`
+}
+
+type filesystemVo struct {
+	Device string `json:"device"`
+	Type   string `json:"type"`
+	Mount  string `json:"mount"`
+	Size   uint64 `json:"size"` // bytes
+	Used   uint64 `json:"used"`
+}
+
+func newHostFactsVo(facts *model.HostFactsModel) *hostFactsVo {
+	if facts == nil {
+		return nil
+	}
+	vo := &hostFactsVo{
+		Hostname:      facts.Hostname,
+		Distro:        facts.Distro,
+		DistroVersion: facts.DistroVersion,
+		OSName:        facts.OSName,
+		Kernel:        facts.Kernel,
+		Arch:          facts.Arch,
+		CPUCount:      facts.CPUCount,
+		MemoryTotal:   facts.MemoryTotal,
+		Uptime:        facts.Uptime,
+		Filesystems:   make([]filesystemVo, 0, len(facts.Filesystems)),
+		IPs:           facts.IPs,
+		CollectedAt:   facts.CollectedAt,
+	}
+	for _, fs := range facts.Filesystems {
+		vo.Filesystems = append(vo.Filesystems, filesystemVo(fs))
+	}
+	return vo
+}
+
+// SaveHostFacts persist facts collected from server, used as the facts handler of the connection pool
+func SaveHostFacts(serverID uint, facts *pkg.HostFacts) {
+	record := &model.HostFactsModel{
+		ServerID:      serverID,
+		Hostname:      facts.Hostname,
+		Distro:        facts.Distro,
+		DistroVersion: facts.DistroVersion,
+		OSName:        facts.OSName,
+		Kernel:        facts.Kernel,
+		Arch:          facts.Arch,
+		CPUCount:      facts.CPUCount,
+		MemoryTotal:   facts.MemoryTotal,
+		Uptime:        int64(facts.Uptime.Seconds()),
+		Filesystems:   make([]model.HostFilesystem, 0, len(facts.Filesystems)),
+		IPs:           facts.IPs,
+		CollectedAt:   facts.CollectedAt,
+	}
+	for _, fs := range facts.Filesystems {
+		record.Filesystems = append(record.Filesystems, model.HostFilesystem(fs))
+	}
+	if err := record.SaveHostFacts(); err != nil {
+		logs.Logger.Error("SaveHostFacts failed", zap.String("server_id", strconv.Itoa(int(serverID))), zap.Error(err))
+	}
+}
+
+// factsFilter server list filter, empty fields match everything
+// text fields match case-insensitively: distro, arch and version exactly, hostname and os by substring, kernel by prefix
+type factsFilter struct {
+	Distro      string `form:"distro"`
+	Version     string `form:"version"`
+	OS          string `form:"os"`
+	Kernel      string `form:"kernel"`
+	Arch        string `form:"arch"`
+	Hostname    string `form:"hostname"`
+	IP          string `form:"ip"`    // one of the server addresses
+	Mount       string `form:"mount"` // has a file system mounted there
+	MinCPU      int    `form:"min_cpu"`
+	MinMemoryMB uint64 `form:"min_memory_mb"`
+}
+
+func (f *factsFilter) empty() bool {
+	return *f == factsFilter{}
+}
+
+// servers without facts only match the empty filter
+func (f *factsFilter) match(facts *model.HostFactsModel) bool {
+	if f.empty() {
+		return true
+	}
+	if facts == nil {
+		return false
+	}
+	lower := strings.ToLower
+	switch {
+	case f.Distro != "" && !strings.EqualFold(facts.Distro, f.Distro),
+		f.Version != "" && !strings.EqualFold(facts.DistroVersion, f.Version),
+		f.Arch != "" && !strings.EqualFold(facts.Arch, f.Arch),
+		f.OS != "" && !strings.Contains(lower(facts.OSName), lower(f.OS)),
+		f.Hostname != "" && !strings.Contains(lower(facts.Hostname), lower(f.Hostname)),
+		f.Kernel != "" && !strings.HasPrefix(lower(facts.Kernel), lower(f.Kernel)),
+		f.IP != "" && !slices.Contains(facts.IPs, f.IP),
+		f.MinCPU > 0 && facts.CPUCount < f.MinCPU,
+		f.MinMemoryMB > 0 && facts.MemoryTotal < f.MinMemoryMB*1024*1024:
+		return false
+	}
+	if f.Mount != "" && !slices.ContainsFunc(facts.Filesystems, func(fs model.HostFilesystem) bool {
+		return fs.Mount == f.Mount
+	}) {
+		return false
+	}
+	return true
+}
+
+// RefreshServerFactsFunc collect facts of server now instead of waiting for its next connect
+func RefreshServerFactsFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID uint `json:"id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		server := &model.ServerModel{Model: gorm.Model{ID: req.ID}}
+		if !server.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not exists")
+			return
+		}
+		serverInfo := pkg.GetConnectionPool().GetServerByID(req.ID)
+		if serverInfo == nil {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not in connection pool")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+		if _, err := pkg.GetConnectionPool().RefreshFacts(ctx, serverInfo); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.ServerConnectError, err.Error())
+			logs.Logger.Error("collect host facts failed: ", zap.Error(err))
+			return
+		}
+
+		facts, err := model.GetHostFacts(req.ID)
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "get host facts failed")
+			logs.Logger.Error("get host facts failed: ", zap.Error(err))
+			return
+		}
+		response.Success(c, gin.H{"facts": newHostFactsVo(facts)})
+	}
+}
@@ -0,0 +1,312 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+type fileVo struct {
+	Name    string    `json:"name"`
+	Path    string    `json:"path"`
+	Size    int64     `json:"size"`
+	Mode    string    `json:"mode"`
+	ModTime time.Time `json:"mod_time"`
+	IsDir   bool      `json:"is_dir"`
+}
+
+type filePathRequest struct {
+	ServerID uint   `json:"server_id" binding:"required"`
+	Path     string `json:"path" binding:"required"`
+}
+
+// open file system of server, respond failure and return nil if not usable
+func openServerFileSystem(c *gin.Context, serverID uint) pkg.FileSystem {
+	server := pkg.GetConnectionPool().GetServerByID(serverID)
+	if server == nil {
+		response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not exists")
+		return nil
+	}
+	fs, err := server.OpenFileSystem()
+	if err != nil {
+		response.Fail(c, http.StatusInternalServerError, constant.ServerConnectError, "open file system failed")
+		logs.Logger.Error("open file system failed: ", zap.Error(err))
+		return nil
+	}
+	return fs
+}
+
+// respond file operation failure
+func failFileOperation(c *gin.Context, operation string, err error) {
+	if os.IsNotExist(err) {
+		response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "file not exists")
+		return
+	}
+	response.Fail(c, http.StatusInternalServerError, constant.UnknownError, fmt.Sprintf("%s failed: %v", operation, err))
+	logs.Logger.Error(operation+" failed: ", zap.Error(err))
+}
+
+// size limit from config in MB, 0 means unlimited
+func fileSizeLimit(key string) int64 {
+	return viper.GetInt64(key) * 1024 * 1024
+}
+
+func ListFilesFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req filePathRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		fs := openServerFileSystem(c, req.ServerID)
+		if fs == nil {
+			return
+		}
+		defer fs.Close()
+
+		files, err := fs.ReadDir(req.Path)
+		if err != nil {
+			failFileOperation(c, "list files", err)
+			return
+		}
+		pkg.SortFiles(files)
+
+		result := make([]fileVo, 0, len(files))
+		for _, file := range files {
+			result = append(result, fileVo{
+				Name:    file.Name,
+				Path:    path.Join(req.Path, file.Name),
+				Size:    file.Size,
+				Mode:    file.Mode.String(),
+				ModTime: file.ModTime,
+				IsDir:   file.IsDir,
+			})
+		}
+		response.Success(c, gin.H{"path": req.Path, "files": result})
+	}
+}
+
+// UploadFileFunc multipart form: server_id, path (target directory), file
+func UploadFileFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limit := fileSizeLimit("Files.MaxUploadSize"); limit > 0 {
+			c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+		}
+
+		serverID, err := strconv.Atoi(c.PostForm("server_id"))
+		dir := c.PostForm("path")
+		if err != nil || dir == "" {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			return
+		}
+		header, err := c.FormFile("file")
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "file missing or too large")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		src, err := header.Open()
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "read upload file failed")
+			return
+		}
+		defer src.Close()
+
+		fs := openServerFileSystem(c, uint(serverID))
+		if fs == nil {
+			return
+		}
+		defer fs.Close()
+
+		target := path.Join(dir, path.Base(header.Filename))
+		dst, err := fs.Create(target)
+		if err != nil {
+			failFileOperation(c, "create file", err)
+			return
+		}
+		written, err := io.Copy(dst, src)
+		if closeErr := dst.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			failFileOperation(c, "upload file", err)
+			return
+		}
+
+		logs.Logger.Info("file uploaded",
+			zap.String("server_id", strconv.Itoa(serverID)),
+			zap.String("path", target),
+			zap.Int64("size", written))
+		response.Success(c, gin.H{"path": target, "size": written})
+	}
+}
+
+// DownloadFileFunc query: server_id, path
+func DownloadFileFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		serverID, err := strconv.Atoi(c.Query("server_id"))
+		filePath := c.Query("path")
+		if err != nil || filePath == "" {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			return
+		}
+
+		fs := openServerFileSystem(c, uint(serverID))
+		if fs == nil {
+			return
+		}
+		defer fs.Close()
+
+		info, err := fs.Stat(filePath)
+		if err != nil {
+			failFileOperation(c, "stat file", err)
+			return
+		}
+		if info.IsDir {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "cannot download a directory")
+			return
+		}
+		if limit := fileSizeLimit("Files.MaxDownloadSize"); limit > 0 && info.Size > limit {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "file too large")
+			return
+		}
+
+		src, err := fs.Open(filePath)
+		if err != nil {
+			failFileOperation(c, "open file", err)
+			return
+		}
+		defer src.Close()
+
+		c.DataFromReader(http.StatusOK, info.Size, "application/octet-stream", src, map[string]string{
+			"Content-Disposition": mime.FormatMediaType("attachment", map[string]string{"filename": info.Name}),
+		})
+	}
+}
+
+func MkdirFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req filePathRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		fs := openServerFileSystem(c, req.ServerID)
+		if fs == nil {
+			return
+		}
+		defer fs.Close()
+
+		if err := fs.Mkdir(req.Path); err != nil {
+			failFileOperation(c, "mkdir", err)
+			return
+		}
+		response.Success(c, gin.H{"path": req.Path})
+	}
+}
+
+func RenameFileFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ServerID uint   `json:"server_id" binding:"required"`
+			Path     string `json:"path" binding:"required"`
+			NewPath  string `json:"new_path" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		fs := openServerFileSystem(c, req.ServerID)
+		if fs == nil {
+			return
+		}
+		defer fs.Close()
+
+		if err := fs.Rename(req.Path, req.NewPath); err != nil {
+			failFileOperation(c, "rename", err)
+			return
+		}
+		response.Success(c, gin.H{"path": req.NewPath})
+	}
+}
+
+// DeleteFileFunc delete a file or an empty directory
+func DeleteFileFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req filePathRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+		if path.Clean(req.Path) == "/" {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "cannot delete root directory")
+			return
+		}
+
+		fs := openServerFileSystem(c, req.ServerID)
+		if fs == nil {
+			return
+		}
+		defer fs.Close()
+
+		if err := fs.Remove(req.Path); err != nil {
+			failFileOperation(c, "delete", err)
+			return
+		}
+		response.Success(c, gin.H{"message": "file deleted successfully"})
+	}
+}
+
+// ChmodFileFunc mode is an octal string such as "0644"
+func ChmodFileFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ServerID uint   `json:"server_id" binding:"required"`
+			Path     string `json:"path" binding:"required"`
+			Mode     string `json:"mode" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+		mode, err := strconv.ParseUint(req.Mode, 8, 32)
+		if err != nil || mode > 0777 {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "invalid mode")
+			return
+		}
+
+		fs := openServerFileSystem(c, req.ServerID)
+		if fs == nil {
+			return
+		}
+		defer fs.Close()
+
+		if err := fs.Chmod(req.Path, os.FileMode(mode)); err != nil {
+			failFileOperation(c, "chmod", err)
+			return
+		}
+		response.Success(c, gin.H{"path": req.Path, "mode": fmt.Sprintf("%04o", mode)})
+	}
+}
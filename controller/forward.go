@@ -0,0 +1,302 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/model"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type forwardVo struct {
+	ID              uint                   `json:"id"`
+	Name            string                 `json:"name"`
+	ServerID        uint                   `json:"server_id"`
+	Type            constant.ForwardType   `json:"type"`
+	Listen          string                 `json:"listen"`
+	Target          string                 `json:"target"`
+	Enabled         bool                   `json:"enabled"`
+	Status          constant.ForwardStatus `json:"status"`
+	LastError       string                 `json:"last_error,omitempty"`
+	StartedAt       *time.Time             `json:"started_at,omitempty"`
+	Reestablished   int                    `json:"reestablished"`
+	ActiveConns     int64                  `json:"active_conns"`
+	TotalConns      uint64                 `json:"total_conns"`
+	FailedConns     uint64                 `json:"failed_conns"`
+	BytesToTarget   uint64                 `json:"bytes_to_target"`
+	BytesFromTarget uint64                 `json:"bytes_from_target"`
+}
+
+// definition of forward with the state and counters of its running tunnel
+func newForwardVo(forward *model.ForwardModel) forwardVo {
+	result := forwardVo{
+		ID:       forward.ID,
+		Name:     forward.Name,
+		ServerID: forward.ServerID,
+		Type:     forward.Type,
+		Listen:   forward.Listen,
+		Target:   forward.Target,
+		Enabled:  forward.Enabled,
+		Status:   constant.ForwardStopped,
+	}
+	running := pkg.GetForwardManager().GetForward(forward.ID)
+	if running == nil {
+		return result
+	}
+	stats := running.Stats()
+	result.Status = stats.Status
+	result.LastError = stats.LastError
+	if !stats.StartedAt.IsZero() {
+		result.StartedAt = &stats.StartedAt
+	}
+	result.Reestablished = stats.Reestablished
+	result.ActiveConns = stats.ActiveConns
+	result.TotalConns = stats.TotalConns
+	result.FailedConns = stats.FailedConns
+	result.BytesToTarget = stats.BytesToTarget
+	result.BytesFromTarget = stats.BytesFromTarget
+	return result
+}
+
+func newForwardConfig(forward *model.ForwardModel) pkg.ForwardConfig {
+	return pkg.ForwardConfig{
+		ID:       forward.ID,
+		ServerID: forward.ServerID,
+		Name:     forward.Name,
+		Type:     forward.Type,
+		Listen:   forward.Listen,
+		Target:   forward.Target,
+	}
+}
+
+// StartForwards start enabled port forwards, called at startup
+func StartForwards() error {
+	forwards, err := model.GetForwardList()
+	if err != nil {
+		return err
+	}
+	for _, forward := range forwards {
+		if !forward.Enabled {
+			continue
+		}
+		if err := pkg.GetForwardManager().Start(newForwardConfig(&forward)); err != nil {
+			logs.Logger.Error("start port forward failed", zap.String("forward_id", strconv.Itoa(int(forward.ID))), zap.Error(err))
+		}
+	}
+	return nil
+}
+
+// validate forward, false if a failure response was sent
+func validateForward(c *gin.Context, forward *model.ForwardModel) bool {
+	config := newForwardConfig(forward)
+	if err := pkg.ValidateForwardConfig(&config); err != nil {
+		response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+		return false
+	}
+	if pkg.GetConnectionPool().GetServerByID(forward.ServerID) == nil {
+		response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not exists")
+		return false
+	}
+	return true
+}
+
+// find forward by id, false if a failure response was sent
+func bindForward(c *gin.Context) (*model.ForwardModel, bool) {
+	var req struct {
+		ID uint `json:"id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+		logs.Logger.Error("parameter bind error: ", zap.Error(err))
+		return nil, false
+	}
+	forward := &model.ForwardModel{Model: gorm.Model{ID: req.ID}}
+	if !forward.IsExists() {
+		response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "forward not exists")
+		return nil, false
+	}
+	return forward, true
+}
+
+func GetForwardListFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		forwards, err := model.GetForwardList()
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "get forward list failed")
+			logs.Logger.Error("get forward list failed: ", zap.Error(err))
+			return
+		}
+		result := make([]forwardVo, 0, len(forwards))
+		for i := range forwards {
+			result = append(result, newForwardVo(&forwards[i]))
+		}
+		response.Success(c, gin.H{"forwards": result})
+	}
+}
+
+// GetForwardFunc definition, status and byte counters of a forward
+func GetForwardFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		forward, ok := bindForward(c)
+		if !ok {
+			return
+		}
+		response.Success(c, gin.H{"forward": newForwardVo(forward)})
+	}
+}
+
+// CreateForwardFunc type local listens on this host and connects to target from the server,
+// type remote listens on the server and connects to target from this host
+func CreateForwardFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name     string               `json:"name" binding:"required"`
+			ServerID uint                 `json:"server_id" binding:"required"`
+			Type     constant.ForwardType `json:"type" binding:"required"`
+			Listen   string               `json:"listen" binding:"required"`
+			Target   string               `json:"target" binding:"required"`
+			Enabled  bool                 `json:"enabled"` // start right away
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		forward := &model.ForwardModel{
+			Name:     req.Name,
+			ServerID: req.ServerID,
+			Type:     req.Type,
+			Listen:   req.Listen,
+			Target:   req.Target,
+			Enabled:  req.Enabled,
+		}
+		if !validateForward(c, forward) {
+			return
+		}
+		if err := forward.CreateForward(); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "forward create failed")
+			logs.Logger.Error("forward create failed: ", zap.Error(err))
+			return
+		}
+		if forward.Enabled {
+			if err := pkg.GetForwardManager().Start(newForwardConfig(forward)); err != nil {
+				forward.Enabled = false
+				if err := forward.UpdateForward(); err != nil {
+					logs.Logger.Error("forward update failed: ", zap.Error(err))
+				}
+				response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "forward created but start failed: "+err.Error())
+				return
+			}
+		}
+		response.Success(c, gin.H{"forward": newForwardVo(forward)})
+	}
+}
+
+// UpdateForwardFunc a running forward is restarted with the new definition
+func UpdateForwardFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID       uint                 `json:"id" binding:"required"`
+			Name     string               `json:"name" binding:"required"`
+			ServerID uint                 `json:"server_id" binding:"required"`
+			Type     constant.ForwardType `json:"type" binding:"required"`
+			Listen   string               `json:"listen" binding:"required"`
+			Target   string               `json:"target" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		forward := &model.ForwardModel{Model: gorm.Model{ID: req.ID}}
+		if !forward.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "forward not exists")
+			return
+		}
+		forward.Name = req.Name
+		forward.ServerID = req.ServerID
+		forward.Type = req.Type
+		forward.Listen = req.Listen
+		forward.Target = req.Target
+		if !validateForward(c, forward) {
+			return
+		}
+		if err := forward.UpdateForward(); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "forward update failed")
+			logs.Logger.Error("forward update failed: ", zap.Error(err))
+			return
+		}
+
+		if pkg.GetForwardManager().Stop(forward.ID) {
+			if err := pkg.GetForwardManager().Start(newForwardConfig(forward)); err != nil {
+				response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "forward updated but restart failed: "+err.Error())
+				return
+			}
+		}
+		response.Success(c, gin.H{"forward": newForwardVo(forward)})
+	}
+}
+
+func DeleteForwardFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		forward, ok := bindForward(c)
+		if !ok {
+			return
+		}
+		pkg.GetForwardManager().Stop(forward.ID)
+		if err := forward.DeleteForward(); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "forward delete failed")
+			logs.Logger.Error("forward delete failed: ", zap.Error(err))
+			return
+		}
+		response.Success(c, gin.H{"message": "forward deleted successfully"})
+	}
+}
+
+// StartForwardFunc start forward and keep it started across restarts, if the server is not connected
+// the forward waits for it and is established once the server reconnects
+func StartForwardFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		forward, ok := bindForward(c)
+		if !ok {
+			return
+		}
+		if pkg.GetForwardManager().GetForward(forward.ID) == nil {
+			if err := pkg.GetForwardManager().Start(newForwardConfig(forward)); err != nil {
+				response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "forward start failed: "+err.Error())
+				logs.Logger.Error("forward start failed: ", zap.Error(err))
+				return
+			}
+		}
+		forward.Enabled = true
+		if err := forward.UpdateForward(); err != nil {
+			logs.Logger.Error("forward update failed: ", zap.Error(err))
+		}
+		response.Success(c, gin.H{"forward": newForwardVo(forward)})
+	}
+}
+
+// StopForwardFunc stop forward and close its connections
+func StopForwardFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		forward, ok := bindForward(c)
+		if !ok {
+			return
+		}
+		pkg.GetForwardManager().Stop(forward.ID)
+		forward.Enabled = false
+		if err := forward.UpdateForward(); err != nil {
+			logs.Logger.Error("forward update failed: ", zap.Error(err))
+		}
+		response.Success(c, gin.H{"forward": newForwardVo(forward)})
+	}
+}
@@ -0,0 +1,264 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/model"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type serverGroupVo struct {
+	ID          uint   `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Selector    string `json:"selector"`
+	ServerIDs   []uint `json:"server_ids"`
+	Members     []uint `json:"members"` // servers selected by the selector plus server_ids
+}
+
+func newServerGroupVo(group *model.ServerGroupModel) serverGroupVo {
+	vo := serverGroupVo{
+		ID:          group.ID,
+		Name:        group.Name,
+		Description: group.Description,
+		Selector:    group.Selector,
+		ServerIDs:   group.ServerIDs,
+	}
+	if vo.ServerIDs == nil {
+		vo.ServerIDs = []uint{}
+	}
+	members, err := groupMembers(group)
+	if err != nil {
+		logs.Logger.Error("resolve group members failed: ", zap.Error(err))
+	}
+	vo.Members = members
+	return vo
+}
+
+// servers of group that are in the connection pool, ordered by ID
+func groupMembers(group *model.ServerGroupModel) ([]uint, error) {
+	members := make([]uint, 0)
+	for _, id := range group.ServerIDs {
+		if pkg.GetConnectionPool().GetServerByID(id) != nil {
+			members = append(members, id)
+		}
+	}
+	// an empty selector would match every server, a group without one only has the servers added by ID
+	if group.Selector != "" {
+		selector, err := pkg.ParseLabelSelector(group.Selector)
+		if err != nil {
+			return members, err
+		}
+		for _, server := range pkg.GetConnectionPool().SelectServers(selector) {
+			members = append(members, server.ID)
+		}
+	}
+	slices.Sort(members)
+	return slices.Compact(members), nil
+}
+
+// serverSelection servers given by ID, label selector or group, accepted wherever a list of servers is,
+// the selected servers are the union of all three
+type serverSelection struct {
+	ServerIDs []uint `json:"server_ids"`
+	Selector  string `json:"selector"` // label selector such as env=prod,role in (web,api)
+	GroupID   uint   `json:"group_id"`
+}
+
+func (s *serverSelection) empty() bool {
+	return len(s.ServerIDs) == 0 && s.Selector == "" && s.GroupID == 0
+}
+
+// resolve selected server IDs, explicit IDs first in request order, then the others by ID
+func (s *serverSelection) resolve() ([]uint, error) {
+	serverIDs := make([]uint, 0, len(s.ServerIDs))
+	seen := make(map[uint]bool)
+	add := func(id uint) {
+		if !seen[id] {
+			seen[id] = true
+			serverIDs = append(serverIDs, id)
+		}
+	}
+	for _, id := range s.ServerIDs {
+		add(id)
+	}
+
+	var selected []uint
+	if s.Selector != "" {
+		selector, err := pkg.ParseLabelSelector(s.Selector)
+		if err != nil {
+			return nil, err
+		}
+		for _, server := range pkg.GetConnectionPool().SelectServers(selector) {
+			selected = append(selected, server.ID)
+		}
+	}
+	if s.GroupID != 0 {
+		group := &model.ServerGroupModel{Model: gorm.Model{ID: s.GroupID}}
+		if !group.IsExists() {
+			return nil, fmt.Errorf("server group %d not exists", s.GroupID)
+		}
+		members, err := groupMembers(group)
+		if err != nil {
+			return nil, fmt.Errorf("selector of server group %s: %w", group.Name, err)
+		}
+		selected = append(selected, members...)
+	}
+	slices.Sort(selected)
+	for _, id := range selected {
+		add(id)
+	}
+	return serverIDs, nil
+}
+
+// validate group, false if a failure response was sent
+func validateServerGroup(c *gin.Context, group *model.ServerGroupModel) bool {
+	if _, err := pkg.ParseLabelSelector(group.Selector); err != nil {
+		response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+		return false
+	}
+	for _, id := range group.ServerIDs {
+		if pkg.GetConnectionPool().GetServerByID(id) == nil {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, fmt.Sprintf("server %d not exists", id))
+			return false
+		}
+	}
+	return true
+}
+
+func GetServerGroupListFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		groups, err := model.GetServerGroupList()
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "get server group list failed")
+			logs.Logger.Error("get server group list failed: ", zap.Error(err))
+			return
+		}
+		result := make([]serverGroupVo, 0, len(groups))
+		for i := range groups {
+			result = append(result, newServerGroupVo(&groups[i]))
+		}
+		response.Success(c, gin.H{"groups": result})
+	}
+}
+
+func GetServerGroupFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID uint `json:"id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		group := &model.ServerGroupModel{Model: gorm.Model{ID: req.ID}}
+		if !group.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server group not exists")
+			return
+		}
+		response.Success(c, gin.H{"group": newServerGroupVo(group)})
+	}
+}
+
+func CreateServerGroupFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name        string `json:"name" binding:"required"`
+			Description string `json:"description"`
+			Selector    string `json:"selector"`
+			ServerIDs   []uint `json:"server_ids"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		group := &model.ServerGroupModel{
+			Name:        req.Name,
+			Description: req.Description,
+			Selector:    req.Selector,
+			ServerIDs:   req.ServerIDs,
+		}
+		if !validateServerGroup(c, group) {
+			return
+		}
+		if err := group.CreateServerGroup(); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "server group create failed")
+			logs.Logger.Error("server group create failed: ", zap.Error(err))
+			return
+		}
+		response.Success(c, gin.H{"group": newServerGroupVo(group)})
+	}
+}
+
+func UpdateServerGroupFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID          uint   `json:"id" binding:"required"`
+			Name        string `json:"name" binding:"required"`
+			Description string `json:"description"`
+			Selector    string `json:"selector"`
+			ServerIDs   []uint `json:"server_ids"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		group := &model.ServerGroupModel{Model: gorm.Model{ID: req.ID}}
+		if !group.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server group not exists")
+			return
+		}
+		group.Name = req.Name
+		group.Description = req.Description
+		group.Selector = req.Selector
+		group.ServerIDs = req.ServerIDs
+		if !validateServerGroup(c, group) {
+			return
+		}
+		if err := group.UpdateServerGroup(); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "server group update failed")
+			logs.Logger.Error("server group update failed: ", zap.Error(err))
+			return
+		}
+		response.Success(c, gin.H{"group": newServerGroupVo(group)})
+	}
+}
+
+func DeleteServerGroupFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID uint `json:"id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		group := &model.ServerGroupModel{Model: gorm.Model{ID: req.ID}}
+		if !group.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server group not exists")
+			return
+		}
+		if err := group.DeleteServerGroup(); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "server group delete failed")
+			logs.Logger.Error("server group delete failed: ", zap.Error(err))
+			return
+		}
+		response.Success(c, gin.H{"message": "server group deleted successfully"})
+	}
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type hostKeyVo struct {
+	ServerID           uint                   `json:"server_id"`
+	Address            string                 `json:"address"`
+	Status             constant.HostKeyStatus `json:"status"`
+	KeyType            string                 `json:"key_type"`
+	Fingerprint        string                 `json:"fingerprint"`
+	PendingKeyType     string                 `json:"pending_key_type"`
+	PendingFingerprint string                 `json:"pending_fingerprint"`
+}
+
+// get pooled remote server by request id, respond failure and return nil if not usable
+func getRemoteServer(c *gin.Context, serverID uint) *pkg.Server {
+	if serverID == constant.LocalServerID {
+		response.Fail(c, http.StatusBadRequest, constant.ParameterError, "local server has no host key")
+		return nil
+	}
+	server := pkg.GetConnectionPool().GetServerByID(serverID)
+	if server == nil {
+		response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not exists")
+		return nil
+	}
+	return server
+}
+
+func GetHostKeyFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID uint `json:"id" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		server := getRemoteServer(c, req.ID)
+		if server == nil {
+			return
+		}
+
+		info, err := pkg.GetHostKeyStore().GetHostKeyInfo(server.Address())
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "get host key failed")
+			logs.Logger.Error("get host key failed: ", zap.Error(err))
+			return
+		}
+
+		response.Success(c, gin.H{"host_key": hostKeyVo{
+			ServerID:           server.ID,
+			Address:            info.Address,
+			Status:             info.Status,
+			KeyType:            info.KeyType,
+			Fingerprint:        info.Fingerprint,
+			PendingKeyType:     info.PendingKeyType,
+			PendingFingerprint: info.PendingFingerprint,
+		}})
+	}
+}
+
+func AcceptHostKeyFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID          uint   `json:"id" binding:"required"`
+			Fingerprint string `json:"fingerprint" binding:"required"` // must equal the pending fingerprint shown to the user
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		server := getRemoteServer(c, req.ID)
+		if server == nil {
+			return
+		}
+
+		if err := pkg.GetHostKeyStore().AcceptHostKey(server.Address(), req.Fingerprint); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			logs.Logger.Error("accept host key failed: ", zap.Error(err))
+			return
+		}
+
+		// connect with the newly trusted key right away
+		if err := pkg.GetConnectionPool().ReconnectServerByID(server.ID); err != nil {
+			failServerConnect(c, err)
+			return
+		}
+
+		response.Success(c, gin.H{"message": "host key accepted"})
+	}
+}
+
+func ResetHostKeyFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID uint `json:"id" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		server := getRemoteServer(c, req.ID)
+		if server == nil {
+			return
+		}
+
+		if err := pkg.GetHostKeyStore().ResetHostKey(server.Address()); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "reset host key failed")
+			logs.Logger.Error("reset host key failed: ", zap.Error(err))
+			return
+		}
+
+		response.Success(c, gin.H{"message": "host key reset"})
+	}
+}
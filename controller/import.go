@@ -0,0 +1,493 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/model"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"GolangOM/util"
+	"fmt"
+	"maps"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// import actions of a host
+const (
+	ImportCreate    = "create"
+	ImportUpdate    = "update"
+	ImportUnchanged = "unchanged"
+	ImportError     = "error"
+)
+
+// ServerImportOptions defaults for hosts that do not set them
+type ServerImportOptions struct {
+	DefaultUser string
+	DefaultPort int               // 22 if 0
+	Labels      map[string]string // added to every imported server, Ansible groups are added as labels with empty values
+}
+
+// ServerImportItem server row to be created or updated for one inventory host
+type ServerImportItem struct {
+	Alias     string
+	Line      int
+	Action    string // create, update, unchanged or error
+	Error     string
+	Changes   []string           // fields an update changes
+	Jump      string             // jump host as written in the inventory
+	Server    *model.ServerModel // row to save, ID is set for updates
+	jumpIndex int                // item of the jump server when it is imported too, -1 otherwise
+}
+
+// ServerImportPlan preview of an import, nothing is saved until ApplyServerImport
+type ServerImportPlan struct {
+	Format string
+	Items  []*ServerImportItem
+}
+
+// Count number of items with action
+func (p *ServerImportPlan) Count(action string) int {
+	count := 0
+	for _, item := range p.Items {
+		if item.Action == action {
+			count++
+		}
+	}
+	return count
+}
+
+func importKey(ip string, port int) string {
+	return net.JoinHostPort(ip, strconv.Itoa(port))
+}
+
+// PlanServerImport parse inventory content and match its hosts with existing servers by address and port
+func PlanServerImport(format string, content string, options ServerImportOptions) (*ServerImportPlan, error) {
+	hosts, format, err := pkg.ParseInventory(format, content)
+	if err != nil {
+		return nil, err
+	}
+	if options.DefaultPort == 0 {
+		options.DefaultPort = 22
+	}
+	if err := pkg.ValidateLabels(options.Labels); err != nil {
+		return nil, err
+	}
+	servers, err := model.GetServerList()
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]*model.ServerModel, len(servers))
+	for i := range servers {
+		existing[importKey(servers[i].IP, servers[i].Port)] = &servers[i]
+	}
+
+	plan := &ServerImportPlan{Format: format}
+	byAlias := make(map[string]int)
+	byKey := make(map[string]int)
+	for _, host := range hosts {
+		item := planImportHost(host, options, existing)
+		if item.Action != ImportError {
+			key := importKey(item.Server.IP, item.Server.Port)
+			if other, ok := byKey[key]; ok {
+				item.Action, item.Error = ImportError, "same address as "+plan.Items[other].Alias
+			} else {
+				byKey[key] = len(plan.Items)
+			}
+		}
+		byAlias[host.Alias] = len(plan.Items)
+		plan.Items = append(plan.Items, item)
+	}
+
+	for _, item := range plan.Items {
+		if item.Action != ImportError && item.Jump != "" {
+			resolveImportJump(item, options, byAlias, byKey, existing)
+		}
+	}
+	plan.checkJumps()
+	plan.markUnchanged(servers)
+	return plan, nil
+}
+
+func planImportHost(host pkg.InventoryHost, options ServerImportOptions, existing map[string]*model.ServerModel) *ServerImportItem {
+	item := &ServerImportItem{Alias: host.Alias, Line: host.Line, Jump: host.ProxyJump, jumpIndex: -1}
+	fail := func(message string) *ServerImportItem {
+		item.Action, item.Error = ImportError, message
+		return item
+	}
+
+	server := &model.ServerModel{
+		IP:             host.Address(),
+		Port:           host.Port,
+		User:           host.User,
+		BecomeMethod:   constant.BecomeMethod(host.BecomeMethod),
+		BecomePassword: host.BecomePassword,
+		Labels:         make(map[string]string),
+	}
+	if server.Port == 0 {
+		server.Port = options.DefaultPort
+	}
+	if server.User == "" {
+		server.User = options.DefaultUser
+	}
+	if server.User == "" {
+		return fail("user is required, set User or ansible_user, or give a default user")
+	}
+	switch {
+	case host.IdentityFile != "":
+		server.AuthMethod, server.Credential = constant.AuthMethodKey, host.IdentityFile
+	case host.Password != "":
+		server.AuthMethod, server.Password = constant.AuthMethodPassword, host.Password
+	default:
+		// like ssh without IdentityFile, keys come from ssh-agent
+		server.AuthMethod = constant.AuthMethodAgent
+	}
+	if server.BecomeMethod != "" && server.BecomeMethod != constant.BecomeSudo && server.BecomeMethod != constant.BecomeSu {
+		return fail("become method must be sudo or su")
+	}
+	maps.Copy(server.Labels, options.Labels)
+	for _, group := range host.Groups {
+		server.Labels[group] = ""
+	}
+	if err := pkg.ValidateLabels(server.Labels); err != nil {
+		return fail(err.Error())
+	}
+
+	item.Action = ImportCreate
+	if current := existing[importKey(server.IP, server.Port)]; current != nil {
+		if current.ID == constant.LocalServerID {
+			return fail("address of the local server")
+		}
+		item.Action = ImportUpdate
+		server.Model = current.Model
+		server.SSHKeyID = current.SSHKeyID
+		server.Certificate = current.Certificate
+		// secrets are not in the inventory, keep the saved ones
+		if server.Password == "" && server.AuthMethod == current.AuthMethod {
+			server.Password = current.Password
+		}
+		if server.BecomePassword == "" {
+			server.BecomePassword = current.BecomePassword
+		}
+		labels := maps.Clone(current.Labels)
+		if labels == nil {
+			labels = make(map[string]string)
+		}
+		maps.Copy(labels, server.Labels)
+		server.Labels = labels
+	}
+	item.Server = server
+	return item
+}
+
+// jump host is an alias of the inventory, or [user@]host[:port] of an imported or existing server
+func resolveImportJump(item *ServerImportItem, options ServerImportOptions, byAlias map[string]int, byKey map[string]int, existing map[string]*model.ServerModel) {
+	if strings.Contains(item.Jump, ",") {
+		item.Action, item.Error = ImportError, "ProxyJump with more than one hop is not supported, import the hops as servers with their own jump host"
+		return
+	}
+	if index, ok := byAlias[item.Jump]; ok {
+		item.jumpIndex = index
+		return
+	}
+
+	address := item.Jump
+	if _, rest, ok := strings.Cut(address, "@"); ok {
+		address = rest
+	}
+	port := options.DefaultPort
+	if host, portText, err := net.SplitHostPort(address); err == nil {
+		if port, err = strconv.Atoi(portText); err != nil {
+			item.Action, item.Error = ImportError, "invalid port of jump host "+item.Jump
+			return
+		}
+		address = host
+	}
+	key := importKey(address, port)
+	if index, ok := byKey[key]; ok {
+		item.jumpIndex = index
+		return
+	}
+	if current := existing[key]; current != nil && current.ID != constant.LocalServerID {
+		item.Server.JumpServerID = current.ID
+		return
+	}
+	item.Action, item.Error = ImportError, "jump host "+item.Jump+" is neither in the inventory nor an existing server"
+}
+
+// hosts behind a failed or looping jump host fail too
+func (p *ServerImportPlan) checkJumps() {
+	for changed := true; changed; {
+		changed = false
+		for _, item := range p.Items {
+			if item.Action == ImportError || item.jumpIndex < 0 {
+				continue
+			}
+			jump := p.Items[item.jumpIndex]
+			if jump.Action == ImportError {
+				item.Action, item.Error = ImportError, "jump host "+jump.Alias+" cannot be imported"
+				changed = true
+			}
+		}
+	}
+	for i, item := range p.Items {
+		visited := map[int]bool{i: true}
+		for j := item.jumpIndex; j >= 0 && item.Action != ImportError; j = p.Items[j].jumpIndex {
+			if visited[j] {
+				item.Action, item.Error = ImportError, "jump hosts form a loop"
+			}
+			visited[j] = true
+		}
+	}
+}
+
+// compute changes of updates, updates without changes become unchanged
+func (p *ServerImportPlan) markUnchanged(servers []model.ServerModel) {
+	existing := make(map[uint]*model.ServerModel, len(servers))
+	for i := range servers {
+		existing[servers[i].ID] = &servers[i]
+	}
+	for _, item := range p.Items {
+		if item.Action != ImportUpdate {
+			continue
+		}
+		server := *item.Server
+		jumpCreated := false
+		if item.jumpIndex >= 0 {
+			jump := p.Items[item.jumpIndex]
+			server.JumpServerID = jump.Server.ID
+			jumpCreated = jump.Action == ImportCreate
+		}
+		item.Changes = serverChanges(&server, existing[server.ID])
+		if jumpCreated && !slices.Contains(item.Changes, "jump_server_id") {
+			item.Changes = append(item.Changes, "jump_server_id")
+		}
+		if len(item.Changes) == 0 {
+			item.Action = ImportUnchanged
+		}
+	}
+}
+
+// fields of saved row that server changes, secrets are compared decrypted
+func serverChanges(server *model.ServerModel, current *model.ServerModel) []string {
+	if current == nil {
+		return nil
+	}
+	var changes []string
+	for _, field := range []struct {
+		name    string
+		changed bool
+	}{
+		{"ip", server.IP != current.IP},
+		{"port", server.Port != current.Port},
+		{"user", server.User != current.User},
+		{"auth_method", server.AuthMethod != current.AuthMethod},
+		{"credential", server.Credential != current.Credential},
+		{"password", secretChanged(server.Password, current.Password)},
+		{"jump_server_id", server.JumpServerID != current.JumpServerID},
+		{"ssh_key_id", server.SSHKeyID != current.SSHKeyID},
+		{"certificate", server.Certificate != current.Certificate},
+		{"become_method", server.BecomeMethod != current.BecomeMethod},
+		{"become_password", secretChanged(server.BecomePassword, current.BecomePassword)},
+		{"labels", !maps.Equal(server.Labels, current.Labels) && len(server.Labels)+len(current.Labels) > 0},
+	} {
+		if field.changed {
+			changes = append(changes, field.name)
+		}
+	}
+	return changes
+}
+
+// value differs from saved secret, either may be encrypted
+func secretChanged(value string, saved string) bool {
+	if value == saved {
+		return false
+	}
+	plain, err := util.DecryptSecret(value)
+	if err != nil {
+		return true
+	}
+	savedPlain, err := util.DecryptSecret(saved)
+	return err != nil || plain != savedPlain
+}
+
+// ApplyServerImport save created and updated servers in one transaction, jump servers first,
+// nothing is saved if the plan has errors unless skipErrors is set
+func ApplyServerImport(plan *ServerImportPlan, skipErrors bool) error {
+	if errors := plan.Count(ImportError); errors > 0 && !skipErrors {
+		return fmt.Errorf("%d hosts cannot be imported, fix them or skip them", errors)
+	}
+
+	servers, jumpIndex, _ := plan.ordered()
+	return model.ImportServers(servers, jumpIndex)
+}
+
+// created and updated servers ordered by depth of the jump chain inside the import, jumpIndex[i] is the
+// position of the jump server of servers[i] if it is saved too, position maps items to their place
+func (p *ServerImportPlan) ordered() (servers []*model.ServerModel, jumpIndex []int, position map[*ServerImportItem]int) {
+	depth := func(item *ServerImportItem) int {
+		d := 0
+		for j := item.jumpIndex; j >= 0; j = p.Items[j].jumpIndex {
+			d++
+		}
+		return d
+	}
+	var items []*ServerImportItem
+	for d := 0; len(items) < p.Count(ImportCreate)+p.Count(ImportUpdate); d++ {
+		for _, item := range p.Items {
+			if (item.Action == ImportCreate || item.Action == ImportUpdate) && depth(item) == d {
+				items = append(items, item)
+			}
+		}
+	}
+
+	position = make(map[*ServerImportItem]int, len(items))
+	servers = make([]*model.ServerModel, 0, len(items))
+	jumpIndex = make([]int, 0, len(items))
+	for i, item := range items {
+		position[item] = i
+		servers = append(servers, item.Server)
+		index := -1
+		if item.jumpIndex >= 0 {
+			jump := p.Items[item.jumpIndex]
+			if j, ok := position[jump]; ok {
+				index = j
+			} else {
+				// unchanged jump server, it exists already
+				item.Server.JumpServerID = jump.Server.ID
+			}
+		}
+		jumpIndex = append(jumpIndex, index)
+	}
+	return servers, jumpIndex, position
+}
+
+// ConnectImportedServers connect created and updated servers of an applied plan, jump servers first
+func ConnectImportedServers(plan *ServerImportPlan) {
+	configs := make([]*pkg.ServerConfig, 0, len(plan.Items))
+	for _, item := range plan.Items {
+		if item.Action != ImportCreate && item.Action != ImportUpdate {
+			continue
+		}
+		if item.Server.ID == constant.LocalServerID {
+			// the local server never connects, only its labels are imported
+			pkg.LocalServer.Labels = item.Server.Labels
+			continue
+		}
+		if item.Action == ImportUpdate {
+			pkg.GetConnectionPool().RemoveServerFromConnectionPoolByID(item.Server.ID)
+		}
+		config, err := NewServerConfig(item.Server)
+		if err != nil {
+			logs.Logger.Error("NewServerConfig failed", zap.String("server_id", strconv.Itoa(int(item.Server.ID))), zap.Error(err))
+			continue
+		}
+		configs = append(configs, config)
+	}
+	pkg.GetConnectionPool().ConnectServers(configs)
+}
+
+type serverImportItemVo struct {
+	Alias        string                `json:"alias"`
+	Line         int                   `json:"line,omitempty"`
+	Action       string                `json:"action"` // create, update, unchanged or error
+	Error        string                `json:"error,omitempty"`
+	Changes      []string              `json:"changes,omitempty"`   // fields an update changes
+	ServerID     uint                  `json:"server_id,omitempty"` // existing server, or the created one after apply
+	IP           string                `json:"ip,omitempty"`
+	Port         int                   `json:"port,omitempty"`
+	User         string                `json:"user,omitempty"`
+	AuthMethod   constant.AuthMethod   `json:"auth_method,omitempty"`
+	Credential   string                `json:"credential,omitempty"`
+	BecomeMethod constant.BecomeMethod `json:"become_method,omitempty"`
+	Jump         string                `json:"jump,omitempty"`
+	Labels       map[string]string     `json:"labels,omitempty"`
+}
+
+func newServerImportItemVo(item *ServerImportItem) serverImportItemVo {
+	vo := serverImportItemVo{
+		Alias:   item.Alias,
+		Line:    item.Line,
+		Action:  item.Action,
+		Error:   item.Error,
+		Changes: item.Changes,
+		Jump:    item.Jump,
+	}
+	if item.Server != nil {
+		vo.ServerID = item.Server.ID
+		vo.IP = item.Server.IP
+		vo.Port = item.Server.Port
+		vo.User = item.Server.User
+		vo.AuthMethod = item.Server.AuthMethod
+		vo.Credential = item.Server.Credential
+		vo.BecomeMethod = item.Server.BecomeMethod
+		vo.Labels = item.Server.Labels
+	}
+	return vo
+}
+
+// ImportServersFunc import servers from an OpenSSH client config or an Ansible INI or YAML inventory,
+// without apply only the preview is returned, with apply the servers are saved and then connected in the background
+func ImportServersFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Format      string            `json:"format"` // ssh_config, ansible_ini, ansible_yaml, empty detects it
+			Content     string            `json:"content" binding:"required"`
+			DefaultUser string            `json:"default_user"`
+			DefaultPort int               `json:"default_port"`
+			Labels      map[string]string `json:"labels"`
+			Apply       bool              `json:"apply"`
+			SkipErrors  bool              `json:"skip_errors"` // apply the valid hosts of a plan with errors
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		plan, err := PlanServerImport(req.Format, req.Content, ServerImportOptions{
+			DefaultUser: req.DefaultUser,
+			DefaultPort: req.DefaultPort,
+			Labels:      req.Labels,
+		})
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+		if req.Apply {
+			if err := ApplyServerImport(plan, req.SkipErrors); err != nil {
+				response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+				logs.Logger.Error("server import failed: ", zap.Error(err))
+				return
+			}
+			username, _ := c.Get("username")
+			logs.Logger.Info("servers imported",
+				zap.Any("username", username),
+				zap.String("format", plan.Format),
+				zap.Int("created", plan.Count(ImportCreate)),
+				zap.Int("updated", plan.Count(ImportUpdate)))
+			// connection status is pushed over /api/ws as usual
+			go ConnectImportedServers(plan)
+		}
+
+		items := make([]serverImportItemVo, 0, len(plan.Items))
+		for _, item := range plan.Items {
+			items = append(items, newServerImportItemVo(item))
+		}
+		response.Success(c, gin.H{
+			"format":    plan.Format,
+			"applied":   req.Apply,
+			"create":    plan.Count(ImportCreate),
+			"update":    plan.Count(ImportUpdate),
+			"unchanged": plan.Count(ImportUnchanged),
+			"errors":    plan.Count(ImportError),
+			"items":     items,
+		})
+	}
+}
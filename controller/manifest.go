@@ -0,0 +1,361 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/model"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// ImportDelete action of records a reconcile deletes because no manifest describes them
+const ImportDelete = "delete"
+
+// wait for files to settle before reconciling, a git pull writes many files
+const manifestDebounce = 2 * time.Second
+
+// ReconcilePlan import plan of the manifests plus the records missing from them
+type ReconcilePlan struct {
+	*ConfigImportPlan
+	Files         []string
+	DeleteServers []model.ServerModel // ordered so servers behind a jump server go before it
+	DeleteApps    []model.AppModel
+	doc           *ConfigExport
+}
+
+// Count number of servers and apps with action, deletes included
+func (p *ReconcilePlan) Count(action string) int {
+	if action == ImportDelete {
+		return len(p.DeleteServers) + len(p.DeleteApps)
+	}
+	return p.ConfigImportPlan.Count(action)
+}
+
+// LoadManifests read every .yaml and .yml file under dir, hidden files and directories are skipped,
+// each file uses the export document format and the files are merged, so ids must be unique across files
+func LoadManifests(dir string) (*ConfigExport, []string, error) {
+	doc := &ConfigExport{Version: ConfigExportVersion}
+	var files []string
+	err := pkg.WalkTree(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() || (filepath.Ext(path) != ".yaml" && filepath.Ext(path) != ".yml") {
+			return nil
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		manifest, err := ParseConfigExport(ExportYAML, content)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		doc.Servers = append(doc.Servers, manifest.Servers...)
+		doc.Apps = append(doc.Apps, manifest.Apps...)
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	// an empty directory, such as a failed checkout, must not prune everything
+	if len(files) == 0 {
+		return nil, nil, fmt.Errorf("no manifests in %s", dir)
+	}
+	return doc, files, nil
+}
+
+// PlanReconcile plan to bring the database in line with the manifests, with prune servers and apps
+// missing from the manifests are deleted, a server whose address changes is deleted and created again
+func PlanReconcile(doc *ConfigExport, prune bool) (*ReconcilePlan, error) {
+	importPlan, err := PlanConfigImport(doc)
+	if err != nil {
+		return nil, err
+	}
+	plan := &ReconcilePlan{ConfigImportPlan: importPlan, doc: doc}
+	if !prune {
+		return plan, nil
+	}
+
+	keepServers := map[uint]bool{constant.LocalServerID: true}
+	for _, item := range importPlan.Servers.Items {
+		if item.Server != nil && item.Server.ID != 0 {
+			keepServers[item.Server.ID] = true
+		}
+	}
+	keepApps := make(map[uint]bool)
+	for _, item := range importPlan.Apps {
+		if item.App != nil && item.App.ID != 0 {
+			keepApps[item.App.ID] = true
+		}
+	}
+
+	servers, err := model.GetServerList()
+	if err != nil {
+		return nil, err
+	}
+	deleting := make(map[uint]*model.ServerModel)
+	for i := range servers {
+		if !keepServers[servers[i].ID] {
+			deleting[servers[i].ID] = &servers[i]
+		}
+	}
+	// servers deeper in a jump chain first, the jump server cannot be deleted while it is in use
+	depth := func(server *model.ServerModel) int {
+		d := 0
+		for id := server.JumpServerID; deleting[id] != nil && d < len(deleting); id = deleting[id].JumpServerID {
+			d++
+		}
+		return d
+	}
+	for _, server := range deleting {
+		plan.DeleteServers = append(plan.DeleteServers, *server)
+	}
+	slices.SortFunc(plan.DeleteServers, func(a, b model.ServerModel) int {
+		if d := depth(&b) - depth(&a); d != 0 {
+			return d
+		}
+		return int(a.ID) - int(b.ID)
+	})
+
+	apps, err := model.GetAppList()
+	if err != nil {
+		return nil, err
+	}
+	for _, app := range apps {
+		if !keepApps[app.ID] {
+			plan.DeleteApps = append(plan.DeleteApps, app)
+		}
+	}
+	return plan, nil
+}
+
+// ApplyReconcile save creates and updates in one transaction, then delete apps and servers through the same
+// path as their delete handlers, with start the changed servers are reconnected and the changed apps rechecked
+func ApplyReconcile(plan *ReconcilePlan, start bool) error {
+	if err := ApplyConfigImport(plan.ConfigImportPlan); err != nil {
+		return err
+	}
+	var failed []string
+	for i := range plan.DeleteApps {
+		app := &plan.DeleteApps[i]
+		pkg.GetAppCheckerManager().RemoveAppCheckerByID(app.ID)
+		if err := app.DeleteApp(); err != nil {
+			logs.Logger.Error("delete app error: ", zap.String("app_id", strconv.Itoa(int(app.ID))), zap.Error(err))
+			failed = append(failed, "app "+app.Name)
+		}
+	}
+	for i := range plan.DeleteServers {
+		server := &plan.DeleteServers[i]
+		if err := deleteServer(server); err != nil {
+			logs.Logger.Error("server delete failed: ", zap.String("server_id", strconv.Itoa(int(server.ID))), zap.Error(err))
+			failed = append(failed, "server "+importKey(server.IP, server.Port))
+		}
+	}
+	if start {
+		go StartImportedConfig(plan.ConfigImportPlan)
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("delete failed: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// result of the last reconcile that was not a dry run
+type manifestStatus struct {
+	mutex     sync.Mutex
+	running   sync.Mutex // one reconcile at a time
+	lastRun   time.Time
+	lastError string
+	plan      *ReconcilePlan
+}
+
+var manifests = &manifestStatus{}
+
+func manifestsEnabled() bool {
+	return viper.GetBool("Manifest.Enabled")
+}
+
+// ReconcileManifests load, plan and, unless dryRun, apply the manifests of the configured directory
+func ReconcileManifests(dryRun bool) (*ReconcilePlan, error) {
+	return reconcileManifests(dryRun, true)
+}
+
+func reconcileManifests(dryRun bool, start bool) (*ReconcilePlan, error) {
+	manifests.running.Lock()
+	defer manifests.running.Unlock()
+
+	plan, err := func() (*ReconcilePlan, error) {
+		doc, files, err := LoadManifests(viper.GetString("Manifest.Dir"))
+		if err != nil {
+			return nil, err
+		}
+		plan, err := PlanReconcile(doc, viper.GetBool("Manifest.Prune"))
+		if err != nil {
+			return nil, err
+		}
+		plan.Files = files
+		if dryRun {
+			return plan, nil
+		}
+		return plan, ApplyReconcile(plan, start)
+	}()
+	if dryRun {
+		return plan, err
+	}
+
+	manifests.mutex.Lock()
+	manifests.lastRun = time.Now()
+	manifests.lastError = ""
+	if err != nil {
+		manifests.lastError = err.Error()
+	}
+	manifests.plan = plan
+	manifests.mutex.Unlock()
+
+	if err != nil {
+		logs.Logger.Error("reconcile manifests failed", zap.Error(err))
+	} else if changes := plan.Count(ImportCreate) + plan.Count(ImportUpdate) + plan.Count(ImportDelete); changes > 0 {
+		logs.Logger.Info("manifests reconciled",
+			zap.Int("created", plan.Count(ImportCreate)),
+			zap.Int("updated", plan.Count(ImportUpdate)),
+			zap.Int("deleted", plan.Count(ImportDelete)))
+	}
+	return plan, err
+}
+
+// StartManifestReconciler reconcile the manifests once without starting anything, called at startup before
+// servers and apps are loaded, then reconcile again whenever files change and every Manifest.Interval seconds
+func StartManifestReconciler() {
+	if !manifestsEnabled() {
+		return
+	}
+	dir := viper.GetString("Manifest.Dir")
+	// a failed startup reconcile keeps the database as it is, servers and apps still start
+	reconcileManifests(false, false)
+
+	go func() {
+		if err := pkg.WatchDirectory(context.Background(), dir, manifestDebounce, func() {
+			ReconcileManifests(false)
+		}); err != nil {
+			logs.Logger.Error("watch manifest directory failed", zap.String("dir", dir), zap.Error(err))
+		}
+	}()
+	// periodic reconcile reverts changes made through the API
+	if interval := viper.GetInt("Manifest.Interval"); interval > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(interval) * time.Second)
+			defer ticker.Stop()
+			for range ticker.C {
+				ReconcileManifests(false)
+			}
+		}()
+	}
+}
+
+type manifestStatusVo struct {
+	Enabled   bool                 `json:"enabled"`
+	Dir       string               `json:"dir"`
+	Prune     bool                 `json:"prune"`
+	LastRun   *time.Time           `json:"last_run,omitempty"`
+	Error     string               `json:"error,omitempty"`
+	Files     []string             `json:"files"`
+	Create    int                  `json:"create"`
+	Update    int                  `json:"update"`
+	Delete    int                  `json:"delete"`
+	Unchanged int                  `json:"unchanged"`
+	Errors    int                  `json:"errors"`
+	Items     []configImportItemVo `json:"items"`
+}
+
+func newManifestStatusVo(plan *ReconcilePlan, lastRun time.Time, lastError string) manifestStatusVo {
+	vo := manifestStatusVo{
+		Enabled: manifestsEnabled(),
+		Dir:     viper.GetString("Manifest.Dir"),
+		Prune:   viper.GetBool("Manifest.Prune"),
+		Error:   lastError,
+		Files:   []string{},
+		Items:   []configImportItemVo{},
+	}
+	if !lastRun.IsZero() {
+		vo.LastRun = &lastRun
+	}
+	if plan == nil {
+		return vo
+	}
+	vo.Files = plan.Files
+	vo.Create = plan.Count(ImportCreate)
+	vo.Update = plan.Count(ImportUpdate)
+	vo.Delete = plan.Count(ImportDelete)
+	vo.Unchanged = plan.Count(ImportUnchanged)
+	vo.Errors = plan.Count(ImportError)
+	vo.Items = newConfigImportItemVos(plan.ConfigImportPlan, plan.doc)
+	for _, server := range plan.DeleteServers {
+		vo.Items = append(vo.Items, configImportItemVo{Kind: "server", Name: importKey(server.IP, server.Port), Action: ImportDelete, TargetID: server.ID})
+	}
+	for _, app := range plan.DeleteApps {
+		vo.Items = append(vo.Items, configImportItemVo{Kind: "app", Name: app.Name, Action: ImportDelete, TargetID: app.ID})
+	}
+	return vo
+}
+
+// GetManifestStatusFunc result of the last reconcile
+func GetManifestStatusFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		manifests.mutex.Lock()
+		vo := newManifestStatusVo(manifests.plan, manifests.lastRun, manifests.lastError)
+		manifests.mutex.Unlock()
+		response.Success(c, gin.H{"status": vo})
+	}
+}
+
+// ReconcileManifestsFunc reconcile now instead of waiting for a file change, dry_run only reports the plan
+func ReconcileManifestsFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			DryRun bool `json:"dry_run"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+		if !manifestsEnabled() {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "manifests are not enabled")
+			return
+		}
+
+		plan, err := ReconcileManifests(req.DryRun)
+		if err != nil && plan == nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+		lastError := ""
+		if err != nil {
+			lastError = err.Error()
+		}
+		response.Success(c, gin.H{"dry_run": req.DryRun, "status": newManifestStatusVo(plan, time.Now(), lastError)})
+	}
+}
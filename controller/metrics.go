@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/model"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+// at most this many points per series are returned, longer ranges are averaged into wider steps
+const maxSeriesPoints = 500
+
+// SaveMetricSample persist sample, used as the sample handler of the metrics collector
+func SaveMetricSample(sample *pkg.MetricSample) {
+	points := make([]model.MetricPointModel, 0, len(sample.Points))
+	for _, point := range sample.Points {
+		points = append(points, model.MetricPointModel{
+			ServerID: sample.ServerID,
+			Name:     point.Name,
+			Labels:   pkg.FormatLabels(point.Labels),
+			Time:     sample.Time,
+			Value:    point.Value,
+		})
+	}
+	if err := model.CreateMetricPoints(points); err != nil {
+		logs.Logger.Error("CreateMetricPoints failed", zap.String("server_id", strconv.Itoa(int(sample.ServerID))), zap.Error(err))
+	}
+}
+
+type metricSeriesVo struct {
+	Name   string          `json:"name"`
+	Labels string          `json:"labels"` // such as mount="/"
+	Points []metricPointVo `json:"points"`
+}
+
+type metricPointVo struct {
+	Time  time.Time `json:"time"` // start of the step
+	Value float64   `json:"value"`
+}
+
+// average points of one series into steps, points are ordered by time
+func stepPoints(points []model.MetricPointModel, since time.Time, step time.Duration) []metricPointVo {
+	result := make([]metricPointVo, 0)
+	var sum float64
+	var count int
+	var current time.Time
+	for _, point := range points {
+		bucket := since.Add(point.Time.Sub(since).Truncate(step))
+		if count > 0 && !bucket.Equal(current) {
+			result = append(result, metricPointVo{Time: current, Value: sum / float64(count)})
+			sum, count = 0, 0
+		}
+		current = bucket
+		sum += point.Value
+		count++
+	}
+	if count > 0 {
+		result = append(result, metricPointVo{Time: current, Value: sum / float64(count)})
+	}
+	return result
+}
+
+// GetServerMetricsFunc metric series of server in a time range for charts,
+// since and until are RFC3339 times, default is the last hour; names filters metrics, empty means all;
+// step is in seconds, default fits the range into maxSeriesPoints points
+func GetServerMetricsFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID    uint      `json:"id" binding:"required"`
+			Names []string  `json:"names"`
+			Since time.Time `json:"since"`
+			Until time.Time `json:"until"`
+			Step  int       `json:"step"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+		if req.Until.IsZero() || req.Until.After(time.Now()) {
+			req.Until = time.Now()
+		}
+		if req.Since.IsZero() {
+			req.Since = req.Until.Add(-time.Hour)
+		}
+		if !req.Since.Before(req.Until) {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "since must be before until")
+			return
+		}
+		step := time.Duration(req.Step) * time.Second
+		if minStep := req.Until.Sub(req.Since) / maxSeriesPoints; step < minStep {
+			step = minStep
+		}
+		step = max(step, time.Second)
+
+		server := &model.ServerModel{Model: gorm.Model{ID: req.ID}}
+		if !server.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not exists")
+			return
+		}
+
+		points, err := model.GetMetricPoints(req.ID, req.Names, req.Since, req.Until)
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "get metrics failed")
+			logs.Logger.Error("get metrics failed: ", zap.Error(err))
+			return
+		}
+
+		series := make([]metricSeriesVo, 0)
+		for start := 0; start < len(points); {
+			end := start
+			for end < len(points) && points[end].Name == points[start].Name && points[end].Labels == points[start].Labels {
+				end++
+			}
+			series = append(series, metricSeriesVo{
+				Name:   points[start].Name,
+				Labels: points[start].Labels,
+				Points: stepPoints(points[start:end], req.Since, step),
+			})
+			start = end
+		}
+		response.Success(c, gin.H{
+			"since":  req.Since,
+			"until":  req.Until,
+			"step":   int(step.Seconds()),
+			"series": series,
+		})
+	}
+}
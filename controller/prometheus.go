@@ -0,0 +1,231 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/pkg"
+	"GolangOM/ws"
+	"fmt"
+	"maps"
+	"net/http"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// prefix of the metrics exported by this program
+const promNamespace = "golangom_"
+
+var processStartTime = time.Now()
+
+var serverStatuses = []constant.ConnectStatus{constant.Connected, constant.Disconnected, constant.Connecting, constant.Idle}
+
+// promWriter writes the Prometheus text exposition format, samples of one metric must be written together
+type promWriter struct {
+	builder strings.Builder
+	current string
+}
+
+// metric starts a metric family with its help text and type (gauge or counter)
+func (w *promWriter) metric(name string, metricType string, help string) {
+	w.current = name
+	fmt.Fprintf(&w.builder, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+}
+
+// sample one value of the current metric, labels are name value pairs
+func (w *promWriter) sample(value float64, labels ...string) {
+	w.builder.WriteString(w.current)
+	if len(labels) > 0 {
+		w.builder.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				w.builder.WriteByte(',')
+			}
+			w.builder.WriteString(labels[i])
+			w.builder.WriteString(`="`)
+			w.builder.WriteString(promLabelEscaper.Replace(labels[i+1]))
+			w.builder.WriteByte('"')
+		}
+		w.builder.WriteByte('}')
+	}
+	w.builder.WriteByte(' ')
+	w.builder.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	w.builder.WriteByte('\n')
+}
+
+var promLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func promBool(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// seconds since t, -1 if it never happened
+func promAge(t time.Time, now time.Time) float64 {
+	if t.IsZero() {
+		return -1
+	}
+	return now.Sub(t).Seconds()
+}
+
+func promID(v uint) string {
+	return strconv.Itoa(int(v))
+}
+
+// PrometheusMetricsFunc servers, apps, host resource metrics and internals in the Prometheus text format
+func PrometheusMetricsFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		w := &promWriter{}
+		now := time.Now()
+		servers := pkg.GetConnectionPool().GetServers()
+		slices.SortFunc(servers, func(a, b *pkg.Server) int { return int(a.ID) - int(b.ID) })
+
+		writeServerMetrics(w, servers, now)
+		writeAppMetrics(w, now)
+		writeHostMetrics(w, servers)
+		writeInternalMetrics(w)
+
+		c.Data(http.StatusOK, "text/plain; version=0.0.4; charset=utf-8", []byte(w.builder.String()))
+	}
+}
+
+func writeServerMetrics(w *promWriter, servers []*pkg.Server, now time.Time) {
+	w.metric(promNamespace+"server_up", "gauge", "Whether the server is connected, the local server is always up.")
+	for _, server := range servers {
+		w.sample(promBool(server.Status == constant.Connected), "server_id", promID(server.ID), "address", server.IP)
+	}
+
+	w.metric(promNamespace+"server_status", "gauge", "Connection status of the server, 1 for the current status.")
+	for _, server := range servers {
+		for _, status := range serverStatuses {
+			w.sample(promBool(server.Status == status), "server_id", promID(server.ID), "status", string(status))
+		}
+	}
+
+	w.metric(promNamespace+"server_last_check_age_seconds", "gauge", "Seconds since the last connection check of the server, -1 if never checked.")
+	for _, server := range servers {
+		w.sample(promAge(server.LastCheckTime, now), "server_id", promID(server.ID))
+	}
+
+	stats := make([]pkg.SessionStats, len(servers))
+	for i, server := range servers {
+		stats[i] = server.SessionStats()
+	}
+	w.metric(promNamespace+"server_sessions_in_use", "gauge", "SSH sessions open on the server.")
+	for i, server := range servers {
+		w.sample(float64(stats[i].InUse), "server_id", promID(server.ID))
+	}
+	w.metric(promNamespace+"server_sessions_waiting", "gauge", "Callers waiting for a free SSH session of the server.")
+	for i, server := range servers {
+		w.sample(float64(stats[i].Waiting), "server_id", promID(server.ID))
+	}
+	w.metric(promNamespace+"server_sessions_acquired_total", "counter", "SSH sessions opened on the server.")
+	for i, server := range servers {
+		w.sample(float64(stats[i].Acquired), "server_id", promID(server.ID))
+	}
+	w.metric(promNamespace+"server_session_wait_timeouts_total", "counter", "Callers that gave up waiting for a free SSH session of the server.")
+	for i, server := range servers {
+		w.sample(float64(stats[i].Timeouts), "server_id", promID(server.ID))
+	}
+	w.metric(promNamespace+"server_session_wait_seconds_total", "counter", "Time spent waiting for free SSH sessions of the server.")
+	for i, server := range servers {
+		w.sample(stats[i].TotalWait.Seconds(), "server_id", promID(server.ID))
+	}
+}
+
+func writeAppMetrics(w *promWriter, now time.Time) {
+	apps := pkg.GetAppCheckerManager().GetAppCheckers()
+	slices.SortFunc(apps, func(a, b *pkg.AppCheckConfig) int { return int(a.ID) - int(b.ID) })
+	labels := func(app *pkg.AppCheckConfig) []string {
+		return []string{"app_id", promID(app.ID), "app", app.Name, "server_id", promID(app.ServerID)}
+	}
+
+	w.metric(promNamespace+"app_up", "gauge", "Whether the last check found the app running.")
+	for _, app := range apps {
+		w.sample(promBool(app.LastCheckResult), labels(app)...)
+	}
+	w.metric(promNamespace+"app_check_duration_seconds", "gauge", "Time the last check of the app took.")
+	for _, app := range apps {
+		w.sample(app.CheckDuration.Seconds(), labels(app)...)
+	}
+	w.metric(promNamespace+"app_last_check_age_seconds", "gauge", "Seconds since the last check of the app, -1 if never checked.")
+	for _, app := range apps {
+		w.sample(promAge(app.LastCheckTime, now), labels(app)...)
+	}
+	w.metric(promNamespace+"app_restarts_total", "counter", "Auto restarts of the app since its checker started.")
+	for _, app := range apps {
+		w.sample(float64(app.RestartCount), labels(app)...)
+	}
+	w.metric(promNamespace+"app_restart_failures_total", "counter", "Auto restarts of the app whose start script failed.")
+	for _, app := range apps {
+		w.sample(float64(app.RestartFailures), labels(app)...)
+	}
+}
+
+// latest resource sample of every server, one metric family per resource metric
+func writeHostMetrics(w *promWriter, servers []*pkg.Server) {
+	type hostPoint struct {
+		serverID uint
+		point    pkg.MetricPoint
+	}
+	families := make(map[string][]hostPoint)
+	for _, server := range servers {
+		sample := pkg.GetMetricsCollector().LatestSample(server.ID)
+		if sample == nil {
+			continue
+		}
+		for _, point := range sample.Points {
+			families[point.Name] = append(families[point.Name], hostPoint{server.ID, point})
+		}
+	}
+
+	for _, name := range slices.Sorted(maps.Keys(families)) {
+		w.metric(promNamespace+"host_"+name, "gauge", "Resource metric "+name+" of the latest sample.")
+		for _, hp := range families[name] {
+			labels := []string{"server_id", promID(hp.serverID)}
+			for _, label := range slices.Sorted(maps.Keys(hp.point.Labels)) {
+				labels = append(labels, label, hp.point.Labels[label])
+			}
+			w.sample(hp.point.Value, labels...)
+		}
+	}
+}
+
+func writeInternalMetrics(w *promWriter) {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	w.metric("go_goroutines", "gauge", "Number of goroutines that currently exist.")
+	w.sample(float64(runtime.NumGoroutine()))
+	w.metric("go_memstats_alloc_bytes", "gauge", "Number of bytes allocated and still in use.")
+	w.sample(float64(memStats.Alloc))
+	w.metric("go_memstats_sys_bytes", "gauge", "Number of bytes obtained from system.")
+	w.sample(float64(memStats.Sys))
+	w.metric("process_start_time_seconds", "gauge", "Start time of the process since unix epoch in seconds.")
+	w.sample(float64(processStartTime.Unix()))
+
+	pool := pkg.GetConnectionPool().Stats()
+	w.metric(promNamespace+"pool_servers", "gauge", "Servers in the connection pool, without the local server.")
+	w.sample(float64(pool.Servers))
+	w.metric(promNamespace+"pool_open_connections", "gauge", "Open SSH connections of the pool.")
+	w.sample(float64(pool.OpenConnections))
+	w.metric(promNamespace+"pool_max_connections", "gauge", "Connection limit of the pool.")
+	w.sample(float64(pool.MaxConnections))
+	w.metric(promNamespace+"pool_lazy_mode", "gauge", "Whether connections are opened on demand.")
+	w.sample(promBool(pool.Lazy))
+
+	w.metric(promNamespace+"websocket_clients", "gauge", "Connected WebSocket clients.")
+	w.sample(float64(ws.ClientCount()))
+	w.metric(promNamespace+"app_checkers", "gauge", "Running app checkers.")
+	w.sample(float64(len(pkg.GetAppCheckerManager().GetAppCheckers())))
+
+	firing := pkg.GetAlertManager().FiringCount()
+	w.metric(promNamespace+"alerts_firing", "gauge", "Firing resource alerts by rule.")
+	for _, rule := range slices.Sorted(maps.Keys(firing)) {
+		w.sample(float64(firing[rule]), "rule", rule)
+	}
+}
@@ -6,7 +6,11 @@ import (
 	"GolangOM/model"
 	"GolangOM/pkg"
 	"GolangOM/response"
+	"GolangOM/util"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -15,29 +19,252 @@ import (
 )
 
 type serverVo struct {
-	ID          uint                   `json:"id"`
-	AuthMethod  constant.AuthMethod    `json:"auth_method"`
-	IP          string                 `json:"ip"`
-	Port        int                    `json:"port"`
-	User        string                 `json:"user"`
-	CheckResult constant.ConnectStatus `json:"check_result"`
-	CheckTime   time.Time              `json:"check_time"`
+	ID                 uint                   `json:"id"`
+	AuthMethod         constant.AuthMethod    `json:"auth_method"`
+	IP                 string                 `json:"ip"`
+	Port               int                    `json:"port"`
+	User               string                 `json:"user"`
+	CheckResult        constant.ConnectStatus `json:"check_result"`
+	CheckTime          time.Time              `json:"check_time"`
+	HostKeyStatus      constant.HostKeyStatus `json:"host_key_status"`
+	HostKeyFingerprint string                 `json:"host_key_fingerprint"`
+	JumpServerID       uint                   `json:"jump_server_id"`
+	SSHKeyID           uint                   `json:"ssh_key_id"`
+	BecomeMethod       constant.BecomeMethod  `json:"become_method"`
+	JumpPath           []string               `json:"jump_path"` // ip:port of each hop, ending with the server itself
+	Certificate        *certificateVo         `json:"certificate,omitempty"`
+	LastError          string                 `json:"last_error"`    // why the last connect or keepalive failed
+	NextRetryAt        *time.Time             `json:"next_retry_at"` // next reconnect attempt, null when connected
+	Sessions           *sessionStatsVo        `json:"sessions,omitempty"`
+	Facts              *hostFactsVo           `json:"facts,omitempty"` // null until facts were collected once
+	Labels             map[string]string      `json:"labels"`
 }
 
+// SSH session usage of server, waits are in milliseconds
+type sessionStatsVo struct {
+	Limit     int    `json:"limit"`
+	InUse     int    `json:"in_use"`
+	Waiting   int    `json:"waiting"`
+	Acquired  uint64 `json:"acquired"`
+	Timeouts  uint64 `json:"timeouts"`
+	Rejected  uint64 `json:"rejected"`
+	AvgWaitMs int64  `json:"avg_wait_ms"`
+	MaxWaitMs int64  `json:"max_wait_ms"`
+}
+
+func newSessionStatsVo(stats pkg.SessionStats) *sessionStatsVo {
+	vo := &sessionStatsVo{
+		Limit:     stats.Limit,
+		InUse:     stats.InUse,
+		Waiting:   stats.Waiting,
+		Acquired:  stats.Acquired,
+		Timeouts:  stats.Timeouts,
+		Rejected:  stats.Rejected,
+		MaxWaitMs: stats.MaxWait.Milliseconds(),
+	}
+	if stats.Acquired > 0 {
+		vo.AvgWaitMs = (stats.TotalWait / time.Duration(stats.Acquired)).Milliseconds()
+	}
+	return vo
+}
+
+// user certificate of certificate authentication, reconnects fail once it expires
+type certificateVo struct {
+	KeyID      string     `json:"key_id"`
+	Principals []string   `json:"principals"`
+	ValidAfter time.Time  `json:"valid_after"`
+	ExpiresAt  *time.Time `json:"expires_at"` // null if the certificate never expires
+	Expired    bool       `json:"expired"`
+	Error      string     `json:"error,omitempty"` // certificate could not be loaded
+}
+
+func newCertificateVo(server *pkg.Server) *certificateVo {
+	info, err := server.CertificateInfo()
+	if err != nil {
+		return &certificateVo{Error: err.Error()}
+	}
+	if info == nil {
+		return nil
+	}
+	vo := &certificateVo{
+		KeyID:      info.KeyID,
+		Principals: info.Principals,
+		ValidAfter: info.ValidAfter,
+		Expired:    info.Expired,
+	}
+	if !info.ValidBefore.IsZero() {
+		vo.ExpiresAt = &info.ValidBefore
+	}
+	return vo
+}
+
+// build serverVo from pooled server, do not return sensitive information
+func newServerVo(server *pkg.Server) serverVo {
+	vo := serverVo{
+		ID:           server.ID,
+		AuthMethod:   server.AuthMethod,
+		IP:           server.IP,
+		Port:         server.Port,
+		User:         server.User,
+		CheckResult:  server.Status,
+		CheckTime:    server.LastCheckTime,
+		JumpServerID: server.JumpServerID,
+		SSHKeyID:     server.SSHKeyID,
+		BecomeMethod: server.BecomeMethod,
+		LastError:    server.LastError,
+		Labels:       server.Labels,
+	}
+	if vo.Labels == nil {
+		vo.Labels = map[string]string{}
+	}
+	if server.Status != constant.Connected && !server.NextRetryAt.IsZero() {
+		nextRetryAt := server.NextRetryAt
+		vo.NextRetryAt = &nextRetryAt
+	}
+	if server.ID == constant.LocalServerID {
+		return vo
+	}
+	vo.Sessions = newSessionStatsVo(server.SessionStats())
+	chain, err := pkg.GetConnectionPool().JumpServerChain(server.ID)
+	if err != nil {
+		logs.Logger.Error("get jump server chain failed: ", zap.Error(err))
+	}
+	for _, jumpServer := range chain {
+		vo.JumpPath = append(vo.JumpPath, jumpServer.Address())
+	}
+	vo.JumpPath = append(vo.JumpPath, server.Address())
+	vo.Certificate = newCertificateVo(server)
+
+	hostKey, err := pkg.GetHostKeyStore().GetHostKeyInfo(server.Address())
+	if err != nil {
+		logs.Logger.Error("get host key info failed: ", zap.Error(err))
+		return vo
+	}
+	vo.HostKeyStatus = hostKey.Status
+	vo.HostKeyFingerprint = hostKey.Fingerprint
+	if hostKey.PendingFingerprint != "" {
+		vo.HostKeyFingerprint = hostKey.PendingFingerprint
+	}
+	return vo
+}
+
+// check that the managed key referenced by server exists
+func checkServerSSHKey(server *model.ServerModel) bool {
+	if server.SSHKeyID == 0 {
+		return true
+	}
+	key := &model.SSHKeyModel{Model: gorm.Model{ID: server.SSHKeyID}}
+	return key.IsExists()
+}
+
+// NewServerConfig connection config of server record, credentials are decrypted here and only kept in memory
+func NewServerConfig(server *model.ServerModel) (*pkg.ServerConfig, error) {
+	password, err := util.DecryptSecret(server.Password)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt password of server %d failed: %w", server.ID, err)
+	}
+	becomePassword, err := util.DecryptSecret(server.BecomePassword)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt become password of server %d failed: %w", server.ID, err)
+	}
+	var privateKey string
+	usesKey := server.AuthMethod == constant.AuthMethodKey || server.AuthMethod == constant.AuthMethodCertificate
+	if usesKey && server.SSHKeyID != 0 {
+		key := &model.SSHKeyModel{Model: gorm.Model{ID: server.SSHKeyID}}
+		if !key.IsExists() {
+			return nil, fmt.Errorf("ssh key %d of server %d not exists", server.SSHKeyID, server.ID)
+		}
+		if privateKey, err = util.DecryptSecret(key.PrivateKey); err != nil {
+			return nil, fmt.Errorf("decrypt ssh key %d failed: %w", key.ID, err)
+		}
+	}
+	return &pkg.ServerConfig{
+		ID:             server.ID,
+		IP:             server.IP,
+		Port:           server.Port,
+		User:           server.User,
+		AuthMethod:     server.AuthMethod,
+		Credential:     server.Credential,
+		Password:       password,
+		PrivateKey:     privateKey,
+		Certificate:    server.Certificate,
+		BecomeMethod:   server.BecomeMethod,
+		BecomePassword: becomePassword,
+		SSHKeyID:       server.SSHKeyID,
+		JumpServerID:   server.JumpServerID,
+		Labels:         server.Labels,
+	}, nil
+}
+
+// respond server connection failure, host key problems get their own error code
+func failServerConnect(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, pkg.ErrHostKeyMismatch):
+		response.Fail(c, http.StatusInternalServerError, constant.HostKeyMismatch, err.Error())
+	case errors.Is(err, pkg.ErrHostKeyUnknown):
+		response.Fail(c, http.StatusInternalServerError, constant.HostKeyUntrusted, err.Error())
+	default:
+		response.Fail(c, http.StatusInternalServerError, constant.ServerConnectError, "server connect failed")
+	}
+	logs.Logger.Error("server connect failed: ", zap.Error(err))
+}
+
+// GetServerListFunc query parameters filter servers by host facts, see factsFilter,
+// by label selector such as ?selector=env=prod,role in (web,api) and by group with ?group_id=
 func GetServerListFunc() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		var filter factsFilter
+		var query struct {
+			Selector string `form:"selector"`
+			GroupID  uint   `form:"group_id"`
+		}
+		if err := c.ShouldBindQuery(&filter); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+		if err := c.ShouldBindQuery(&query); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+		selector, err := pkg.ParseLabelSelector(query.Selector)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+		var groupMemberIDs []uint
+		if query.GroupID != 0 {
+			group := &model.ServerGroupModel{Model: gorm.Model{ID: query.GroupID}}
+			if !group.IsExists() {
+				response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server group not exists")
+				return
+			}
+			if groupMemberIDs, err = groupMembers(group); err != nil {
+				response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+				return
+			}
+		}
+		factsMap, err := model.GetHostFactsMap()
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "get host facts failed")
+			logs.Logger.Error("get host facts failed: ", zap.Error(err))
+			return
+		}
+
 		servers := pkg.GetConnectionPool().GetServers()
 		result := make([]serverVo, 0, len(servers))
 		for _, server := range servers {
-			result = append(result, serverVo{
-				ID:          server.ID,
-				AuthMethod:  server.AuthMethod,
-				IP:          server.IP,
-				Port:        server.Port,
-				User:        server.User,
-				CheckResult: server.Status,
-				CheckTime:   server.LastCheckTime,
-			})
+			facts := factsMap[server.ID]
+			if !filter.match(facts) || !selector.Matches(server.Labels) {
+				continue
+			}
+			if query.GroupID != 0 && !slices.Contains(groupMemberIDs, server.ID) {
+				continue
+			}
+			vo := newServerVo(server)
+			vo.Facts = newHostFactsVo(facts)
+			result = append(result, vo)
 		}
 		response.Success(c, gin.H{"servers": result})
 	}
@@ -63,18 +290,18 @@ func GetServerFunc() gin.HandlerFunc {
 		}
 
 		serverInfo := pkg.GetConnectionPool().GetServerByID(req.ID)
-
-		result := serverVo{
-			ID:          serverInfo.ID,
-			AuthMethod:  serverInfo.AuthMethod,
-			IP:          serverInfo.IP,
-			Port:        serverInfo.Port,
-			User:        serverInfo.User,
-			CheckResult: serverInfo.Status, // do not return sensitive information
-			CheckTime:   serverInfo.LastCheckTime,
+		if serverInfo == nil {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not in connection pool")
+			return
 		}
 
-		response.Success(c, gin.H{"server": result})
+		vo := newServerVo(serverInfo)
+		facts, err := model.GetHostFacts(req.ID)
+		if err != nil {
+			logs.Logger.Error("get host facts failed: ", zap.Error(err))
+		}
+		vo.Facts = newHostFactsVo(facts)
+		response.Success(c, gin.H{"server": vo})
 	}
 }
 
@@ -88,28 +315,44 @@ func CreateServerFunc() gin.HandlerFunc {
 			return
 		}
 
+		if err := pkg.GetConnectionPool().CheckJumpServer(0, server.JumpServerID); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+
+		if !checkServerSSHKey(server) {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "ssh key not exists")
+			return
+		}
+
+		if server.BecomeMethod != "" && server.BecomeMethod != constant.BecomeSudo && server.BecomeMethod != constant.BecomeSu {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "become method must be sudo or su")
+			return
+		}
+
+		if err := pkg.ValidateLabels(server.Labels); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+
 		if err := server.CreateServer(); err != nil {
 			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "server create failed")
 			logs.Logger.Error("server create failed: ", zap.Error(err))
 			return
 		}
 
-		err := pkg.GetConnectionPool().NewConnection(&pkg.ServerConfig{
-			ID:         server.ID,
-			IP:         server.IP,
-			Port:       server.Port,
-			User:       server.User,
-			AuthMethod: server.AuthMethod,
-			Credential: server.Credential,
-			Password:   server.Password,
-		})
+		config, err := NewServerConfig(server)
 		if err != nil {
-			response.Fail(c, http.StatusInternalServerError, constant.ServerConnectError, "server connect failed")
-			logs.Logger.Error("server connect failed: ", zap.Error(err))
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "decrypt server credentials failed")
+			logs.Logger.Error("decrypt server credentials failed: ", zap.Error(err))
+			return
+		}
+		if err := pkg.GetConnectionPool().NewConnection(config); err != nil {
+			failServerConnect(c, err)
 			return
 		}
 
-		response.Success(c, gin.H{"server": server})
+		response.Success(c, gin.H{"server": newServerVo(pkg.GetConnectionPool().GetServerByID(server.ID))})
 	}
 }
 
@@ -130,6 +373,34 @@ func UpdateServerFunc() gin.HandlerFunc {
 			return
 		}
 
+		if err := pkg.GetConnectionPool().CheckJumpServer(server.ID, server.JumpServerID); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+
+		if !checkServerSSHKey(server) {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "ssh key not exists")
+			return
+		}
+
+		if server.BecomeMethod != "" && server.BecomeMethod != constant.BecomeSudo && server.BecomeMethod != constant.BecomeSu {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "become method must be sudo or su")
+			return
+		}
+
+		if err := pkg.ValidateLabels(server.Labels); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+
+		// secrets are never returned, so an empty password means unchanged
+		if server.Password == "" && server.AuthMethod == tmp.AuthMethod {
+			server.Password = tmp.Password
+		}
+		if server.BecomePassword == "" {
+			server.BecomePassword = tmp.BecomePassword
+		}
+
 		if err := server.UpdateServer(); err != nil {
 			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "server update failed")
 			logs.Logger.Error("server update failed: ", zap.Error(err))
@@ -138,21 +409,50 @@ func UpdateServerFunc() gin.HandlerFunc {
 
 		pkg.GetConnectionPool().RemoveServerFromConnectionPoolByID(server.ID)
 
-		if err := pkg.GetConnectionPool().NewConnection(&pkg.ServerConfig{
-			ID:         server.ID,
-			IP:         server.IP,
-			Port:       server.Port,
-			User:       server.User,
-			AuthMethod: server.AuthMethod,
-			Credential: server.Credential,
-			Password:   server.Password,
-		}); err != nil {
-			response.Fail(c, http.StatusInternalServerError, constant.ServerConnectError, "server connect failed")
-			logs.Logger.Error("server connect failed: ", zap.Error(err))
+		config, err := NewServerConfig(server)
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "decrypt server credentials failed")
+			logs.Logger.Error("decrypt server credentials failed: ", zap.Error(err))
 			return
 		}
-		response.Success(c, gin.H{"server": server})
+		if err := pkg.GetConnectionPool().NewConnection(config); err != nil {
+			failServerConnect(c, err)
+			return
+		}
+		response.Success(c, gin.H{"server": newServerVo(pkg.GetConnectionPool().GetServerByID(server.ID))})
+	}
+}
+
+// delete server with its history, metrics, alerts, group memberships and port forwards
+func deleteServer(server *model.ServerModel) error {
+	// remove from connection pool first
+	pkg.GetConnectionPool().RemoveServerFromConnectionPoolByID(server.ID)
+
+	// delete database record
+	if err := server.DeleteServer(); err != nil {
+		return err
 	}
+	if err := model.DeleteConnectionEvents(server.ID); err != nil {
+		logs.Logger.Error("delete connection history failed: ", zap.Error(err))
+	}
+	if err := model.DeleteHostFacts(server.ID); err != nil {
+		logs.Logger.Error("delete host facts failed: ", zap.Error(err))
+	}
+	if err := model.DeleteServerMetricPoints(server.ID); err != nil {
+		logs.Logger.Error("delete metrics failed: ", zap.Error(err))
+	}
+	pkg.GetAlertManager().Forget(server.ID)
+	if err := model.DeleteServerAlerts(server.ID); err != nil {
+		logs.Logger.Error("delete alerts failed: ", zap.Error(err))
+	}
+	if err := model.RemoveServerFromGroups(server.ID); err != nil {
+		logs.Logger.Error("remove server from groups failed: ", zap.Error(err))
+	}
+	pkg.GetForwardManager().StopServer(server.ID)
+	if err := model.DeleteServerForwards(server.ID); err != nil {
+		logs.Logger.Error("delete port forwards failed: ", zap.Error(err))
+	}
+	return nil
 }
 
 func DeleteServerFunc() gin.HandlerFunc {
@@ -179,11 +479,12 @@ func DeleteServerFunc() gin.HandlerFunc {
 			return
 		}
 
-		// remove from connection pool first
-		pkg.GetConnectionPool().RemoveServerFromConnectionPoolByID(req.ID)
+		if children := pkg.GetConnectionPool().GetJumpChildren(req.ID); len(children) > 0 {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "server is used as jump server by other servers")
+			return
+		}
 
-		// delete database record
-		if err := server.DeleteServer(); err != nil {
+		if err := deleteServer(server); err != nil {
 			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "server delete failed")
 			logs.Logger.Error("server delete failed: ", zap.Error(err))
 			return
@@ -192,3 +493,135 @@ func DeleteServerFunc() gin.HandlerFunc {
 		response.Success(c, gin.H{"message": "server deleted successfully"})
 	}
 }
+
+// ReconnectServerFunc reconnect server now instead of waiting for its backoff
+func ReconnectServerFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID uint `json:"id" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		if req.ID == constant.LocalServerID {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "local server is always connected")
+			return
+		}
+		if pkg.GetConnectionPool().GetServerByID(req.ID) == nil {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not exists")
+			return
+		}
+
+		if err := pkg.GetConnectionPool().ReconnectServerByID(req.ID); err != nil {
+			failServerConnect(c, err)
+			return
+		}
+		response.Success(c, gin.H{"server": newServerVo(pkg.GetConnectionPool().GetServerByID(req.ID))})
+	}
+}
+
+type connectionEventVo struct {
+	Status constant.ConnectStatus `json:"status"`
+	Reason string                 `json:"reason"`
+	Time   time.Time              `json:"time"`
+}
+
+// time connected in [since, until), initial is the status at since
+func connectedDuration(initial constant.ConnectStatus, events []model.ConnectionEventModel, since time.Time, until time.Time) time.Duration {
+	var connected time.Duration
+	status := initial
+	from := since
+	for _, event := range events {
+		if status == constant.Connected {
+			connected += event.Time.Sub(from)
+		}
+		status = event.Status
+		from = event.Time
+	}
+	if status == constant.Connected {
+		connected += until.Sub(from)
+	}
+	return connected
+}
+
+// GetServerHistoryFunc connectivity transitions and uptime of server in a time range,
+// since and until are RFC3339 times, default is the last 24 hours
+func GetServerHistoryFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID    uint      `json:"id" binding:"required"`
+			Since time.Time `json:"since"`
+			Until time.Time `json:"until"`
+		}
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+		if req.Until.IsZero() || req.Until.After(time.Now()) {
+			req.Until = time.Now()
+		}
+		if req.Since.IsZero() {
+			req.Since = req.Until.Add(-24 * time.Hour)
+		}
+		if !req.Since.Before(req.Until) {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "since must be before until")
+			return
+		}
+
+		server := &model.ServerModel{Model: gorm.Model{ID: req.ID}}
+		if !server.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not exists")
+			return
+		}
+
+		events, err := model.GetConnectionEvents(req.ID, req.Since, req.Until)
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "get connection history failed")
+			logs.Logger.Error("get connection history failed: ", zap.Error(err))
+			return
+		}
+		previous, err := model.GetLastConnectionEventBefore(req.ID, req.Since)
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "get connection history failed")
+			logs.Logger.Error("get connection history failed: ", zap.Error(err))
+			return
+		}
+
+		// time before the first known event is not counted
+		since := req.Since
+		initial := constant.Disconnected
+		if previous != nil {
+			initial = previous.Status
+		} else if len(events) > 0 {
+			since = events[0].Time
+		} else {
+			since = req.Until
+		}
+
+		result := make([]connectionEventVo, 0, len(events))
+		for _, event := range events {
+			result = append(result, connectionEventVo{Status: event.Status, Reason: event.Reason, Time: event.Time})
+		}
+		observed := req.Until.Sub(since)
+		connected := connectedDuration(initial, events, since, req.Until)
+		uptime := 0.0
+		if observed > 0 {
+			uptime = float64(connected) / float64(observed) * 100
+		}
+
+		response.Success(c, gin.H{
+			"events":            result,
+			"since":             req.Since,
+			"until":             req.Until,
+			"observed_seconds":  int64(observed.Seconds()),
+			"connected_seconds": int64(connected.Seconds()),
+			"uptime_percent":    uptime,
+		})
+	}
+}
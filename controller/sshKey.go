@@ -0,0 +1,228 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/model"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type sshKeyVo struct {
+	ID          uint      `json:"id"`
+	Name        string    `json:"name"`
+	KeyType     string    `json:"key_type"`
+	PublicKey   string    `json:"public_key"`
+	Fingerprint string    `json:"fingerprint"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+func newSSHKeyVo(key *model.SSHKeyModel) sshKeyVo {
+	return sshKeyVo{
+		ID:          key.ID,
+		Name:        key.Name,
+		KeyType:     key.KeyType,
+		PublicKey:   key.PublicKey,
+		Fingerprint: key.Fingerprint,
+		CreatedAt:   key.CreatedAt,
+	}
+}
+
+// save key pair, respond the created key
+func saveKeyPair(c *gin.Context, name string, keyPair *pkg.KeyPair) {
+	key := &model.SSHKeyModel{
+		Name:        name,
+		KeyType:     keyPair.KeyType,
+		PublicKey:   keyPair.PublicKey,
+		Fingerprint: keyPair.Fingerprint,
+		PrivateKey:  keyPair.PrivateKey,
+	}
+	if err := key.CreateSSHKey(); err != nil {
+		response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "ssh key create failed")
+		logs.Logger.Error("ssh key create failed: ", zap.Error(err))
+		return
+	}
+	logs.Logger.Info("ssh key created",
+		zap.String("key_id", strconv.Itoa(int(key.ID))),
+		zap.String("fingerprint", key.Fingerprint))
+	response.Success(c, gin.H{"key": newSSHKeyVo(key)})
+}
+
+func GetSSHKeyListFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		keys, err := model.GetSSHKeyList()
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "get ssh key list failed")
+			logs.Logger.Error("get ssh key list failed: ", zap.Error(err))
+			return
+		}
+		result := make([]sshKeyVo, 0, len(keys))
+		for i := range keys {
+			result = append(result, newSSHKeyVo(&keys[i]))
+		}
+		response.Success(c, gin.H{"keys": result})
+	}
+}
+
+// GenerateSSHKeyFunc key_type is ed25519 or rsa, bits only applies to rsa
+func GenerateSSHKeyFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name    string `json:"name" binding:"required"`
+			KeyType string `json:"key_type" binding:"required"`
+			Bits    int    `json:"bits"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		keyPair, err := pkg.GenerateKeyPair(req.KeyType, req.Bits, req.Name)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+		saveKeyPair(c, req.Name, keyPair)
+	}
+}
+
+// UploadSSHKeyFunc private_key is a PEM private key, passphrase is required if it is encrypted
+func UploadSSHKeyFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			Name       string `json:"name" binding:"required"`
+			PrivateKey string `json:"private_key" binding:"required"`
+			Passphrase string `json:"passphrase"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		keyPair, err := pkg.ParseKeyPair(req.PrivateKey, req.Passphrase, req.Name)
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, err.Error())
+			return
+		}
+		saveKeyPair(c, req.Name, keyPair)
+	}
+}
+
+func DeleteSSHKeyFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ID uint `json:"id" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+
+		key := &model.SSHKeyModel{Model: gorm.Model{ID: req.ID}}
+		if !key.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "ssh key not exists")
+			return
+		}
+		if key.IsInUse() {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "ssh key is used by servers")
+			return
+		}
+
+		if err := key.DeleteSSHKey(); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "ssh key delete failed")
+			logs.Logger.Error("ssh key delete failed: ", zap.Error(err))
+			return
+		}
+		response.Success(c, gin.H{"message": "ssh key deleted successfully"})
+	}
+}
+
+// PushSSHKeyFunc append public key of key_id to authorized_keys of server over its current login,
+// with use_key the server is switched to key authentication with that key afterwards
+func PushSSHKeyFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var req struct {
+			ServerID uint `json:"server_id" binding:"required"`
+			KeyID    uint `json:"key_id" binding:"required"`
+			UseKey   bool `json:"use_key"`
+		}
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			logs.Logger.Error("parameter bind error: ", zap.Error(err))
+			return
+		}
+		if req.ServerID == constant.LocalServerID {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "cannot push key to local server")
+			return
+		}
+
+		key := &model.SSHKeyModel{Model: gorm.Model{ID: req.KeyID}}
+		if !key.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "ssh key not exists")
+			return
+		}
+		serverModel := &model.ServerModel{Model: gorm.Model{ID: req.ServerID}}
+		if !serverModel.IsExists() {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not exists")
+			return
+		}
+		server := pkg.GetConnectionPool().GetServerByID(req.ServerID)
+		if server == nil {
+			response.Fail(c, http.StatusBadRequest, constant.ServerConnectError, "server not connected")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+		defer cancel()
+		if err := server.AuthorizePublicKey(ctx, key.PublicKey); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.ServerConnectError, err.Error())
+			logs.Logger.Error("push ssh key failed: ", zap.Error(err))
+			return
+		}
+		if !req.UseKey {
+			response.Success(c, gin.H{"message": "ssh key pushed successfully"})
+			return
+		}
+
+		keyServer := *serverModel
+		keyServer.AuthMethod = constant.AuthMethodKey
+		keyServer.SSHKeyID = key.ID
+		keyServer.Password = "" // managed keys have no passphrase
+		config, err := NewServerConfig(&keyServer)
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "decrypt server credentials failed")
+			logs.Logger.Error("decrypt server credentials failed: ", zap.Error(err))
+			return
+		}
+		// log in with the key before the password is dropped, so a key that does not work cannot lock the server out
+		if err := pkg.CheckLogin(config); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.ServerConnectError, "ssh key pushed, but login with it failed, server keeps its current login")
+			logs.Logger.Error("login with pushed ssh key failed: ", zap.String("server_id", strconv.Itoa(int(serverModel.ID))), zap.Error(err))
+			return
+		}
+
+		serverModel = &keyServer
+		if err := serverModel.UpdateServer(); err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.UnknownError, "server update failed")
+			logs.Logger.Error("server update failed: ", zap.Error(err))
+			return
+		}
+		pkg.GetConnectionPool().RemoveServerFromConnectionPoolByID(serverModel.ID)
+		if err := pkg.GetConnectionPool().NewConnection(config); err != nil {
+			failServerConnect(c, err)
+			return
+		}
+		response.Success(c, gin.H{"server": newServerVo(pkg.GetConnectionPool().GetServerByID(serverModel.ID))})
+	}
+}
@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/pkg"
+	"GolangOM/response"
+	"GolangOM/ws"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+// message sent by the browser terminal
+type terminalMessage struct {
+	Type string `json:"type"` // input or resize
+	Data string `json:"data"` // keystrokes for input
+	Cols int    `json:"cols"`
+	Rows int    `json:"rows"`
+}
+
+const (
+	terminalDefaultCols = 80
+	terminalDefaultRows = 24
+	terminalReadLimit   = 64 * 1024
+)
+
+// the terminal is a full shell on the server, so unlike the notification socket
+// it only accepts pages served by this host, a sibling subdomain counts as same-site for the cookie
+var terminalUpgrader = websocket.Upgrader{CheckOrigin: sameOrigin}
+
+// requests without Origin come from non-browser clients, which cannot ride on a user's cookie
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// TerminalFunc interactive shell of server over WebSocket
+// query: server_id, cols, rows
+func TerminalFunc() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		username, ok := c.Get("username")
+		if !ok {
+			response.Fail(c, http.StatusUnauthorized, constant.AuthError, "not logged in")
+			return
+		}
+
+		if !sameOrigin(c.Request) {
+			response.Fail(c, http.StatusForbidden, constant.AuthError, "origin not allowed")
+			logs.Logger.Warn("terminal origin rejected", zap.String("origin", c.GetHeader("Origin")), zap.String("host", c.Request.Host))
+			return
+		}
+
+		serverID, err := strconv.Atoi(c.Query("server_id"))
+		if err != nil {
+			response.Fail(c, http.StatusBadRequest, constant.ParameterError, "parameter bind error")
+			return
+		}
+		cols, err := strconv.Atoi(c.DefaultQuery("cols", strconv.Itoa(terminalDefaultCols)))
+		if err != nil || cols <= 0 {
+			cols = terminalDefaultCols
+		}
+		rows, err := strconv.Atoi(c.DefaultQuery("rows", strconv.Itoa(terminalDefaultRows)))
+		if err != nil || rows <= 0 {
+			rows = terminalDefaultRows
+		}
+
+		server := pkg.GetConnectionPool().GetServerByID(uint(serverID))
+		if server == nil {
+			response.Fail(c, http.StatusBadRequest, constant.TargetNotFound, "server not exists")
+			return
+		}
+
+		terminal, err := server.OpenTerminal(cols, rows)
+		if err != nil {
+			response.Fail(c, http.StatusInternalServerError, constant.ServerConnectError, "open terminal failed")
+			logs.Logger.Error("open terminal failed: ", zap.Error(err))
+			return
+		}
+		var closeOnce sync.Once
+		closeTerminal := func() {
+			closeOnce.Do(func() {
+				terminal.Close()
+			})
+		}
+		defer closeTerminal()
+
+		conn, err := terminalUpgrader.Upgrade(c.Writer, c.Request, nil)
+		if err != nil {
+			logs.Logger.Error("WebSocket upgrade failed", zap.Error(err))
+			return
+		}
+		defer conn.Close()
+		conn.SetReadLimit(terminalReadLimit)
+
+		logs.Logger.Info("terminal opened",
+			zap.Any("username", username),
+			zap.String("server_id", strconv.Itoa(serverID)))
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go ws.StartHeartbeat(ctx, conn)
+
+		// terminal output -> browser
+		go func() {
+			defer cancel()
+			buf := make([]byte, 32*1024)
+			for {
+				n, err := terminal.Read(buf)
+				if n > 0 {
+					if err := conn.WriteMessage(websocket.BinaryMessage, buf[:n]); err != nil {
+						logs.Logger.Debug("terminal write failed", zap.Error(err))
+						break
+					}
+				}
+				if err != nil {
+					break
+				}
+			}
+			// shell exited, tell the browser and stop reading
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "terminal closed"))
+			closeTerminal()
+			conn.Close()
+		}()
+
+		// browser input -> terminal
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) && ctx.Err() == nil {
+					logs.Logger.Warn("terminal read failed", zap.Error(err))
+				}
+				break
+			}
+
+			var msg terminalMessage
+			if err := json.Unmarshal(data, &msg); err != nil {
+				logs.Logger.Debug("invalid terminal message", zap.Error(err))
+				continue
+			}
+			switch msg.Type {
+			case "input":
+				if _, err := terminal.Write([]byte(msg.Data)); err != nil {
+					logs.Logger.Debug("terminal input failed", zap.Error(err))
+				}
+			case "resize":
+				if msg.Cols > 0 && msg.Rows > 0 {
+					if err := terminal.Resize(msg.Cols, msg.Rows); err != nil {
+						logs.Logger.Debug("terminal resize failed", zap.Error(err))
+					}
+				}
+			}
+		}
+
+		logs.Logger.Info("terminal closed",
+			zap.Any("username", username),
+			zap.String("server_id", strconv.Itoa(serverID)))
+	}
+}
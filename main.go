@@ -3,14 +3,19 @@ package main
 import (
 	_ "GolangOM/config"
 	"GolangOM/constant"
+	"GolangOM/controller"
 	"GolangOM/database"
 	"GolangOM/logs"
 	"GolangOM/model"
 	"GolangOM/pkg"
 	"GolangOM/router"
 	"GolangOM/util"
+	"context"
+	"os"
 	"strconv"
+	"time"
 
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -18,6 +23,15 @@ func main() {
 	// ensure log file is closed
 	defer logs.Logger.Sync()
 
+	// subcommands such as rotate-key run and exit without starting the web server
+	if len(os.Args) > 1 {
+		if err := runCommand(os.Args[1:]); err != nil {
+			logs.Logger.Error("command failed", zap.String("command", os.Args[1]), zap.Error(err))
+			os.Exit(1)
+		}
+		return
+	}
+
 	Init()
 
 	router.InitRouter()
@@ -26,12 +40,19 @@ func main() {
 }
 
 func Init() {
-	err := database.DB.AutoMigrate(&model.User{}, &model.ServerModel{}, &model.AppModel{})
+	err := database.DB.AutoMigrate(&model.User{}, &model.ServerModel{}, &model.AppModel{}, &model.SSHKeyModel{}, &model.ConnectionEventModel{}, &model.HostFactsModel{}, &model.MetricPointModel{}, &model.AlertRuleModel{}, &model.AlertModel{}, &model.ForwardModel{}, &model.ServerGroupModel{})
 	if err != nil {
 		logs.Logger.Error("AutoMigrate failed", zap.Error(err))
 		panic(err)
 	}
 
+	// credentials saved by older versions are stored in plaintext
+	if count, err := model.EncryptPlaintextCredentials(); err != nil {
+		logs.Logger.Error("EncryptPlaintextCredentials failed", zap.Error(err))
+	} else if count > 0 {
+		logs.Logger.Info("plaintext credentials encrypted", zap.Int("count", count))
+	}
+
 	user := model.User{Username: "admin"}
 	// if no admin user exists, create an admin user
 	if !user.IsExists() {
@@ -44,6 +65,20 @@ func Init() {
 		}
 	}
 
+	// default alert rules on first start
+	if rules, err := model.GetAlertRuleList(); err == nil && len(rules) == 0 {
+		for _, rule := range []model.AlertRuleModel{
+			{Name: "disk almost full", Expr: "disk_used_percent > 90 for 5m", Enabled: true},
+			{Name: "memory pressure", Expr: "memory_used_percent > 90 for 5m", Enabled: true},
+			{Name: "swap in use", Expr: "swap_used_percent > 50 for 10m", Enabled: true},
+			{Name: "high load", Expr: "load5_per_cpu > 2 for 10m", Enabled: true},
+		} {
+			if err := rule.CreateAlertRule(); err != nil {
+				logs.Logger.Error("CreateAlertRule failed", zap.Error(err))
+			}
+		}
+	}
+
 	localServer := model.ServerModel{}
 	localServer.ID = constant.LocalServerID
 	if !localServer.IsExists() {
@@ -54,32 +89,80 @@ func Init() {
 			panic(err)
 		}
 	}
+	// manifests are the source of truth, bring the database in line before servers and apps are started
+	if viper.GetBool("Manifest.Enabled") {
+		controller.StartManifestReconciler()
+		// reload, the local server labels may come from the manifests
+		localServer.IsExists()
+	}
+
+	// the local server is not connected like the others, take its labels from the record
+	pkg.LocalServer.Labels = localServer.Labels
 
 	servers, err := model.GetServerList()
 	if err != nil {
 		logs.Logger.Error("GetServerList failed", zap.Error(err))
 	}
 
+	configs := make([]*pkg.ServerConfig, 0, len(servers))
 	for _, server := range servers {
 		if server.ID == constant.LocalServerID {
 			continue
 		}
-		// use goroutine to establish connection, avoid blocking main thread
-		go func() {
-			err := pkg.GetConnectionPool().NewConnection(&pkg.ServerConfig{
-				AuthMethod: server.AuthMethod,
-				Credential: server.Credential,
-				ID:         server.ID,
-				IP:         server.IP,
-				Password:   server.Password,
-				Port:       server.Port,
-				User:       server.User,
-			})
-			if err != nil {
-				logs.Logger.Error("NewConnection failed", zap.String("server_id", strconv.Itoa(int(server.ID))), zap.Error(err))
-			}
-		}()
+		config, err := controller.NewServerConfig(&server)
+		if err != nil {
+			logs.Logger.Error("NewServerConfig failed", zap.String("server_id", strconv.Itoa(int(server.ID))), zap.Error(err))
+			continue
+		}
+		configs = append(configs, config)
 	}
+	// persist connected/disconnected transitions, used to compute uptime
+	pkg.GetConnectionPool().SetConnectionEventHandler(func(event pkg.ConnectionEvent) {
+		record := &model.ConnectionEventModel{
+			ServerID: event.ServerID,
+			Status:   event.Status,
+			Reason:   event.Reason,
+			Time:     event.Time,
+		}
+		if err := record.CreateConnectionEvent(); err != nil {
+			logs.Logger.Error("CreateConnectionEvent failed", zap.String("server_id", strconv.Itoa(int(event.ServerID))), zap.Error(err))
+		}
+	})
+
+	// persist host facts collected whenever a server connects
+	pkg.GetConnectionPool().SetFactsHandler(controller.SaveHostFacts)
+	// the local server never connects, collect its facts once at startup
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if _, err := pkg.GetConnectionPool().RefreshFacts(ctx, pkg.LocalServer); err != nil {
+			logs.Logger.Warn("collect local host facts failed", zap.Error(err))
+		}
+	}()
+
+	// persist resource metrics, and average or drop them as they age
+	pkg.GetMetricsCollector().SetSampleHandler(controller.SaveMetricSample)
+	go runMetricsRetention()
+
+	// evaluate alert rules on every sample, and persist fired and resolved alerts
+	if err := controller.LoadAlertRules(); err != nil {
+		logs.Logger.Error("LoadAlertRules failed", zap.Error(err))
+	}
+	if err := controller.RestoreFiringAlerts(); err != nil {
+		logs.Logger.Error("RestoreFiringAlerts failed", zap.Error(err))
+	}
+	pkg.GetAlertManager().SetAlertHandler(controller.SaveAlertEvent)
+
+	// use goroutine to establish connections, avoid blocking main thread
+	// jump servers are connected before the servers behind them
+	go pkg.GetConnectionPool().ConnectServers(configs)
+
+	// port forwards wait for their servers and open once they are connected
+	go func() {
+		if err := controller.StartForwards(); err != nil {
+			logs.Logger.Error("StartForwards failed", zap.Error(err))
+		}
+	}()
 
 	apps, err := model.GetAppList()
 	if err != nil {
@@ -89,16 +172,7 @@ func Init() {
 	for _, app := range apps {
 		// use goroutine to establish connection, avoid blocking main thread
 		go func() {
-			err := pkg.GetAppCheckerManager().NewAppChecker(&pkg.AppCheckConfig{
-				AutoRestart:   app.AutoRestart,
-				CheckInterval: app.CheckInterval,
-				CheckTarget:   app.CheckTarget,
-				CheckType:     app.CheckType,
-				ID:            app.ID,
-				Name:          app.Name,
-				ServerID:      app.ServerID,
-				StartScript:   app.StartScript,
-			})
+			err := pkg.GetAppCheckerManager().NewAppChecker(controller.NewAppCheckConfig(&app))
 			if err != nil {
 				logs.Logger.Error("NewAppChecker failed", zap.String("app_id", strconv.Itoa(int(app.ID))), zap.Error(err))
 			}
@@ -106,3 +180,37 @@ func Init() {
 	}
 
 }
+
+// retention in units of unit, default if not configured
+func retention(key string, unit time.Duration, def int) time.Duration {
+	value := viper.GetInt(key)
+	if value <= 0 {
+		value = def
+	}
+	return time.Duration(value) * unit
+}
+
+// downsample and expire metric points every hour: raw samples become 5 minute averages,
+// those become hourly averages, and hourly averages are deleted at the end of their retention
+func runMetricsRetention() {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for ; ; <-ticker.C {
+		now := time.Now()
+		if count, err := model.DownsampleMetricPoints(0, 300, now.Add(-retention("Metrics.RawRetention", time.Hour, 24))); err != nil {
+			logs.Logger.Error("downsample raw metrics failed", zap.Error(err))
+		} else if count > 0 {
+			logs.Logger.Debug("raw metrics downsampled", zap.Int("count", count))
+		}
+		if count, err := model.DownsampleMetricPoints(300, 3600, now.Add(-retention("Metrics.FiveMinuteRetention", 24*time.Hour, 7))); err != nil {
+			logs.Logger.Error("downsample 5 minute metrics failed", zap.Error(err))
+		} else if count > 0 {
+			logs.Logger.Debug("5 minute metrics downsampled", zap.Int("count", count))
+		}
+		if count, err := model.DeleteMetricPoints(3600, now.Add(-retention("Metrics.HourlyRetention", 24*time.Hour, 90))); err != nil {
+			logs.Logger.Error("delete expired metrics failed", zap.Error(err))
+		} else if count > 0 {
+			logs.Logger.Debug("expired metrics deleted", zap.Int64("count", count))
+		}
+	}
+}
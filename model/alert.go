@@ -0,0 +1,85 @@
+package model
+
+import (
+	"GolangOM/constant"
+	"GolangOM/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AlertRuleModel threshold rule on a resource metric, such as disk_used_percent{mount="/"} > 90 for 5m
+type AlertRuleModel struct {
+	gorm.Model
+	Name     string `gorm:"type:varchar(255)" json:"name"`
+	ServerID uint   `json:"server_id"`                          // 0 means every server
+	Selector string `gorm:"type:varchar(1024)" json:"selector"` // label selector servers must match, empty means every server
+	Expr     string `gorm:"type:varchar(1024)" json:"expr"`
+	Enabled  bool   `json:"enabled"`
+}
+
+func (r *AlertRuleModel) IsExists() bool {
+	return database.DB.Where("id = ?", r.ID).First(r).Error == nil
+}
+
+func (r *AlertRuleModel) CreateAlertRule() error {
+	return database.DB.Create(r).Error
+}
+
+func (r *AlertRuleModel) UpdateAlertRule() error {
+	return database.DB.Save(r).Error
+}
+
+func (r *AlertRuleModel) DeleteAlertRule() error {
+	return database.DB.Delete(r).Error
+}
+
+func GetAlertRuleList() ([]AlertRuleModel, error) {
+	var rules []AlertRuleModel
+	err := database.DB.Find(&rules).Error
+	return rules, err
+}
+
+// AlertModel alert raised by a rule on one series of a server, resolved once the condition clears
+type AlertModel struct {
+	gorm.Model
+	RuleID     uint                 `gorm:"index" json:"rule_id"`
+	RuleName   string               `gorm:"type:varchar(255)" json:"rule_name"`
+	ServerID   uint                 `gorm:"index" json:"server_id"`
+	Metric     string               `gorm:"type:varchar(63)" json:"metric"`
+	Labels     string               `gorm:"type:varchar(255)" json:"labels"`
+	Value      float64              `json:"value"` // value that fired the alert, then the value that resolved it
+	Status     constant.AlertStatus `gorm:"type:varchar(31);index" json:"status"`
+	StartedAt  time.Time            `json:"started_at"`
+	ResolvedAt *time.Time           `json:"resolved_at"`
+}
+
+func (a *AlertModel) CreateAlert() error {
+	return database.DB.Create(a).Error
+}
+
+// ResolveAlert resolve the firing alert of rule on the series of server
+func ResolveAlert(ruleID uint, serverID uint, labels string, value float64, resolvedAt time.Time) error {
+	return database.DB.Model(&AlertModel{}).
+		Where("rule_id = ? AND server_id = ? AND labels = ? AND status = ?", ruleID, serverID, labels, constant.AlertFiring).
+		Updates(map[string]any{"status": constant.AlertResolved, "value": value, "resolved_at": resolvedAt}).Error
+}
+
+// GetAlerts newest first, empty status and serverID 0 match every alert
+func GetAlerts(status constant.AlertStatus, serverID uint, limit int) ([]AlertModel, error) {
+	var alerts []AlertModel
+	query := database.DB.Order("started_at DESC").Limit(limit)
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if serverID != 0 {
+		query = query.Where("server_id = ?", serverID)
+	}
+	err := query.Find(&alerts).Error
+	return alerts, err
+}
+
+// DeleteServerAlerts delete alerts of a deleted server
+func DeleteServerAlerts(serverID uint) error {
+	return database.DB.Where("server_id = ?", serverID).Delete(&AlertModel{}).Error
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"GolangOM/constant"
 	"GolangOM/database"
+	"fmt"
 
 	"gorm.io/gorm"
 )
@@ -11,14 +12,36 @@ type AppModel struct {
 	gorm.Model
 	ServerID      uint                  `json:"server_id"`
 	Name          string                `gorm:"type:varchar(255)" json:"name"`
-	CheckType     constant.AppCheckType `gorm:"type:varchar(255)" json:"check_type"`   // pid, port, http
-	CheckTarget   string                `gorm:"type:varchar(255)" json:"check_target"` // such as process name, port number, URL
-	CheckInterval int                   `gorm:"type:int" json:"check_interval"`        // check interval (seconds)
-	StartScript   string                `gorm:"type:varchar(255)" json:"start_script"` // startup script path
-	AutoRestart   bool                  `json:"auto_restart"`                          // whether to auto restart
+	CheckType     constant.AppCheckType `gorm:"type:varchar(255)" json:"check_type"`     // pid, port, http
+	CheckTarget   string                `gorm:"type:varchar(255)" json:"check_target"`   // such as process name, port number, URL
+	CheckInterval int                   `gorm:"type:int" json:"check_interval"`          // check interval (seconds)
+	StartScript   string                `gorm:"type:varchar(255)" json:"start_script"`   // startup script path
+	AutoRestart   bool                  `json:"auto_restart"`                            // whether to auto restart
+	RunAs         string                `gorm:"type:varchar(255)" json:"run_as"`         // user running check commands and start script through become, empty means the login user
+	Labels        map[string]string     `gorm:"type:text;serializer:json" json:"labels"` // such as tier=frontend, matched by label selectors
+	HTTPCheck     *HTTPCheckSpec        `gorm:"type:text;serializer:json" json:"http_check"`
 	Server        ServerModel           `gorm:"foreignKey:ServerID"`
 }
 
+// HTTPCheckSpec request and assertions of http and http_native checks, nil sends a GET and accepts 2xx or 3xx
+type HTTPCheckSpec struct {
+	Method        string            `json:"method,omitempty"`
+	Headers       map[string]string `json:"headers,omitempty"`
+	Body          string            `json:"body,omitempty"`
+	ExpectStatus  []int             `json:"expect_status,omitempty"`  // accepted status codes
+	BodyContains  string            `json:"body_contains,omitempty"`  // substring the body must contain
+	BodyRegex     string            `json:"body_regex,omitempty"`     // regular expression the body must match
+	JSON          []JSONAssertion   `json:"json,omitempty"`           // values of a JSON body
+	MaxLatency    int               `json:"max_latency_ms,omitempty"` // milliseconds
+	TLSSkipVerify bool              `json:"tls_skip_verify,omitempty"`
+}
+
+// JSONAssertion value at a JSONPath such as $.status must equal Equals
+type JSONAssertion struct {
+	Path   string `json:"path"`
+	Equals any    `json:"equals"`
+}
+
 func (a *AppModel) IsExists() bool {
 	return database.DB.Where("id = ?", a.ID).First(a).Error == nil
 }
@@ -40,3 +63,23 @@ func GetAppList() ([]AppModel, error) {
 	err := database.DB.Preload("Server").Find(&apps).Error
 	return apps, err
 }
+
+// ImportServersAndApps create or update servers like ImportServers and then apps, all in one transaction,
+// serverIndex[i] >= 0 sets the server of apps[i] to servers[serverIndex[i]]
+func ImportServersAndApps(servers []*ServerModel, jumpIndex []int, apps []*AppModel, serverIndex []int) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := importServers(tx, servers, jumpIndex); err != nil {
+			return err
+		}
+		for i, app := range apps {
+			if j := serverIndex[i]; j >= 0 {
+				app.ServerID = servers[j].ID
+			}
+			// the preloaded server must not be saved along with the app
+			if err := tx.Omit("Server").Save(app).Error; err != nil {
+				return fmt.Errorf("save app %s failed: %w", app.Name, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,46 @@
+package model
+
+import (
+	"GolangOM/constant"
+	"GolangOM/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ConnectionEventModel connected or disconnected transition of a server
+type ConnectionEventModel struct {
+	gorm.Model
+	ServerID uint                   `gorm:"index" json:"server_id"`
+	Status   constant.ConnectStatus `gorm:"type:varchar(31)" json:"status"`
+	Reason   string                 `gorm:"type:varchar(1024)" json:"reason"` // error that caused a disconnect
+	Time     time.Time              `gorm:"index" json:"time"`
+}
+
+func (e *ConnectionEventModel) CreateConnectionEvent() error {
+	return database.DB.Create(e).Error
+}
+
+// GetConnectionEvents events of server in [since, until), oldest first
+func GetConnectionEvents(serverID uint, since time.Time, until time.Time) ([]ConnectionEventModel, error) {
+	var events []ConnectionEventModel
+	err := database.DB.Where("server_id = ? AND time >= ? AND time < ?", serverID, since, until).
+		Order("time").Find(&events).Error
+	return events, err
+}
+
+// GetLastConnectionEventBefore latest event of server before t, nil if there is none
+func GetLastConnectionEventBefore(serverID uint, t time.Time) (*ConnectionEventModel, error) {
+	var events []ConnectionEventModel
+	err := database.DB.Where("server_id = ? AND time < ?", serverID, t).
+		Order("time DESC").Limit(1).Find(&events).Error
+	if err != nil || len(events) == 0 {
+		return nil, err
+	}
+	return &events[0], nil
+}
+
+// DeleteConnectionEvents delete history of a deleted server
+func DeleteConnectionEvents(serverID uint) error {
+	return database.DB.Where("server_id = ?", serverID).Delete(&ConnectionEventModel{}).Error
+}
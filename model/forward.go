@@ -0,0 +1,46 @@
+package model
+
+import (
+	"GolangOM/constant"
+	"GolangOM/database"
+
+	"gorm.io/gorm"
+)
+
+// ForwardModel port forward through the SSH connection of a server
+type ForwardModel struct {
+	gorm.Model
+	Name     string               `gorm:"type:varchar(255)" json:"name"`
+	ServerID uint                 `gorm:"index" json:"server_id"`
+	Type     constant.ForwardType `gorm:"type:varchar(31)" json:"type"`    // local or remote
+	Listen   string               `gorm:"type:varchar(255)" json:"listen"` // local: address on this host, remote: address on the server
+	Target   string               `gorm:"type:varchar(255)" json:"target"` // local: address dialed from the server, remote: address dialed from this host
+	Enabled  bool                 `json:"enabled"`                         // started, and started again at startup
+}
+
+func (f *ForwardModel) IsExists() bool {
+	return database.DB.Where("id = ?", f.ID).First(f).Error == nil
+}
+
+func (f *ForwardModel) CreateForward() error {
+	return database.DB.Create(f).Error
+}
+
+func (f *ForwardModel) UpdateForward() error {
+	return database.DB.Save(f).Error
+}
+
+func (f *ForwardModel) DeleteForward() error {
+	return database.DB.Delete(f).Error
+}
+
+func GetForwardList() ([]ForwardModel, error) {
+	var forwards []ForwardModel
+	err := database.DB.Find(&forwards).Error
+	return forwards, err
+}
+
+// DeleteServerForwards delete port forwards of a deleted server
+func DeleteServerForwards(serverID uint) error {
+	return database.DB.Where("server_id = ?", serverID).Delete(&ForwardModel{}).Error
+}
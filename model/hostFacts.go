@@ -0,0 +1,72 @@
+package model
+
+import (
+	"GolangOM/database"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HostFactsModel facts of a server from its last successful collection, one row per server
+type HostFactsModel struct {
+	gorm.Model
+	ServerID      uint             `gorm:"uniqueIndex" json:"server_id"`
+	Hostname      string           `gorm:"type:varchar(255)" json:"hostname"`
+	Distro        string           `gorm:"type:varchar(63)" json:"distro"` // such as ubuntu or centos
+	DistroVersion string           `gorm:"type:varchar(63)" json:"distro_version"`
+	OSName        string           `gorm:"type:varchar(255)" json:"os_name"`
+	Kernel        string           `gorm:"type:varchar(255)" json:"kernel"`
+	Arch          string           `gorm:"type:varchar(63)" json:"arch"`
+	CPUCount      int              `json:"cpu_count"`
+	MemoryTotal   uint64           `json:"memory_total"` // bytes
+	Uptime        int64            `json:"uptime"`       // seconds, at CollectedAt
+	Filesystems   []HostFilesystem `gorm:"type:text;serializer:json" json:"filesystems"`
+	IPs           []string         `gorm:"type:text;serializer:json" json:"ips"`
+	CollectedAt   time.Time        `json:"collected_at"`
+}
+
+// HostFilesystem mounted file system, sizes in bytes
+type HostFilesystem struct {
+	Device string `json:"device"`
+	Type   string `json:"type"`
+	Mount  string `json:"mount"`
+	Size   uint64 `json:"size"`
+	Used   uint64 `json:"used"`
+}
+
+// SaveHostFacts insert or replace facts of the server
+func (f *HostFactsModel) SaveHostFacts() error {
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "server_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"updated_at", "hostname", "distro", "distro_version", "os_name", "kernel", "arch", "cpu_count", "memory_total", "uptime", "filesystems", "ips", "collected_at"}),
+	}).Create(f).Error
+}
+
+// GetHostFacts facts of server, nil if never collected
+func GetHostFacts(serverID uint) (*HostFactsModel, error) {
+	var facts []HostFactsModel
+	err := database.DB.Where("server_id = ?", serverID).Limit(1).Find(&facts).Error
+	if err != nil || len(facts) == 0 {
+		return nil, err
+	}
+	return &facts[0], nil
+}
+
+// GetHostFactsMap facts of all servers, keyed by server ID
+func GetHostFactsMap() (map[uint]*HostFactsModel, error) {
+	var facts []HostFactsModel
+	if err := database.DB.Find(&facts).Error; err != nil {
+		return nil, err
+	}
+	result := make(map[uint]*HostFactsModel, len(facts))
+	for i := range facts {
+		result[facts[i].ServerID] = &facts[i]
+	}
+	return result, nil
+}
+
+// DeleteHostFacts delete facts of a deleted server
+func DeleteHostFacts(serverID uint) error {
+	return database.DB.Unscoped().Where("server_id = ?", serverID).Delete(&HostFactsModel{}).Error
+}
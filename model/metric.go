@@ -0,0 +1,129 @@
+package model
+
+import (
+	"GolangOM/database"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// MetricPointModel one value of a resource metric, raw samples are averaged into coarser points as they age
+// only one resolution exists for any point in time, so a range query can read all of them together
+type MetricPointModel struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	ServerID   uint      `gorm:"index:idx_metric_series,priority:1" json:"server_id"`
+	Name       string    `gorm:"type:varchar(63);index:idx_metric_series,priority:2" json:"name"`
+	Labels     string    `gorm:"type:varchar(255)" json:"labels"` // such as mount="/", see pkg.FormatLabels
+	Time       time.Time `gorm:"index:idx_metric_series,priority:3;index:idx_metric_resolution,priority:2" json:"time"`
+	Resolution int       `gorm:"index:idx_metric_resolution,priority:1" json:"resolution"` // seconds averaged into the point, 0 means raw
+	Value      float64   `json:"value"`
+}
+
+func CreateMetricPoints(points []MetricPointModel) error {
+	if len(points) == 0 {
+		return nil
+	}
+	return database.DB.CreateInBatches(points, 500).Error
+}
+
+// GetMetricPoints points of server in [since, until) of any resolution, ordered by series and time
+// names filters metric names, empty means all
+func GetMetricPoints(serverID uint, names []string, since time.Time, until time.Time) ([]MetricPointModel, error) {
+	var points []MetricPointModel
+	query := database.DB.Where("server_id = ? AND time >= ? AND time < ?", serverID, since, until)
+	if len(names) > 0 {
+		query = query.Where("name IN ?", names)
+	}
+	err := query.Order("name, labels, time").Find(&points).Error
+	return points, err
+}
+
+// averageMetricPoints average points per series over buckets of to seconds, at the start time of each bucket,
+// in the order the buckets first appear in points
+func averageMetricPoints(points []MetricPointModel, to int) []MetricPointModel {
+	type bucketKey struct {
+		serverID uint
+		name     string
+		labels   string
+		time     time.Time
+	}
+	type bucket struct {
+		sum   float64
+		count int
+	}
+	buckets := make(map[bucketKey]*bucket)
+	order := make([]bucketKey, 0)
+	for _, point := range points {
+		key := bucketKey{point.ServerID, point.Name, point.Labels, point.Time.Truncate(time.Duration(to) * time.Second)}
+		if buckets[key] == nil {
+			buckets[key] = &bucket{}
+			order = append(order, key)
+		}
+		buckets[key].sum += point.Value
+		buckets[key].count++
+	}
+
+	averaged := make([]MetricPointModel, 0, len(order))
+	for _, key := range order {
+		averaged = append(averaged, MetricPointModel{
+			ServerID:   key.serverID,
+			Name:       key.name,
+			Labels:     key.labels,
+			Time:       key.time,
+			Resolution: to,
+			Value:      buckets[key].sum / float64(buckets[key].count),
+		})
+	}
+	return averaged
+}
+
+// DownsampleMetricPoints replace points of resolution from older than before with averages over to seconds,
+// before is aligned down to to so that only complete buckets are averaged, returns the number of points replaced
+func DownsampleMetricPoints(from int, to int, before time.Time) (int, error) {
+	before = before.Truncate(time.Duration(to) * time.Second)
+
+	var serverIDs []uint
+	err := database.DB.Model(&MetricPointModel{}).
+		Where("resolution = ? AND time < ?", from, before).
+		Distinct().Pluck("server_id", &serverIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	// one server at a time keeps memory bounded after a long downtime
+	replaced := 0
+	for _, serverID := range serverIDs {
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			var points []MetricPointModel
+			err := tx.Where("server_id = ? AND resolution = ? AND time < ?", serverID, from, before).Find(&points).Error
+			if err != nil {
+				return err
+			}
+
+			averaged := averageMetricPoints(points, to)
+			if len(averaged) > 0 {
+				if err := tx.CreateInBatches(averaged, 500).Error; err != nil {
+					return err
+				}
+			}
+			replaced += len(points)
+			return tx.Where("server_id = ? AND resolution = ? AND time < ?", serverID, from, before).
+				Delete(&MetricPointModel{}).Error
+		})
+		if err != nil {
+			return replaced, err
+		}
+	}
+	return replaced, nil
+}
+
+// DeleteMetricPoints delete points of resolution older than before
+func DeleteMetricPoints(resolution int, before time.Time) (int64, error) {
+	result := database.DB.Where("resolution = ? AND time < ?", resolution, before).Delete(&MetricPointModel{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteServerMetricPoints delete metrics of a deleted server
+func DeleteServerMetricPoints(serverID uint) error {
+	return database.DB.Where("server_id = ?", serverID).Delete(&MetricPointModel{}).Error
+}
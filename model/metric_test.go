@@ -0,0 +1,43 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAverageMetricPoints(t *testing.T) {
+	base := time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC)
+	point := func(serverID uint, name string, labels string, offset time.Duration, value float64) MetricPointModel {
+		return MetricPointModel{ServerID: serverID, Name: name, Labels: labels, Time: base.Add(offset), Value: value}
+	}
+	points := []MetricPointModel{
+		point(1, "cpu_used_percent", "", 10*time.Second, 10),
+		point(1, "disk_used_percent", `mount="/"`, 20*time.Second, 50),
+		point(1, "cpu_used_percent", "", 4*time.Minute+50*time.Second, 30),
+		point(1, "disk_used_percent", `mount="/data"`, 30*time.Second, 70),
+		point(1, "cpu_used_percent", "", 5*time.Minute, 90), // next bucket
+		point(2, "cpu_used_percent", "", time.Minute, 1),
+		point(1, "disk_used_percent", `mount="/"`, 2*time.Minute, 60),
+	}
+
+	got := averageMetricPoints(points, 300)
+	want := []MetricPointModel{
+		{ServerID: 1, Name: "cpu_used_percent", Time: base, Resolution: 300, Value: 20},
+		{ServerID: 1, Name: "disk_used_percent", Labels: `mount="/"`, Time: base, Resolution: 300, Value: 55},
+		{ServerID: 1, Name: "disk_used_percent", Labels: `mount="/data"`, Time: base, Resolution: 300, Value: 70},
+		{ServerID: 1, Name: "cpu_used_percent", Time: base.Add(5 * time.Minute), Resolution: 300, Value: 90},
+		{ServerID: 2, Name: "cpu_used_percent", Time: base, Resolution: 300, Value: 1},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d points, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("point %d:\n got %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+
+	if averaged := averageMetricPoints(nil, 300); len(averaged) != 0 {
+		t.Fatalf("no points averaged to %+v", averaged)
+	}
+}
@@ -3,18 +3,59 @@ package model
 import (
 	"GolangOM/constant"
 	"GolangOM/database"
+	"GolangOM/util"
+	"encoding/json"
+	"fmt"
 
 	"gorm.io/gorm"
 )
 
 type ServerModel struct {
 	gorm.Model
-	IP         string              `gorm:"type:varchar(255)" json:"ip"`
-	Port       int                 `gorm:"type:int" json:"port"`
-	User       string              `gorm:"type:varchar(255)" json:"user"`
-	AuthMethod constant.AuthMethod `gorm:"type:varchar(255)" json:"auth_method"` // password or key
-	Credential string              `gorm:"type:varchar(255)" json:"credential"`  // key path
-	Password   string              `gorm:"type:varchar(255)" json:"password"`    // password or key password
+	IP             string                `gorm:"type:varchar(255)" json:"ip"`
+	Port           int                   `gorm:"type:int" json:"port"`
+	User           string                `gorm:"type:varchar(255)" json:"user"`
+	AuthMethod     constant.AuthMethod   `gorm:"type:varchar(255)" json:"auth_method"`      // password, key, agent or certificate
+	Credential     string                `gorm:"type:varchar(255)" json:"credential"`       // key path, or ssh-agent socket path for agent authentication
+	Password       string                `gorm:"type:varchar(1024)" json:"password"`        // password or key password, encrypted at rest
+	JumpServerID   uint                  `json:"jump_server_id"`                            // jump host (bastion) server ID, 0 means direct connection
+	SSHKeyID       uint                  `json:"ssh_key_id"`                                // managed key used by key and certificate authentication, 0 means the Credential key file
+	Certificate    string                `gorm:"type:text" json:"certificate"`              // OpenSSH user certificate or path to it, for certificate authentication
+	BecomeMethod   constant.BecomeMethod `gorm:"type:varchar(31)" json:"become_method"`     // sudo or su, used to run app commands as another user
+	BecomePassword string                `gorm:"type:varchar(1024)" json:"become_password"` // password answered to sudo or su prompts, encrypted at rest
+	Labels         map[string]string     `gorm:"type:text;serializer:json" json:"labels"`   // such as env=prod, matched by label selectors
+}
+
+// credential fields encrypted at rest, keyed by column name
+func (s *ServerModel) secretFields() map[string]*string {
+	return map[string]*string{
+		"password":        &s.Password,
+		"become_password": &s.BecomePassword,
+	}
+}
+
+// MarshalJSON credential fields are accepted in requests but never returned in responses
+func (s ServerModel) MarshalJSON() ([]byte, error) {
+	type plain ServerModel
+	p := plain(s)
+	p.Password = ""
+	p.BecomePassword = ""
+	return json.Marshal(p)
+}
+
+// BeforeSave encrypt credential fields before they reach the database, encrypted values are kept
+func (s *ServerModel) BeforeSave(tx *gorm.DB) error {
+	for column, field := range s.secretFields() {
+		if util.IsEncryptedSecret(*field) {
+			continue
+		}
+		value, err := util.EncryptSecret(*field)
+		if err != nil {
+			return fmt.Errorf("encrypt %s failed: %w", column, err)
+		}
+		*field = value
+	}
+	return nil
 }
 
 func (s *ServerModel) IsExists() bool {
@@ -38,3 +79,100 @@ func GetServerList() ([]ServerModel, error) {
 	err := database.DB.Find(&servers).Error
 	return servers, err
 }
+
+// EncryptPlaintextCredentials encrypt credentials stored before encryption was enabled
+func EncryptPlaintextCredentials() (int, error) {
+	return RotateCredentialKey(nil, nil)
+}
+
+// RotateCredentialKey rewrap credentials from master key from to master key to in one transaction,
+// nil boxes mean the configured master key, plaintext credentials are encrypted as well
+func RotateCredentialKey(from *util.SecretBox, to *util.SecretBox) (int, error) {
+	var err error
+	if from == nil {
+		if from, err = util.GetSecretBox(); err != nil {
+			return 0, err
+		}
+	}
+	if to == nil {
+		to = from
+	}
+
+	updated := 0
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var servers []ServerModel
+		if err := tx.Find(&servers).Error; err != nil {
+			return err
+		}
+		for _, server := range servers {
+			columns, err := rewrapSecrets(server.secretFields(), from, to)
+			if err != nil {
+				return fmt.Errorf("rewrap credentials of server %d failed: %w", server.ID, err)
+			}
+			if len(columns) == 0 {
+				continue
+			}
+			// update columns directly, BeforeSave would see an encrypted value anyway
+			if err := tx.Model(&server).UpdateColumns(columns).Error; err != nil {
+				return err
+			}
+			updated += len(columns)
+		}
+
+		var keys []SSHKeyModel
+		if err := tx.Find(&keys).Error; err != nil {
+			return err
+		}
+		for _, key := range keys {
+			columns, err := rewrapSecrets(map[string]*string{"private_key": &key.PrivateKey}, from, to)
+			if err != nil {
+				return fmt.Errorf("rewrap private key %d failed: %w", key.ID, err)
+			}
+			if len(columns) == 0 {
+				continue
+			}
+			if err := tx.Model(&key).UpdateColumns(columns).Error; err != nil {
+				return err
+			}
+			updated += len(columns)
+		}
+		return nil
+	})
+	return updated, err
+}
+
+// rewrapSecrets rewrap values of columns from master key from to master key to,
+// returns the new values of the columns that changed
+func rewrapSecrets(fields map[string]*string, from *util.SecretBox, to *util.SecretBox) (map[string]any, error) {
+	columns := make(map[string]any)
+	for column, field := range fields {
+		value, err := from.Rewrap(*field, to)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", column, err)
+		}
+		if value != *field {
+			columns[column] = value
+		}
+	}
+	return columns, nil
+}
+
+// ImportServers create or update servers in one transaction, in order,
+// jumpIndex[i] >= 0 sets the jump server of servers[i] to servers[jumpIndex[i]], which must come before it
+func ImportServers(servers []*ServerModel, jumpIndex []int) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		return importServers(tx, servers, jumpIndex)
+	})
+}
+
+func importServers(tx *gorm.DB, servers []*ServerModel, jumpIndex []int) error {
+	for i, server := range servers {
+		if j := jumpIndex[i]; j >= 0 {
+			server.JumpServerID = servers[j].ID
+		}
+		if err := tx.Save(server).Error; err != nil {
+			return fmt.Errorf("save server %s:%d failed: %w", server.IP, server.Port, err)
+		}
+	}
+	return nil
+}
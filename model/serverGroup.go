@@ -0,0 +1,60 @@
+package model
+
+import (
+	"GolangOM/database"
+	"slices"
+
+	"gorm.io/gorm"
+)
+
+// ServerGroupModel named set of servers: servers matching the label selector plus servers added by ID
+type ServerGroupModel struct {
+	gorm.Model
+	Name        string `gorm:"type:varchar(255);uniqueIndex" json:"name"`
+	Description string `gorm:"type:varchar(1024)" json:"description"`
+	Selector    string `gorm:"type:varchar(1024)" json:"selector"`          // label selector such as env=prod,role in (web,api), empty selects no server
+	ServerIDs   []uint `gorm:"type:text;serializer:json" json:"server_ids"` // members added by ID
+}
+
+func (g *ServerGroupModel) IsExists() bool {
+	return database.DB.Where("id = ?", g.ID).First(g).Error == nil
+}
+
+func (g *ServerGroupModel) CreateServerGroup() error {
+	return database.DB.Create(g).Error
+}
+
+func (g *ServerGroupModel) UpdateServerGroup() error {
+	return database.DB.Save(g).Error
+}
+
+// DeleteServerGroup deleted for good, so the name can be used again
+func (g *ServerGroupModel) DeleteServerGroup() error {
+	return database.DB.Unscoped().Delete(g).Error
+}
+
+func GetServerGroupList() ([]ServerGroupModel, error) {
+	var groups []ServerGroupModel
+	err := database.DB.Find(&groups).Error
+	return groups, err
+}
+
+// RemoveServerFromGroups drop a deleted server from the members of every group
+func RemoveServerFromGroups(serverID uint) error {
+	groups, err := GetServerGroupList()
+	if err != nil {
+		return err
+	}
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		for _, group := range groups {
+			if !slices.Contains(group.ServerIDs, serverID) {
+				continue
+			}
+			group.ServerIDs = slices.DeleteFunc(group.ServerIDs, func(id uint) bool { return id == serverID })
+			if err := tx.Save(&group).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,43 @@
+package model
+
+import (
+	"GolangOM/util"
+	"testing"
+)
+
+func TestRewrapSecrets(t *testing.T) {
+	oldBox, _ := util.NewSecretBox(util.GenerateMasterKey())
+	newBox, _ := util.NewSecretBox(util.GenerateMasterKey())
+	password, _ := oldBox.Encrypt("login secret")
+	alreadyNew, _ := newBox.Encrypt("become secret")
+	server := &ServerModel{Password: password, BecomePassword: alreadyNew}
+
+	columns, err := rewrapSecrets(server.secretFields(), oldBox, newBox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(columns) != 1 || columns["password"] == nil {
+		t.Fatalf("changed columns: %v", columns)
+	}
+	if got, err := newBox.Decrypt(columns["password"].(string)); err != nil || got != "login secret" {
+		t.Fatalf("rewrapped password: %q, %v", got, err)
+	}
+
+	// plaintext from before encryption was enabled is encrypted, empty values stay empty
+	server = &ServerModel{Password: "plain"}
+	columns, err = rewrapSecrets(server.secretFields(), oldBox, newBox)
+	if err != nil || len(columns) != 1 {
+		t.Fatalf("plaintext columns: %v, %v", columns, err)
+	}
+	if got, _ := newBox.Decrypt(columns["password"].(string)); got != "plain" {
+		t.Fatalf("encrypted plaintext: %q", got)
+	}
+
+	// a value under an unknown key fails the whole rotation
+	otherBox, _ := util.NewSecretBox(util.GenerateMasterKey())
+	foreign, _ := otherBox.Encrypt("secret")
+	server = &ServerModel{Password: foreign}
+	if _, err := rewrapSecrets(server.secretFields(), oldBox, newBox); err == nil {
+		t.Fatal("value under another key rewrapped")
+	}
+}
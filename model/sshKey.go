@@ -0,0 +1,66 @@
+package model
+
+import (
+	"GolangOM/database"
+	"GolangOM/util"
+	"encoding/json"
+	"fmt"
+
+	"gorm.io/gorm"
+)
+
+// SSHKeyModel managed SSH key pair, servers reference it by ID instead of a key file path
+type SSHKeyModel struct {
+	gorm.Model
+	Name        string `gorm:"type:varchar(255)" json:"name"`
+	KeyType     string `gorm:"type:varchar(63)" json:"key_type"` // such as ssh-ed25519, ssh-rsa
+	PublicKey   string `gorm:"type:text" json:"public_key"`      // authorized_keys line
+	Fingerprint string `gorm:"type:varchar(255)" json:"fingerprint"`
+	PrivateKey  string `gorm:"type:text" json:"private_key"` // OpenSSH PEM, encrypted at rest
+}
+
+// MarshalJSON private key is never returned in responses
+func (k SSHKeyModel) MarshalJSON() ([]byte, error) {
+	type plain SSHKeyModel
+	p := plain(k)
+	p.PrivateKey = ""
+	return json.Marshal(p)
+}
+
+// BeforeSave encrypt private key before it reaches the database, encrypted values are kept
+func (k *SSHKeyModel) BeforeSave(tx *gorm.DB) error {
+	if util.IsEncryptedSecret(k.PrivateKey) {
+		return nil
+	}
+	privateKey, err := util.EncryptSecret(k.PrivateKey)
+	if err != nil {
+		return fmt.Errorf("encrypt private key failed: %w", err)
+	}
+	k.PrivateKey = privateKey
+	return nil
+}
+
+func (k *SSHKeyModel) IsExists() bool {
+	return database.DB.Where("id = ?", k.ID).First(k).Error == nil
+}
+
+func (k *SSHKeyModel) CreateSSHKey() error {
+	return database.DB.Create(k).Error
+}
+
+func (k *SSHKeyModel) DeleteSSHKey() error {
+	return database.DB.Delete(k).Error
+}
+
+// IsInUse key is referenced by a server
+func (k *SSHKeyModel) IsInUse() bool {
+	var count int64
+	database.DB.Model(&ServerModel{}).Where("ssh_key_id = ?", k.ID).Count(&count)
+	return count > 0
+}
+
+func GetSSHKeyList() ([]SSHKeyModel, error) {
+	var keys []SSHKeyModel
+	err := database.DB.Find(&keys).Error
+	return keys, err
+}
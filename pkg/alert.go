@@ -0,0 +1,432 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/ws"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"go.uber.org/zap"
+)
+
+// AlertCondition parsed alert expression, such as disk_used_percent{mount="/"} > 90 for 5m
+type AlertCondition struct {
+	Metric    string
+	Labels    map[string]string // series must have these labels, others are evaluated separately
+	Op        string            // >, >=, <, <=, == or !=
+	Threshold float64
+	For       time.Duration // condition must hold this long before the alert fires, 0 fires on the first sample
+}
+
+// ParseAlertExpr parse metric{label="value",...} op threshold [for duration]
+func ParseAlertExpr(expr string) (*AlertCondition, error) {
+	rest := strings.TrimSpace(expr)
+	end := strings.IndexFunc(rest, func(r rune) bool {
+		return !(unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+	})
+	if end < 0 {
+		end = len(rest)
+	}
+	condition := &AlertCondition{Metric: rest[:end]}
+	if condition.Metric == "" {
+		return nil, fmt.Errorf("alert expression must start with a metric name")
+	}
+	rest = strings.TrimSpace(rest[end:])
+
+	if strings.HasPrefix(rest, "{") {
+		closing := strings.Index(rest, "}")
+		if closing < 0 {
+			return nil, fmt.Errorf("missing } in alert expression")
+		}
+		labels, err := parseLabelMatchers(rest[1:closing])
+		if err != nil {
+			return nil, err
+		}
+		condition.Labels = labels
+		rest = strings.TrimSpace(rest[closing+1:])
+	}
+
+	for _, op := range []string{">=", "<=", "==", "!=", ">", "<"} {
+		if strings.HasPrefix(rest, op) {
+			condition.Op = op
+			rest = strings.TrimSpace(rest[len(op):])
+			break
+		}
+	}
+	if condition.Op == "" {
+		return nil, fmt.Errorf("alert expression needs a comparison: >, >=, <, <=, == or !=")
+	}
+
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("alert expression needs a threshold")
+	}
+	threshold, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid threshold %q", fields[0])
+	}
+	condition.Threshold = threshold
+
+	switch {
+	case len(fields) == 1:
+	case len(fields) == 3 && fields[1] == "for":
+		duration, err := time.ParseDuration(fields[2])
+		if err != nil || duration < 0 {
+			return nil, fmt.Errorf("invalid duration %q", fields[2])
+		}
+		condition.For = duration
+	default:
+		return nil, fmt.Errorf("unexpected %q after threshold, expected for <duration>", strings.Join(fields[1:], " "))
+	}
+	return condition, nil
+}
+
+// mount="/",device="eth0"
+func parseLabelMatchers(text string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, matcher := range strings.Split(text, ",") {
+		if strings.TrimSpace(matcher) == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(matcher, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid label matcher %q", matcher)
+		}
+		unquoted, err := strconv.Unquote(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("label value must be quoted: %s", matcher)
+		}
+		labels[strings.TrimSpace(name)] = unquoted
+	}
+	return labels, nil
+}
+
+func (a *AlertCondition) holds(value float64) bool {
+	switch a.Op {
+	case ">":
+		return value > a.Threshold
+	case ">=":
+		return value >= a.Threshold
+	case "<":
+		return value < a.Threshold
+	case "<=":
+		return value <= a.Threshold
+	case "==":
+		return value == a.Threshold
+	case "!=":
+		return value != a.Threshold
+	}
+	return false
+}
+
+// series has all labels of the condition
+func (a *AlertCondition) matches(point MetricPoint) bool {
+	if point.Name != a.Metric {
+		return false
+	}
+	for name, value := range a.Labels {
+		if point.Labels[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// AlertRule rule evaluated against every metric sample
+type AlertRule struct {
+	ID        uint
+	Name      string
+	ServerID  uint   // 0 means every server
+	Selector  string // label selector servers must match, empty means every server
+	Expr      string
+	condition *AlertCondition
+	selector  *LabelSelector
+}
+
+// NewAlertRule parse the expression and server selector of rule
+func NewAlertRule(id uint, name string, serverID uint, selector string, expr string) (*AlertRule, error) {
+	condition, err := ParseAlertExpr(expr)
+	if err != nil {
+		return nil, err
+	}
+	labelSelector, err := ParseLabelSelector(selector)
+	if err != nil {
+		return nil, err
+	}
+	return &AlertRule{ID: id, Name: name, ServerID: serverID, Selector: selector, Expr: expr, condition: condition, selector: labelSelector}, nil
+}
+
+// rule applies to the server with labels
+func (r *AlertRule) appliesTo(serverID uint, labels map[string]string) bool {
+	return (r.ServerID == 0 || r.ServerID == serverID) && r.selector.Matches(labels)
+}
+
+// AlertEvent alert of a rule on one series of a server fired or resolved
+type AlertEvent struct {
+	RuleID    uint
+	RuleName  string
+	ServerID  uint
+	Metric    string
+	Labels    string // labels of the series, see FormatLabels
+	Value     float64
+	Status    constant.AlertStatus
+	StartedAt time.Time // when the alert fired
+	Time      time.Time // when the event happened, equal to StartedAt for firing events
+}
+
+// one alert state per rule, server and series
+type alertKey struct {
+	ruleID   uint
+	serverID uint
+	labels   string
+}
+
+type alertState struct {
+	pendingSince time.Time // condition holds since then
+	firing       bool
+	startedAt    time.Time
+	metric       string
+	value        float64
+}
+
+// AlertManager evaluates alert rules on metric samples and raises or resolves alerts
+type AlertManager struct {
+	mutex  sync.Mutex
+	rules  map[uint]*AlertRule
+	states map[alertKey]*alertState
+	// events wait in queue for the handler worker, in the order their states changed
+	handler func(event AlertEvent)
+	queue   []AlertEvent
+	wakeup  chan struct{} // worker has queued events, nil until a handler is set
+}
+
+// events waiting for the alert handler, newer events are dropped once this many are queued
+const alertQueueSize = 1024
+
+var alertManager = AlertManager{
+	rules:  make(map[uint]*AlertRule),
+	states: make(map[alertKey]*alertState),
+}
+
+func GetAlertManager() *AlertManager {
+	return &alertManager
+}
+
+// SetAlertHandler handler called on every fired or resolved alert, such as persisting it
+// events are passed one at a time in the order they happened, so a resolve never overtakes its firing
+func (m *AlertManager) SetAlertHandler(handler func(event AlertEvent)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.handler = handler
+	if m.wakeup == nil {
+		m.wakeup = make(chan struct{}, 1)
+		go m.deliver(m.wakeup)
+	}
+}
+
+// pass queued events to the handler one at a time, the handler runs without m.mutex held
+// so a slow handler delays its events but never evaluation or readers of alert state
+func (m *AlertManager) deliver(wakeup <-chan struct{}) {
+	for range wakeup {
+		for {
+			m.mutex.Lock()
+			events, handler := m.queue, m.handler
+			m.queue = nil
+			m.mutex.Unlock()
+			if len(events) == 0 {
+				break
+			}
+			for _, event := range events {
+				handler(event)
+			}
+		}
+	}
+}
+
+// SetRules replace all rules, firing alerts of removed or changed rules are resolved
+func (m *AlertManager) SetRules(rules []*AlertRule) {
+	m.mutex.Lock()
+	next := make(map[uint]*AlertRule, len(rules))
+	for _, rule := range rules {
+		next[rule.ID] = rule
+	}
+	var events []AlertEvent
+	now := time.Now()
+	for key, state := range m.states {
+		old := m.rules[key.ruleID]
+		if rule := next[key.ruleID]; rule != nil && old != nil && rule.Expr == old.Expr && rule.ServerID == old.ServerID && rule.Selector == old.Selector {
+			continue
+		}
+		if state.firing {
+			events = append(events, m.resolvedEventLocked(key, state, now))
+		}
+		delete(m.states, key)
+	}
+	m.rules = next
+	m.queueLocked(events)
+	m.mutex.Unlock()
+
+	m.emit(events)
+}
+
+// RestoreFiring mark alerts that were firing before a restart, so they are resolved once the condition clears
+func (m *AlertManager) RestoreFiring(events []AlertEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, event := range events {
+		if m.rules[event.RuleID] == nil {
+			continue
+		}
+		m.states[alertKey{event.RuleID, event.ServerID, event.Labels}] = &alertState{
+			pendingSince: event.StartedAt,
+			firing:       true,
+			startedAt:    event.StartedAt,
+			metric:       event.Metric,
+			value:        event.Value,
+		}
+	}
+}
+
+// FiringCount number of firing alerts by rule name
+func (m *AlertManager) FiringCount() map[string]int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	counts := make(map[string]int)
+	for key, state := range m.states {
+		if state.firing {
+			counts[m.rules[key.ruleID].Name]++
+		}
+	}
+	return counts
+}
+
+// Forget drop alert states of a deleted server without resolving them
+func (m *AlertManager) Forget(serverID uint) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for key := range m.states {
+		if key.serverID == serverID {
+			delete(m.states, key)
+		}
+	}
+}
+
+func (m *AlertManager) resolvedEventLocked(key alertKey, state *alertState, now time.Time) AlertEvent {
+	return AlertEvent{
+		RuleID:    key.ruleID,
+		RuleName:  m.rules[key.ruleID].Name,
+		ServerID:  key.serverID,
+		Metric:    state.metric,
+		Labels:    key.labels,
+		Value:     state.value,
+		Status:    constant.AlertResolved,
+		StartedAt: state.startedAt,
+		Time:      now,
+	}
+}
+
+// evaluate rules of the server on sample, a series missing from the sample counts as not matching
+func (m *AlertManager) evaluate(sample *MetricSample) {
+	serverLabels := connectionPool.serverLabels(sample.ServerID)
+	m.mutex.Lock()
+	var events []AlertEvent
+	seen := make(map[alertKey]bool)
+	for _, rule := range m.rules {
+		if !rule.appliesTo(sample.ServerID, serverLabels) {
+			continue
+		}
+		for _, point := range sample.Points {
+			if !rule.condition.matches(point) || !rule.condition.holds(point.Value) {
+				continue
+			}
+			key := alertKey{rule.ID, sample.ServerID, FormatLabels(point.Labels)}
+			seen[key] = true
+			state := m.states[key]
+			if state == nil {
+				state = &alertState{pendingSince: sample.Time, metric: point.Name}
+				m.states[key] = state
+			}
+			state.value = point.Value
+			if !state.firing && sample.Time.Sub(state.pendingSince) >= rule.condition.For {
+				state.firing = true
+				state.startedAt = sample.Time
+				events = append(events, AlertEvent{
+					RuleID:    rule.ID,
+					RuleName:  rule.Name,
+					ServerID:  sample.ServerID,
+					Metric:    point.Name,
+					Labels:    key.labels,
+					Value:     point.Value,
+					Status:    constant.AlertFiring,
+					StartedAt: sample.Time,
+					Time:      sample.Time,
+				})
+			}
+		}
+	}
+
+	for key, state := range m.states {
+		if key.serverID != sample.ServerID || seen[key] {
+			continue
+		}
+		if state.firing {
+			event := m.resolvedEventLocked(key, state, sample.Time)
+			// report the value that cleared the condition
+			for _, point := range sample.Points {
+				if point.Name == state.metric && FormatLabels(point.Labels) == key.labels {
+					event.Value = point.Value
+				}
+			}
+			events = append(events, event)
+		}
+		delete(m.states, key)
+	}
+	m.queueLocked(events)
+	m.mutex.Unlock()
+
+	m.emit(events)
+}
+
+// queue events for the alert handler worker without blocking, must be called with m.mutex held
+// so events of concurrent evaluations are queued in the order their states changed
+func (m *AlertManager) queueLocked(events []AlertEvent) {
+	if m.handler == nil || len(events) == 0 {
+		return
+	}
+	if len(m.queue)+len(events) > alertQueueSize {
+		logs.Logger.Error("alert handler stalled, events dropped",
+			zap.Int("queued", len(m.queue)),
+			zap.Int("dropped", len(events)))
+		return
+	}
+	m.queue = append(m.queue, events...)
+	select {
+	case m.wakeup <- struct{}{}:
+	default:
+		// the worker is woken up already and takes these events with the others
+	}
+}
+
+// broadcast alerts over WebSocket, call without m.mutex held
+func (m *AlertManager) emit(events []AlertEvent) {
+	for _, event := range events {
+		ws.SendMessage(ws.Message{
+			Alert: &ws.AlertNotice{
+				RuleID:    event.RuleID,
+				RuleName:  event.RuleName,
+				ServerID:  event.ServerID,
+				Metric:    event.Metric,
+				Labels:    event.Labels,
+				Value:     event.Value,
+				Status:    string(event.Status),
+				StartedAt: event.StartedAt,
+				Time:      event.Time,
+			},
+		})
+	}
+}
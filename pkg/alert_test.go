@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAlertHandlerReceivesEventsInOrder(t *testing.T) {
+	manager := &AlertManager{rules: make(map[uint]*AlertRule), states: make(map[alertKey]*alertState)}
+	rule, err := NewAlertRule(1, "cpu busy", 0, "", "cpu_used_percent > 90")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.SetRules([]*AlertRule{rule})
+
+	var mutex sync.Mutex
+	var received []constant.AlertStatus
+	done := make(chan struct{})
+	manager.SetAlertHandler(func(event AlertEvent) {
+		// a slow handler, such as a database insert, must not let the resolve overtake the firing
+		if event.Status == constant.AlertFiring {
+			time.Sleep(50 * time.Millisecond)
+		}
+		mutex.Lock()
+		received = append(received, event.Status)
+		if len(received) == 4 {
+			close(done)
+		}
+		mutex.Unlock()
+	})
+
+	start := time.Now()
+	for i, value := range []float64{95, 10, 99, 20} {
+		manager.evaluate(&MetricSample{
+			ServerID: 120,
+			Time:     start.Add(time.Duration(i) * time.Minute),
+			Points:   []MetricPoint{{Name: MetricCPUUsedPercent, Value: value}},
+		})
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not receive all events")
+	}
+	want := []constant.AlertStatus{constant.AlertFiring, constant.AlertResolved, constant.AlertFiring, constant.AlertResolved}
+	for i := range want {
+		if received[i] != want[i] {
+			t.Fatalf("events received as %v, want %v", received, want)
+		}
+	}
+}
+
+func TestStalledAlertHandlerDoesNotBlockEvaluation(t *testing.T) {
+	manager := &AlertManager{rules: make(map[uint]*AlertRule), states: make(map[alertKey]*alertState)}
+	rule, err := NewAlertRule(1, "cpu busy", 0, "", "cpu_used_percent > 90")
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager.SetRules([]*AlertRule{rule})
+	stalled := make(chan struct{})
+	defer close(stalled)
+	manager.SetAlertHandler(func(event AlertEvent) { <-stalled })
+
+	// more state changes than the queue holds, evaluation must neither block nor hold the lock
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		start := time.Now()
+		for i := 0; i < 2*alertQueueSize+10; i++ {
+			value := 10.0
+			if i%2 == 0 {
+				value = 95
+			}
+			manager.evaluate(&MetricSample{
+				ServerID: 121,
+				Time:     start.Add(time.Duration(i) * time.Minute),
+				Points:   []MetricPoint{{Name: MetricCPUUsedPercent, Value: value}},
+			})
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("evaluation blocked on a stalled alert handler")
+	}
+	manager.mutex.Lock()
+	queued := len(manager.queue)
+	manager.mutex.Unlock()
+	if queued > alertQueueSize {
+		t.Fatalf("%d events queued, limit is %d", queued, alertQueueSize)
+	}
+}
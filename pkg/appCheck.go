@@ -8,9 +8,11 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"github.com/spf13/viper"
 	"go.uber.org/zap"
 )
 
@@ -18,13 +20,20 @@ type AppCheckConfig struct {
 	ID              uint
 	ServerID        uint
 	Name            string
-	CheckType       constant.AppCheckType // pid, port, http
-	CheckTarget     string                // such as process name, port number, URL
+	CheckType       constant.AppCheckType // pid, port, http over SSH, tcp, http_native from GolangOM
+	CheckTarget     string                // such as process name, port number, URL, host:port
 	CheckInterval   int                   // check interval (seconds)
 	StartScript     string                // startup script path
+	RunAs           string                // user running check commands and start script, empty means the login user
+	Labels          map[string]string     // such as tier=frontend, matched by label selectors
+	HTTPCheck       *HTTPCheckSpec        // request and assertions of http and http_native checks, nil for a plain GET
 	LastCheckResult bool
-	AutoRestart     bool // whether to auto restart
+	LastCheckError  string // why the last check failed, empty if it passed
+	AutoRestart     bool   // whether to auto restart
 	LastCheckTime   time.Time
+	CheckDuration   time.Duration // time the last check took
+	RestartCount    int           // auto restarts since the checker started
+	RestartFailures int           // auto restarts whose start script failed
 	ctx             context.Context
 	cancel          context.CancelFunc
 }
@@ -88,6 +97,7 @@ func (app *AppCheckConfig) StartAppChecker() {
 	}
 
 	app.ctx, app.cancel = context.WithCancel(context.Background())
+	ctx := app.ctx
 
 	go func() {
 		ticker := time.NewTicker(time.Duration(app.CheckInterval) * time.Second)
@@ -95,22 +105,34 @@ func (app *AppCheckConfig) StartAppChecker() {
 		for {
 			app.LastCheckTime = time.Now()
 			isRunning := app.CheckAppStatus()
+			app.CheckDuration = time.Since(app.LastCheckTime)
+			// stopped while checking, the failure only means the check was canceled
+			if ctx.Err() != nil {
+				return
+			}
 
 			if !isRunning {
 				app.LastCheckResult = false
 				ws.SendMessage(ws.Message{
 					AppID:     app.ID,
 					AppStatus: app.LastCheckResult,
+					AppError:  app.LastCheckError,
 				})
-				logs.Logger.Warn("App not running", zap.String("app", app.Name))
+				logs.Logger.Warn("App not running", zap.String("app", app.Name), zap.String("reason", app.LastCheckError))
 				// if auto restart is enabled
 				if app.AutoRestart {
 					logs.Logger.Info("App restarting...", zap.String("app", app.Name))
+					app.RestartCount++
 					err := app.StartApp()
 					if err != nil {
+						app.RestartFailures++
 						logs.Logger.Error("App start error", zap.Error(err))
-						time.Sleep(time.Duration(app.CheckInterval) * time.Second)
-						continue
+						select {
+						case <-ctx.Done():
+							return
+						case <-time.After(time.Duration(app.CheckInterval) * time.Second):
+							continue
+						}
 					}
 					app.LastCheckResult = true
 					ws.SendMessage(ws.Message{
@@ -130,7 +152,7 @@ func (app *AppCheckConfig) StartAppChecker() {
 			}
 
 			select {
-			case <-app.ctx.Done():
+			case <-ctx.Done():
 				return
 			case <-ticker.C:
 				continue
@@ -145,40 +167,117 @@ func (app *AppCheckConfig) StopAppChecker() {
 	}
 }
 
+// check deadline: Server.CommandTimeout, capped at the check interval so a hanging check never overlaps the next one
+func (app *AppCheckConfig) checkContext() (context.Context, context.CancelFunc) {
+	parent := app.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	timeout := defaultCommandTimeout()
+	if interval := time.Duration(app.CheckInterval) * time.Second; interval > 0 && interval < timeout {
+		timeout = interval
+	}
+	return context.WithTimeout(parent, timeout)
+}
+
+// errCheckSkipped the check could not run, the last result stands
+var errCheckSkipped = errors.New("check skipped")
+
+// CheckAppStatus run the check, the reason of a failure is kept in LastCheckError
 func (app *AppCheckConfig) CheckAppStatus() bool {
+	err := app.checkAppStatus()
+	if errors.Is(err, errCheckSkipped) {
+		return app.LastCheckResult
+	}
+	if err != nil {
+		app.LastCheckError = err.Error()
+		return false
+	}
+	app.LastCheckError = ""
+	return true
+}
+
+func (app *AppCheckConfig) checkAppStatus() error {
+	ctx, cancel := app.checkContext()
+	defer cancel()
+	if isNativeCheck(app.CheckType) {
+		if err := app.checkNative(ctx); err != nil {
+			logs.Logger.Warn("app check failed",
+				zap.String("app", app.Name),
+				zap.String("check_type", string(app.CheckType)),
+				zap.String("target", app.CheckTarget),
+				zap.Error(err))
+			return err
+		}
+		return nil
+	}
+
 	server := GetConnectionPool().GetServerByID(app.ServerID)
 	if server == nil {
 		logs.Logger.Error("GetServerByID error", zap.Error(errors.New("server not exists")), zap.String("server_id", strconv.Itoa(int(app.ServerID))))
-		return false
+		return fmt.Errorf("server %d not exists", app.ServerID)
+	}
+
+	var cmd string
+	switch app.CheckType {
+	case constant.AppCheckTypePid:
+		cmd = fmt.Sprintf("ps -ef | grep %s | grep -v grep | awk '{print $2}'", app.CheckTarget)
+	case constant.AppCheckTypePort:
+		cmd = fmt.Sprintf("lsof -i :%s | grep LISTEN | awk '{print $2}'", app.CheckTarget)
+	case constant.AppCheckTypeHttp:
+		// HTTP check: use curl command to send the request, the assertions are evaluated here
+		cmd = app.HTTPCheck.curlCommand(app.CheckTarget)
+	default:
+		return fmt.Errorf("unknown check type %s", app.CheckType)
+	}
+
+	result, err := server.ExecuteCommandAs(ctx, cmd, app.RunAs)
+	if errors.Is(err, ErrSessionBusy) {
+		// the check did not run, keep the last result instead of reporting the app down
+		logs.Logger.Warn("app check skipped, no free SSH session", zap.String("app", app.Name), zap.Error(err))
+		return errCheckSkipped
+	}
+	if errors.Is(err, ErrConnectionBroken) {
+		// the server is unreachable, whether the app runs is unknown and restarting it would fail too
+		logs.Logger.Warn("app check skipped, server connection broken", zap.String("app", app.Name), zap.Error(err))
+		return errCheckSkipped
+	}
+	if err != nil {
+		logs.Logger.Error("ExecuteCommand error", zap.String("app", app.Name), zap.Error(err))
+		return err
+	}
+	if !result.Success() {
+		logs.Logger.Error("app check command failed",
+			zap.String("app", app.Name),
+			zap.Int("exit_status", result.ExitStatus),
+			zap.String("err out", result.Stderr))
+		return fmt.Errorf("check command failed: %s, err out: %s", result.exitDescription(), strings.TrimSpace(result.Stderr))
 	}
-	if app.CheckType == constant.AppCheckTypePid {
-		result, err := server.ExecuteCommand(fmt.Sprintf("ps -ef | grep %s | grep -v grep | awk '{print $2}'", app.CheckTarget))
+
+	switch app.CheckType {
+	case constant.AppCheckTypeHttp:
+		body, status, latency, err := parseCurlOutput(result.Stdout)
 		if err != nil {
-			logs.Logger.Error("ExecuteCommand error", zap.Error(err))
-			return false
+			return err
 		}
-		logs.Logger.Debug("app check result:", zap.String("pid", result))
-		return len(result) > 0
-	} else if app.CheckType == constant.AppCheckTypePort {
-		result, err := server.ExecuteCommand(fmt.Sprintf("lsof -i :%s | grep LISTEN | awk '{print $2}'", app.CheckTarget))
-		if err != nil {
-			logs.Logger.Error("ExecuteCommand error", zap.Error(err))
-			return false
+		logs.Logger.Debug("HTTP check result:", zap.Int("status_code", status), zap.Duration("latency", latency))
+		if err := app.HTTPCheck.evaluate(status, body, latency); err != nil {
+			logs.Logger.Warn("app check failed", zap.String("app", app.Name), zap.Error(err))
+			return err
 		}
-		logs.Logger.Debug("app check result:", zap.String("pid", result))
-		return len(result) > 0
-	} else if app.CheckType == constant.AppCheckTypeHttp {
-		// HTTP check: use curl command to check if URL is accessible
-		result, err := server.ExecuteCommand(fmt.Sprintf("curl -s -o /dev/null -w '%%{http_code}' %s", app.CheckTarget))
-		if err != nil {
-			logs.Logger.Error("HTTP check error", zap.Error(err))
-			return false
+		return nil
+	case constant.AppCheckTypePort:
+		logs.Logger.Debug("app check result:", zap.String("pid", result.Stdout))
+		if len(result.Stdout) == 0 {
+			return fmt.Errorf("nothing listens on port %s", app.CheckTarget)
+		}
+	default:
+		logs.Logger.Debug("app check result:", zap.String("pid", result.Stdout))
+		if len(result.Stdout) == 0 {
+			return fmt.Errorf("no process matches %s", app.CheckTarget)
 		}
-		logs.Logger.Debug("HTTP check result:", zap.String("status_code", result))
-		// check if HTTP status code is 2xx or 3xx
-		return len(result) > 0 && (result[0] == '2' || result[0] == '3')
 	}
-	return false
+	return nil
 }
 
 func (app *AppCheckConfig) StartApp() error {
@@ -186,9 +285,24 @@ func (app *AppCheckConfig) StartApp() error {
 	if server == nil {
 		return fmt.Errorf("server not exists")
 	}
-	_, err := server.ExecuteCommand(app.StartScript)
+
+	timeout := viper.GetInt("App.StartTimeout")
+	if timeout <= 0 {
+		timeout = 60
+	}
+	parent := app.ctx
+	if parent == nil {
+		parent = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(parent, time.Duration(timeout)*time.Second)
+	defer cancel()
+
+	result, err := server.ExecuteCommandAs(ctx, app.StartScript, app.RunAs)
 	if err != nil {
 		return err
 	}
+	if !result.Success() {
+		return fmt.Errorf("start script failed: %s, err out: %s", result.exitDescription(), result.Stderr)
+	}
 	return nil
 }
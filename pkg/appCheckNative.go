@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// at most this much of a response body is read and evaluated, the connection is closed after each check
+const nativeCheckBodyLimit = 1 << 20
+
+func newNativeCheckClient(skipVerify bool) *http.Client {
+	return &http.Client{
+		Transport: &http.Transport{
+			Proxy:             http.ProxyFromEnvironment,
+			DisableKeepAlives: true,
+			TLSClientConfig:   &tls.Config{InsecureSkipVerify: skipVerify},
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// clients of http_native checks, redirects are not followed so a 3xx counts like it does for curl,
+// keep-alives are off so every check makes a fresh connection
+var (
+	nativeCheckClient         = newNativeCheckClient(false)
+	nativeCheckInsecureClient = newNativeCheckClient(true)
+)
+
+// ValidateAppCheck check that target suits the check type, targets of the ssh check types are used as given
+func ValidateAppCheck(checkType constant.AppCheckType, target string) error {
+	switch checkType {
+	case constant.AppCheckTypePid, constant.AppCheckTypePort, constant.AppCheckTypeHttp:
+	case constant.AppCheckTypeTCP:
+		if _, err := strconv.ParseUint(target, 10, 16); err == nil {
+			return nil
+		}
+		if _, port, err := net.SplitHostPort(target); err != nil || port == "" {
+			return fmt.Errorf("tcp check target must be host:port or a port of the server")
+		}
+	case constant.AppCheckTypeHttpNative:
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("http_native check target must be an http or https URL")
+		}
+	default:
+		return fmt.Errorf("check type must be pid, port, http, tcp or http_native")
+	}
+	return nil
+}
+
+// native check types run in this process and need no SSH connection
+func isNativeCheck(checkType constant.AppCheckType) bool {
+	return checkType == constant.AppCheckTypeTCP || checkType == constant.AppCheckTypeHttpNative
+}
+
+// address dialed by a tcp check, a bare port is dialed on the address of the server
+func (app *AppCheckConfig) tcpCheckAddress() (string, error) {
+	if _, err := strconv.ParseUint(app.CheckTarget, 10, 16); err != nil {
+		return app.CheckTarget, nil
+	}
+	server := GetConnectionPool().GetServerByID(app.ServerID)
+	if server == nil {
+		return "", fmt.Errorf("server %d not exists", app.ServerID)
+	}
+	return net.JoinHostPort(server.IP, app.CheckTarget), nil
+}
+
+func (app *AppCheckConfig) checkNative(ctx context.Context) error {
+	switch app.CheckType {
+	case constant.AppCheckTypeTCP:
+		address, err := app.tcpCheckAddress()
+		if err != nil {
+			return err
+		}
+		var dialer net.Dialer
+		conn, err := dialer.DialContext(ctx, "tcp", address)
+		if err != nil {
+			return err
+		}
+		return conn.Close()
+	case constant.AppCheckTypeHttpNative:
+		spec := app.HTTPCheck
+		var body io.Reader
+		if spec != nil && spec.Body != "" {
+			body = strings.NewReader(spec.Body)
+		}
+		req, err := http.NewRequestWithContext(ctx, spec.method(), app.CheckTarget, body)
+		if err != nil {
+			return err
+		}
+		client := nativeCheckClient
+		if spec != nil {
+			for name, value := range spec.Headers {
+				req.Header.Set(name, value)
+			}
+			if host := req.Header.Get("Host"); host != "" {
+				req.Host = host
+			}
+			if spec.TLSSkipVerify {
+				client = nativeCheckInsecureClient
+			}
+		}
+
+		start := time.Now()
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		data, err := io.ReadAll(io.LimitReader(resp.Body, nativeCheckBodyLimit))
+		if err != nil && spec.needsBody() {
+			return fmt.Errorf("read body failed: %w", err)
+		}
+		return spec.evaluate(resp.StatusCode, data, time.Since(start))
+	}
+	return fmt.Errorf("unknown check type %s", app.CheckType)
+}
@@ -0,0 +1,221 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+// register a server whose commands run on a FakeExecutor, removed again when the test ends
+func addFakeServer(t *testing.T, id uint) *FakeExecutor {
+	t.Helper()
+	fake := NewFakeExecutor()
+	connectionPool.mutex.Lock()
+	connectionPool.servers[id] = &Server{ID: id, User: "deploy", Status: constant.Connected, Executor: fake}
+	connectionPool.mutex.Unlock()
+	t.Cleanup(func() {
+		connectionPool.mutex.Lock()
+		delete(connectionPool.servers, id)
+		connectionPool.mutex.Unlock()
+	})
+	return fake
+}
+
+func TestCheckAppStatusWithFakeExecutor(t *testing.T) {
+	const pidCmd = "ps -ef | grep nginx | grep -v grep | awk '{print $2}'"
+	const portCmd = "lsof -i :8080 | grep LISTEN | awk '{print $2}'"
+	tests := []struct {
+		name      string
+		checkType constant.AppCheckType
+		target    string
+		cmd       string
+		result    *CommandResult
+		err       error
+		want      bool
+		wantError string
+	}{
+		{"process running", constant.AppCheckTypePid, "nginx", pidCmd, &CommandResult{Stdout: "1234\n"}, nil, true, ""},
+		{"no process", constant.AppCheckTypePid, "nginx", pidCmd, &CommandResult{}, nil, false, "no process matches nginx"},
+		{"port listening", constant.AppCheckTypePort, "8080", portCmd, &CommandResult{Stdout: "99\n"}, nil, true, ""},
+		{"port closed", constant.AppCheckTypePort, "8080", portCmd, &CommandResult{}, nil, false, "nothing listens on port 8080"},
+		{"command failed", constant.AppCheckTypePort, "8080", portCmd, &CommandResult{ExitStatus: 2, Stderr: "lsof: not permitted\n"}, nil, false, "exit status 2, err out: lsof: not permitted"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := addFakeServer(t, 101)
+			if tt.err != nil {
+				fake.SetError(tt.cmd, tt.err)
+			} else {
+				fake.SetResult(tt.cmd, tt.result)
+			}
+			app := &AppCheckConfig{ServerID: 101, Name: "web", CheckType: tt.checkType, CheckTarget: tt.target, CheckInterval: 5, LastCheckResult: !tt.want}
+			if got := app.CheckAppStatus(); got != tt.want {
+				t.Fatalf("CheckAppStatus() = %v, want %v", got, tt.want)
+			}
+			if !strings.Contains(app.LastCheckError, tt.wantError) || (tt.wantError == "") != (app.LastCheckError == "") {
+				t.Fatalf("LastCheckError = %q, want %q", app.LastCheckError, tt.wantError)
+			}
+			if calls := fake.Calls(); len(calls) != 1 || calls[0] != tt.cmd {
+				t.Fatalf("calls = %q", calls)
+			}
+		})
+	}
+}
+
+func TestCheckAppStatusKeepsResultWhenSkipped(t *testing.T) {
+	fake := addFakeServer(t, 102)
+	for _, err := range []error{ErrSessionBusy, ErrConnectionBroken} {
+		fake.SetError("ps -ef | grep api | grep -v grep | awk '{print $2}'", err)
+		for _, last := range []bool{true, false} {
+			app := &AppCheckConfig{ServerID: 102, Name: "api", CheckType: constant.AppCheckTypePid, CheckTarget: "api", LastCheckResult: last, LastCheckError: "earlier"}
+			if got := app.CheckAppStatus(); got != last || app.LastCheckError != "earlier" {
+				t.Fatalf("%v: skipped check changed result %v to %v, error to %q", err, last, got, app.LastCheckError)
+			}
+		}
+	}
+}
+
+func TestStopAppCheckerWhileRestartFails(t *testing.T) {
+	fake := addFakeServer(t, 109)
+	fake.SetResult("ps -ef | grep api | grep -v grep | awk '{print $2}'", &CommandResult{})
+	fake.SetResult("/opt/api/start.sh", &CommandResult{ExitStatus: 1, Stderr: "missing config"})
+	app := &AppCheckConfig{ServerID: 109, Name: "api", CheckType: constant.AppCheckTypePid, CheckTarget: "api",
+		CheckInterval: 1, AutoRestart: true, StartScript: "/opt/api/start.sh"}
+
+	app.StartAppChecker()
+	deadline := time.Now().Add(time.Second)
+	for len(fake.Calls()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	app.StopAppChecker()
+	calls := len(fake.Calls())
+	if calls < 2 {
+		t.Fatalf("checker did not try to restart: %q", fake.Calls())
+	}
+	// the checker waits out the failed restart, it must return instead of checking again
+	time.Sleep(1500 * time.Millisecond)
+	if got := fake.Calls(); len(got) != calls {
+		t.Fatalf("stopped checker kept running: %q", got)
+	}
+}
+
+func TestCheckAppStatusMissingServer(t *testing.T) {
+	app := &AppCheckConfig{ServerID: 199, Name: "api", CheckType: constant.AppCheckTypePid, CheckTarget: "api", LastCheckResult: true}
+	if app.CheckAppStatus() || app.LastCheckError != "server 199 not exists" {
+		t.Fatalf("check on missing server: %q", app.LastCheckError)
+	}
+}
+
+func TestCheckAppStatusRunAs(t *testing.T) {
+	fake := addFakeServer(t, 103)
+	cmd := "ps -ef | grep worker | grep -v grep | awk '{print $2}'"
+	fake.SetResult("sudo -n -u 'app' -- /bin/sh -c "+shellQuote(cmd), &CommandResult{Stdout: "42\n"})
+	app := &AppCheckConfig{ServerID: 103, Name: "worker", CheckType: constant.AppCheckTypePid, CheckTarget: "worker", RunAs: "app"}
+	if !app.CheckAppStatus() {
+		t.Fatalf("check as app failed: %s, calls %q", app.LastCheckError, fake.Calls())
+	}
+
+	// the login user runs the command directly
+	fake.SetResult(cmd, &CommandResult{Stdout: "42\n"})
+	app.RunAs = "deploy"
+	if !app.CheckAppStatus() {
+		t.Fatalf("check as login user failed: %s", app.LastCheckError)
+	}
+}
+
+func TestStartAppWithFakeExecutor(t *testing.T) {
+	fake := addFakeServer(t, 104)
+	fake.SetResult("/opt/web/start.sh", &CommandResult{Stdout: "started\n"})
+	fake.SetResult("/opt/web/broken.sh", &CommandResult{ExitStatus: 1, Stderr: "missing config"})
+	fake.SetError("/opt/web/hang.sh", ErrConnectionBroken)
+
+	app := &AppCheckConfig{ServerID: 104, Name: "web", StartScript: "/opt/web/start.sh"}
+	if err := app.StartApp(); err != nil {
+		t.Fatal(err)
+	}
+	app.StartScript = "/opt/web/broken.sh"
+	if err := app.StartApp(); err == nil || !strings.Contains(err.Error(), "start script failed: exit status 1") {
+		t.Fatalf("broken start script: %v", err)
+	}
+	app.StartScript = "/opt/web/hang.sh"
+	if err := app.StartApp(); err != ErrConnectionBroken {
+		t.Fatalf("broken connection: %v", err)
+	}
+	app.ServerID = 198
+	if err := app.StartApp(); err == nil {
+		t.Fatal("started app on missing server")
+	}
+}
+
+func TestExecuteBatchWithFakeExecutor(t *testing.T) {
+	addFakeServer(t, 105).SetResult("uptime", &CommandResult{Stdout: "up 3 days\n"})
+	addFakeServer(t, 106).SetResult("uptime", &CommandResult{ExitStatus: 1, Stderr: "denied"})
+	addFakeServer(t, 107).SetError("uptime", ErrConnectionBroken)
+
+	results := GetConnectionPool().ExecuteBatch(context.Background(), NewBatchID(), "uptime", []uint{105, 106, 107, 197}, 2, 0)
+	if len(results) != 4 {
+		t.Fatalf("got %d results", len(results))
+	}
+	for i, id := range []uint{105, 106, 107, 197} {
+		if results[i].ServerID != id {
+			t.Fatalf("result %d is of server %d, want %d", i, results[i].ServerID, id)
+		}
+	}
+	if !results[0].Success || results[0].Stdout != "up 3 days\n" || results[0].ExitCode != 0 {
+		t.Errorf("succeeded server: %+v", results[0])
+	}
+	if results[1].Success || results[1].ExitCode != 1 || results[1].Stderr != "denied" || results[1].Error != "" {
+		t.Errorf("failed command: %+v", results[1])
+	}
+	if results[2].Success || results[2].ExitCode != -1 || results[2].Error == "" {
+		t.Errorf("broken connection: %+v", results[2])
+	}
+	if results[3].Error != "server not exists" {
+		t.Errorf("missing server: %+v", results[3])
+	}
+}
+
+func TestExecuteBatchCanceled(t *testing.T) {
+	fake := addFakeServer(t, 108)
+	fake.SetResult("uptime", &CommandResult{Stdout: "up 3 days\n"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results := GetConnectionPool().ExecuteBatch(ctx, NewBatchID(), "uptime", []uint{108}, 1, 0)
+	if results[0].Success || !strings.Contains(results[0].Error, "canceled") {
+		t.Fatalf("canceled batch: %+v", results[0])
+	}
+	if calls := fake.Calls(); len(calls) != 0 {
+		t.Fatalf("canceled batch ran %v", calls)
+	}
+}
+
+func TestValidBatchID(t *testing.T) {
+	for id, want := range map[string]bool{
+		"3f2a9c1e0b7d4a55":      true,
+		"deploy_web-01":         true,
+		"":                      false,
+		"a b":                   false,
+		"<script>":              false,
+		strings.Repeat("a", 65): false,
+	} {
+		if got := ValidBatchID(id); got != want {
+			t.Errorf("ValidBatchID(%q) = %v, want %v", id, got, want)
+		}
+	}
+}
+
+func TestFakeExecutorCanceled(t *testing.T) {
+	fake := NewFakeExecutor()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := fake.Execute(ctx, "true"); err == nil {
+		t.Fatal("canceled context ran the command")
+	}
+	result, err := fake.Execute(context.Background(), "unknown")
+	if err != nil || result.ExitStatus != 127 {
+		t.Fatalf("unknown command: %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,132 @@
+package pkg
+
+import (
+	"GolangOM/logs"
+	"GolangOM/ws"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// BatchResult result of a batch command on one server
+type BatchResult struct {
+	ServerID  uint
+	Stdout    string
+	Stderr    string
+	ExitCode  int    // -1 when the command did not run or exit normally
+	Signal    string // signal that killed the command
+	Truncated bool
+	Error     string // command result unknown: connection broken or timeout
+	Duration  time.Duration
+	Success   bool
+}
+
+// NewBatchID random ID used to match WebSocket progress messages with a batch request
+func NewBatchID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+var batchIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ValidBatchID batch ID chosen by the client, letters, digits, _ and - only, at most 64 characters
+func ValidBatchID(batchID string) bool {
+	return batchIDPattern.MatchString(batchID)
+}
+
+// ExecuteBatch run cmd on servers concurrently, at most parallelism at a time,
+// progress of every finished server is broadcast over WebSocket
+// results keep the order of serverIDs, timeout <= 0 means the default command timeout,
+// once ctx is done running commands are canceled and the remaining servers are not started
+func (c *ConnectionPool) ExecuteBatch(ctx context.Context, batchID string, cmd string, serverIDs []uint, parallelism int, timeout time.Duration) []BatchResult {
+	if timeout <= 0 {
+		timeout = defaultCommandTimeout()
+	}
+	maxParallelism := viper.GetInt("Batch.MaxParallelism")
+	if maxParallelism <= 0 {
+		maxParallelism = 10
+	}
+	if parallelism <= 0 || parallelism > maxParallelism {
+		parallelism = maxParallelism
+	}
+
+	results := make([]BatchResult, len(serverIDs))
+	semaphore := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	done := 0
+
+	for i, serverID := range serverIDs {
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			results[i] = c.executeOnServer(ctx, serverID, cmd, timeout)
+
+			mutex.Lock()
+			done++
+			progress := &ws.BatchProgress{
+				BatchID:  batchID,
+				ServerID: serverID,
+				ExitCode: results[i].ExitCode,
+				Success:  results[i].Success,
+				Done:     done,
+				Total:    len(serverIDs),
+			}
+			mutex.Unlock()
+			ws.SendMessage(ws.Message{Batch: progress})
+		}()
+	}
+	wg.Wait()
+
+	logs.Logger.Info("batch command finished",
+		zap.String("batch_id", batchID),
+		zap.String("cmd", cmd),
+		zap.Int("servers", len(serverIDs)))
+	return results
+}
+
+func (c *ConnectionPool) executeOnServer(ctx context.Context, serverID uint, cmd string, timeout time.Duration) BatchResult {
+	result := BatchResult{ServerID: serverID, ExitCode: -1}
+	if err := ctx.Err(); err != nil {
+		result.Error = "batch canceled: " + err.Error()
+		return result
+	}
+	server := c.GetServerByID(serverID)
+	if server == nil {
+		result.Error = "server not exists"
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	startTime := time.Now()
+	commandResult, err := server.ExecuteCommandContext(ctx, cmd)
+	result.Duration = time.Since(startTime)
+	if err != nil {
+		result.Error = err.Error()
+		logs.Logger.Debug("batch command failed on server",
+			zap.String("server_id", strconv.Itoa(int(serverID))),
+			zap.Error(err))
+		return result
+	}
+
+	result.Stdout = commandResult.Stdout
+	result.Stderr = commandResult.Stderr
+	result.ExitCode = commandResult.ExitStatus
+	result.Signal = commandResult.Signal
+	result.Truncated = commandResult.Truncated
+	result.Success = commandResult.Success()
+	return result
+}
@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// prompt printed by sudo, unique so command output is never mistaken for it
+const sudoPrompt = "[golang-om become password]"
+
+// promptOptions answer a password prompt of the command, such as sudo or su asking for a password
+type promptOptions struct {
+	pty    bool                     // run in a pseudo terminal, su reads passwords from the terminal only
+	match  func(output []byte) bool // output seen so far ends with the prompt
+	answer string
+}
+
+// promptExecutor executor able to answer prompts, executors without it run become commands non-interactively
+type promptExecutor interface {
+	executeWithPrompt(ctx context.Context, cmd string, prompt *promptOptions) (*CommandResult, error)
+}
+
+// watch output until the prompt shows up, then write the answer to stdin and close it
+// output before the prompt is dropped, everything after it goes to out
+func (p *promptOptions) watch(out io.Writer, stdin io.WriteCloser) *promptWatcher {
+	return &promptWatcher{out: out, stdin: stdin, options: p}
+}
+
+type promptWatcher struct {
+	out      io.Writer
+	stdin    io.WriteCloser
+	options  *promptOptions
+	pending  []byte
+	answered bool
+	mutex    sync.Mutex
+}
+
+func (w *promptWatcher) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.answered {
+		return w.out.Write(p)
+	}
+
+	w.pending = append(w.pending, p...)
+	if w.options.match(w.pending) {
+		w.answered = true
+		w.pending = nil
+		io.WriteString(w.stdin, w.options.answer+"\n")
+		w.stdin.Close()
+		return len(p), nil
+	}
+	// no prompt in the first output, the command did not ask for a password
+	// sudo may print a lecture before its prompt, su prompts on the first line
+	if len(w.pending) > 4096 || w.options.pty && bytes.IndexByte(w.pending, '\n') >= 0 {
+		w.flushLocked()
+	}
+	return len(p), nil
+}
+
+// flush output held back while waiting for the prompt, called once the command exited
+func (w *promptWatcher) flush() {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.flushLocked()
+}
+
+func (w *promptWatcher) flushLocked() {
+	w.answered = true
+	if len(w.pending) > 0 {
+		w.out.Write(w.pending)
+		w.pending = nil
+	}
+}
+
+// becomeExecutor runs commands as another user through sudo or su of the login user
+type becomeExecutor struct {
+	base     Executor
+	method   constant.BecomeMethod
+	user     string
+	password string
+}
+
+func (e becomeExecutor) Execute(ctx context.Context, cmd string) (*CommandResult, error) {
+	base, interactive := e.base.(promptExecutor)
+	if !interactive || e.password == "" {
+		// no password to answer with, fail instead of waiting for a prompt
+		if e.method == constant.BecomeSu {
+			return nil, fmt.Errorf("su requires a become password")
+		}
+		return e.base.Execute(ctx, "sudo -n -u "+shellQuote(e.user)+" -- /bin/sh -c "+shellQuote(cmd))
+	}
+
+	switch e.method {
+	case constant.BecomeSu:
+		return base.executeWithPrompt(ctx, "su -s /bin/sh "+shellQuote(e.user)+" -c "+shellQuote(cmd), &promptOptions{
+			pty:    true,
+			match:  matchPasswordPrompt,
+			answer: e.password,
+		})
+	default:
+		return base.executeWithPrompt(ctx, "sudo -S -p "+shellQuote(sudoPrompt)+" -u "+shellQuote(e.user)+" -- /bin/sh -c "+shellQuote(cmd), &promptOptions{
+			match: func(output []byte) bool {
+				return bytes.Contains(output, []byte(sudoPrompt))
+			},
+			answer: e.password,
+		})
+	}
+}
+
+// su prompt is localized, such as "Password:" or "密码：", so match the trailing colon
+func matchPasswordPrompt(output []byte) bool {
+	output = bytes.TrimRight(output, " \t")
+	return bytes.HasSuffix(output, []byte(":")) || bytes.HasSuffix(output, []byte("："))
+}
+
+// ExecuteCommandAs execute command as user through the become method of server,
+// empty user or the login user runs the command directly
+func (s *Server) ExecuteCommandAs(ctx context.Context, cmd string, user string) (*CommandResult, error) {
+	if user == "" || user == s.User {
+		return s.ExecuteCommandContext(ctx, cmd)
+	}
+	method := s.BecomeMethod
+	if method == "" {
+		method = constant.BecomeSudo
+	}
+	return becomeExecutor{
+		base:     s.executor(),
+		method:   method,
+		user:     user,
+		password: s.BecomePassword,
+	}.Execute(ctx, cmd)
+}
@@ -0,0 +1,91 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// ErrConnectionBroken command could not run because the server connection is unusable,
+// as opposed to a command that ran and exited with a non-zero status
+var ErrConnectionBroken = errors.New("connection broken")
+
+// CommandResult structured result of a finished command
+type CommandResult struct {
+	Stdout     string
+	Stderr     string
+	ExitStatus int    // -1 if the command was killed by a signal or the status is unknown
+	Signal     string // signal that terminated the command, such as KILL
+	Duration   time.Duration
+	Truncated  bool // stdout or stderr exceeded Server.MaxCommandOutput and was cut
+}
+
+// Success command exited with status 0
+func (r *CommandResult) Success() bool {
+	return r.ExitStatus == 0 && r.Signal == ""
+}
+
+func (r *CommandResult) exitDescription() string {
+	if r.Signal != "" {
+		return "killed by signal " + r.Signal
+	}
+	return "exit status " + strconv.Itoa(r.ExitStatus)
+}
+
+// default timeout of ExecuteCommand, in seconds
+func defaultCommandTimeout() time.Duration {
+	timeout := viper.GetInt("Server.CommandTimeout")
+	if timeout <= 0 {
+		timeout = 30
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// maximum bytes kept from each of stdout and stderr
+func maxCommandOutput() int {
+	size := viper.GetInt("Server.MaxCommandOutput")
+	if size <= 0 {
+		size = 1024
+	}
+	return size * 1024
+}
+
+// limitedBuffer keeps the first limit bytes written and remembers whether more was dropped
+type limitedBuffer struct {
+	buf       []byte
+	limit     int
+	truncated bool
+	mutex     sync.Mutex
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if room := b.limit - len(b.buf); room < len(p) {
+		b.truncated = true
+		if room > 0 {
+			b.buf = append(b.buf, p[:room]...)
+		}
+		// report full write so the command is not broken by a short write
+		return len(p), nil
+	}
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+func (b *limitedBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return string(b.buf)
+}
+
+// ExecuteCommandContext execute command until it exits or ctx is done
+// a non-nil error means the command result is unknown: connection broken (ErrConnectionBroken)
+// or ctx cancelled (context error); a command that ran but failed returns a result with non-zero ExitStatus
+func (s *Server) ExecuteCommandContext(ctx context.Context, cmd string) (*CommandResult, error) {
+	return s.executor().Execute(ctx, cmd)
+}
@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// Executor runs a shell command line on some backend and reports its result,
+// errors follow ExecuteCommandContext: non-nil only when the command result is unknown
+type Executor interface {
+	Execute(ctx context.Context, cmd string) (*CommandResult, error)
+}
+
+// executor of server, Server.Executor if set, otherwise the local shell or SSH
+func (s *Server) executor() Executor {
+	if s.Executor != nil {
+		return s.Executor
+	}
+	if s.ID == constant.LocalServerID {
+		return LocalExecutor{}
+	}
+	return sshExecutor{server: s}
+}
+
+// sshExecutor runs commands in a new session of the pooled SSH client,
+// the client is read on every call so reconnects are picked up
+type sshExecutor struct {
+	server *Server
+}
+
+func (e sshExecutor) Execute(ctx context.Context, cmd string) (*CommandResult, error) {
+	return e.executeWithPrompt(ctx, cmd, nil)
+}
+
+func (e sshExecutor) executeWithPrompt(ctx context.Context, cmd string, prompt *promptOptions) (*CommandResult, error) {
+	client, release, err := e.server.AcquireClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
+
+	// create new session, waits while the server's sessions are all in use
+	session, releaseSession, err := e.server.openSession(ctx, client)
+	if errors.Is(err, ErrSessionBusy) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: create session failed: %v", ErrConnectionBroken, err)
+	}
+	defer releaseSession()
+	defer session.Close() // ensure session is closed
+
+	// capture command output
+	stdout := &limitedBuffer{limit: maxCommandOutput()}
+	stderr := &limitedBuffer{limit: maxCommandOutput()}
+	session.Stdout = stdout
+	session.Stderr = stderr
+
+	var watcher *promptWatcher
+	if prompt != nil {
+		if prompt.pty {
+			// no echo, so the answer does not show up in the output
+			modes := ssh.TerminalModes{ssh.ECHO: 0}
+			if err := session.RequestPty("dumb", 40, 200, modes); err != nil {
+				return nil, fmt.Errorf("%w: request pty failed: %v", ErrConnectionBroken, err)
+			}
+		}
+		stdin, err := session.StdinPipe()
+		if err != nil {
+			return nil, fmt.Errorf("%w: open stdin failed: %v", ErrConnectionBroken, err)
+		}
+		if prompt.pty {
+			// pty merges stderr into stdout
+			watcher = prompt.watch(stdout, stdin)
+			session.Stdout = watcher
+		} else {
+			watcher = prompt.watch(stderr, stdin)
+			session.Stderr = watcher
+		}
+	}
+
+	startTime := time.Now()
+	if err := session.Start(cmd); err != nil {
+		return nil, fmt.Errorf("%w: start command failed: %v", ErrConnectionBroken, err)
+	}
+
+	waitDone := make(chan error, 1)
+	go func() {
+		waitDone <- session.Wait()
+	}()
+
+	var waitErr error
+	select {
+	case waitErr = <-waitDone:
+	case <-ctx.Done():
+		// kill remote command, then close session so Wait returns even if the server ignores the signal
+		if err := session.Signal(ssh.SIGKILL); err != nil {
+			logs.Logger.Warn("execute command failed: overtime ",
+				zap.String("server_id", strconv.Itoa(int(e.server.ID))),
+				zap.String("cmd", cmd),
+				zap.Error(err))
+		}
+		session.Close()
+		<-waitDone
+		return nil, fmt.Errorf("execute command canceled: %w", ctx.Err())
+	}
+
+	if watcher != nil {
+		watcher.flush()
+	}
+	result := &CommandResult{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Duration:  time.Since(startTime),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+
+	var exitErr *ssh.ExitError
+	var missingErr *ssh.ExitMissingError
+	switch {
+	case waitErr == nil:
+	case errors.As(waitErr, &exitErr):
+		result.ExitStatus = exitErr.ExitStatus()
+		result.Signal = exitErr.Signal()
+		if result.Signal != "" {
+			result.ExitStatus = -1
+		}
+	case errors.As(waitErr, &missingErr):
+		// channel closed without exit status, usually the connection dropped
+		return nil, fmt.Errorf("%w: %v", ErrConnectionBroken, waitErr)
+	default:
+		return nil, fmt.Errorf("%w: %v", ErrConnectionBroken, waitErr)
+	}
+
+	logs.Logger.Debug("command executed",
+		zap.String("server_id", strconv.Itoa(int(e.server.ID))),
+		zap.String("cmd", cmd),
+		zap.Int("exit_status", result.ExitStatus),
+		zap.Duration("time used", result.Duration),
+		zap.Int("out string length", len(result.Stdout)),
+		zap.Int("err string length", len(result.Stderr)))
+	return result, nil
+}
+
+// LocalExecutor runs commands through the local shell, so pipes, arguments and quoting work
+// as they do over SSH
+type LocalExecutor struct{}
+
+// how long output is still read after the shell exits, a process started in the background
+// (nohup ./app &) keeps the output pipes open and must not hold the command forever
+const localWaitDelay = 2 * time.Second
+
+func (e LocalExecutor) Execute(ctx context.Context, cmd string) (*CommandResult, error) {
+	return e.executeWithPrompt(ctx, cmd, nil)
+}
+
+func (LocalExecutor) executeWithPrompt(ctx context.Context, cmd string, prompt *promptOptions) (*CommandResult, error) {
+	stdout := &limitedBuffer{limit: maxCommandOutput()}
+	stderr := &limitedBuffer{limit: maxCommandOutput()}
+	command := localShellCommand(ctx, cmd)
+	command.Stdout = stdout
+	command.Stderr = stderr
+
+	var watcher *promptWatcher
+	if prompt != nil {
+		if prompt.pty {
+			return nil, fmt.Errorf("terminal prompts are not supported on local server")
+		}
+		stdin, err := command.StdinPipe()
+		if err != nil {
+			return nil, err
+		}
+		watcher = prompt.watch(stderr, stdin)
+		command.Stderr = watcher
+	}
+
+	startTime := time.Now()
+	err := command.Run()
+	if errors.Is(err, exec.ErrWaitDelay) {
+		// the shell succeeded, only a background process still held the output
+		err = nil
+	}
+	if ctx.Err() != nil {
+		return nil, fmt.Errorf("execute command canceled: %w", ctx.Err())
+	}
+
+	if watcher != nil {
+		watcher.flush()
+	}
+	result := &CommandResult{
+		Stdout:    stdout.String(),
+		Stderr:    stderr.String(),
+		Duration:  time.Since(startTime),
+		Truncated: stdout.truncated || stderr.truncated,
+	}
+
+	var exitErr *exec.ExitError
+	if err != nil {
+		if !errors.As(err, &exitErr) {
+			// command could not be started at all, such as not found
+			result.ExitStatus = 127
+			result.Stderr = err.Error()
+			return result, nil
+		}
+		result.ExitStatus = exitErr.ExitCode()
+		if state := exitErr.ProcessState.String(); strings.HasPrefix(state, "signal: ") {
+			result.Signal = strings.TrimPrefix(state, "signal: ")
+		}
+	}
+
+	logs.Logger.Debug("local command executed",
+		zap.String("cmd", cmd),
+		zap.Int("exit_status", result.ExitStatus),
+		zap.Duration("time used", result.Duration),
+		zap.Int("out length", len(result.Stdout)))
+	return result, nil
+}
@@ -0,0 +1,228 @@
+package pkg
+
+import (
+	"GolangOM/logs"
+	"bufio"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// HostFacts what a server is, gathered when it connects
+type HostFacts struct {
+	Hostname      string
+	Distro        string // ID of /etc/os-release, such as ubuntu or centos
+	DistroVersion string // VERSION_ID of /etc/os-release
+	OSName        string // PRETTY_NAME of /etc/os-release, such as Ubuntu 22.04.4 LTS
+	Kernel        string
+	Arch          string
+	CPUCount      int
+	MemoryTotal   uint64 // bytes
+	Uptime        time.Duration
+	Filesystems   []Filesystem
+	IPs           []string // global addresses, without prefix length
+	CollectedAt   time.Time
+}
+
+// Filesystem mounted file system, sizes in bytes
+type Filesystem struct {
+	Device string
+	Type   string
+	Mount  string
+	Size   uint64
+	Used   uint64
+}
+
+// section marker of the facts script output
+const factsMarker = "==golang-om-facts:"
+
+// POSIX shell script printing every fact in its own section, missing tools leave the section empty
+var factsScript = strings.Join([]string{
+	"echo '" + factsMarker + "hostname'; hostname 2>/dev/null || uname -n",
+	"echo '" + factsMarker + "os-release'; cat /etc/os-release 2>/dev/null",
+	"echo '" + factsMarker + "kernel'; uname -r",
+	"echo '" + factsMarker + "arch'; uname -m",
+	"echo '" + factsMarker + "cpu'; getconf _NPROCESSORS_ONLN 2>/dev/null || nproc 2>/dev/null",
+	"echo '" + factsMarker + "meminfo'; cat /proc/meminfo 2>/dev/null",
+	"echo '" + factsMarker + "uptime'; cat /proc/uptime 2>/dev/null",
+	"echo '" + factsMarker + "df'; df -PkT 2>/dev/null || df -Pk 2>/dev/null",
+	"echo '" + factsMarker + "ips'; if command -v ip >/dev/null 2>&1; then ip -o addr show scope global | awk '{print $4}'; else hostname -I 2>/dev/null | tr ' ' '\\n'; fi",
+	"true",
+}, "\n")
+
+// pseudo file systems left out of facts
+var ignoredFilesystemTypes = map[string]bool{
+	"tmpfs":    true,
+	"devtmpfs": true,
+	"squashfs": true,
+	"efivarfs": true,
+	"devfs":    true,
+}
+
+// CollectFacts run the facts script on server and parse its output
+func (s *Server) CollectFacts(ctx context.Context) (*HostFacts, error) {
+	result, err := s.ExecuteCommandContext(ctx, factsScript)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Success() {
+		return nil, fmt.Errorf("collect facts failed: %s, err out: %s", result.exitDescription(), result.Stderr)
+	}
+	facts := parseFacts(result.Stdout)
+	facts.CollectedAt = time.Now()
+	return facts, nil
+}
+
+// split script output into sections, each starting with a line of marker followed by the section name
+func splitSections(output string, marker string) map[string][]string {
+	sections := make(map[string][]string)
+	var current string
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if name, ok := strings.CutPrefix(line, marker); ok {
+			current = name
+			continue
+		}
+		if current != "" && strings.TrimSpace(line) != "" {
+			sections[current] = append(sections[current], line)
+		}
+	}
+	return sections
+}
+
+func firstLine(lines []string) string {
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.TrimSpace(lines[0])
+}
+
+func parseFacts(output string) *HostFacts {
+	sections := splitSections(output, factsMarker)
+	facts := &HostFacts{
+		Hostname: firstLine(sections["hostname"]),
+		Kernel:   firstLine(sections["kernel"]),
+		Arch:     firstLine(sections["arch"]),
+	}
+	facts.CPUCount, _ = strconv.Atoi(firstLine(sections["cpu"]))
+
+	for _, line := range sections["os-release"] {
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			continue
+		}
+		value = strings.Trim(value, `"'`)
+		switch key {
+		case "ID":
+			facts.Distro = value
+		case "VERSION_ID":
+			facts.DistroVersion = value
+		case "PRETTY_NAME":
+			facts.OSName = value
+		}
+	}
+
+	for _, line := range sections["meminfo"] {
+		// MemTotal:       16318412 kB
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "MemTotal:" {
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			facts.MemoryTotal = kb * 1024
+		}
+	}
+
+	// seconds since boot, then idle seconds
+	if fields := strings.Fields(firstLine(sections["uptime"])); len(fields) > 0 {
+		if seconds, err := strconv.ParseFloat(fields[0], 64); err == nil {
+			facts.Uptime = time.Duration(seconds) * time.Second
+		}
+	}
+
+	facts.Filesystems = parseDf(sections["df"])
+
+	for _, line := range sections["ips"] {
+		ip, _, _ := strings.Cut(strings.TrimSpace(line), "/")
+		if ip != "" {
+			facts.IPs = append(facts.IPs, ip)
+		}
+	}
+	return facts
+}
+
+// parse df -P output in 1K blocks, with a Type column if df supports -T
+func parseDf(lines []string) []Filesystem {
+	if len(lines) < 2 {
+		return nil
+	}
+	withType := len(strings.Fields(lines[0])) > 1 && strings.Fields(lines[0])[1] == "Type"
+	columns := 6
+	if withType {
+		columns = 7
+	}
+
+	filesystems := make([]Filesystem, 0, len(lines)-1)
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < columns {
+			continue
+		}
+		fs := Filesystem{Device: fields[0]}
+		sizes := fields[1:]
+		if withType {
+			fs.Type = fields[1]
+			sizes = fields[2:]
+		}
+		if ignoredFilesystemTypes[fs.Type] || ignoredFilesystemTypes[fs.Device] {
+			continue
+		}
+		size, _ := strconv.ParseUint(sizes[0], 10, 64)
+		used, _ := strconv.ParseUint(sizes[1], 10, 64)
+		fs.Size = size * 1024
+		fs.Used = used * 1024
+		// mount point may contain spaces
+		fs.Mount = strings.Join(fields[columns-1:], " ")
+		filesystems = append(filesystems, fs)
+	}
+	return filesystems
+}
+
+// SetFactsHandler handler called with the facts of a server after every collection, such as persisting them
+func (c *ConnectionPool) SetFactsHandler(handler func(serverID uint, facts *HostFacts)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.factsHandler = handler
+}
+
+// RefreshFacts collect facts of server and pass them to the facts handler
+func (c *ConnectionPool) RefreshFacts(ctx context.Context, server *Server) (*HostFacts, error) {
+	facts, err := server.CollectFacts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.RLock()
+	handler := c.factsHandler
+	c.mutex.RUnlock()
+	if handler != nil {
+		handler(server.ID, facts)
+	}
+	return facts, nil
+}
+
+// collect facts in the background after server connected
+func (c *ConnectionPool) refreshFactsAsync(server *Server) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout())
+		defer cancel()
+		if _, err := c.RefreshFacts(ctx, server); err != nil {
+			logs.Logger.Warn("collect host facts failed",
+				zap.String("server_id", strconv.Itoa(int(server.ID))),
+				zap.Error(err))
+		}
+	}()
+}
@@ -0,0 +1,63 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// FakeExecutor in-memory Executor returning scripted results, for tests and dry runs
+// set it as Server.Executor to check app status without a real server
+type FakeExecutor struct {
+	results map[string]*CommandResult
+	errors  map[string]error
+	calls   []string
+	mutex   sync.Mutex
+}
+
+func NewFakeExecutor() *FakeExecutor {
+	return &FakeExecutor{
+		results: make(map[string]*CommandResult),
+		errors:  make(map[string]error),
+	}
+}
+
+// SetResult result returned when cmd is executed
+func (f *FakeExecutor) SetResult(cmd string, result *CommandResult) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.results[cmd] = result
+}
+
+// SetError error returned when cmd is executed, such as ErrConnectionBroken
+func (f *FakeExecutor) SetError(cmd string, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.errors[cmd] = err
+}
+
+// Calls commands executed so far, in order
+func (f *FakeExecutor) Calls() []string {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+// Execute unknown commands exit with status 127 like a shell
+func (f *FakeExecutor) Execute(ctx context.Context, cmd string) (*CommandResult, error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.calls = append(f.calls, cmd)
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("execute command canceled: %w", err)
+	}
+	if err, ok := f.errors[cmd]; ok {
+		return nil, err
+	}
+	if result, ok := f.results[cmd]; ok {
+		copied := *result
+		return &copied, nil
+	}
+	return &CommandResult{ExitStatus: 127, Stderr: cmd + ": command not found"}, nil
+}
@@ -0,0 +1,145 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// FileInfo file entry returned by the file browser
+type FileInfo struct {
+	Name    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	IsDir   bool
+}
+
+// FileSystem file operations on a managed server, paths are absolute paths on that server
+type FileSystem interface {
+	Stat(path string) (*FileInfo, error)
+	ReadDir(path string) ([]FileInfo, error)
+	Open(path string) (io.ReadCloser, error)
+	Create(path string) (io.WriteCloser, error)
+	Mkdir(path string) error
+	Rename(oldPath string, newPath string) error
+	Remove(path string) error // file or empty directory
+	Chmod(path string, mode os.FileMode) error
+	Close() error
+}
+
+// OpenFileSystem open file system of server, SFTP over the pooled client for remote servers
+// and the local file system for the local server, caller must close it
+func (s *Server) OpenFileSystem() (FileSystem, error) {
+	if s.ID == constant.LocalServerID {
+		return localFileSystem{}, nil
+	}
+
+	client, release, err := s.AcquireClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	session, releaseSession, err := s.openSession(context.Background(), client)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("create session failed: %w", err)
+	}
+	fs, err := newSftpClient(session)
+	if err != nil {
+		releaseSession()
+		release()
+		return nil, err
+	}
+	// connection and session slot stay in use until the file system is closed
+	fs.release = func() {
+		releaseSession()
+		release()
+	}
+	return fs, nil
+}
+
+// SortFiles directories first, then by name
+func SortFiles(files []FileInfo) {
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].IsDir != files[j].IsDir {
+			return files[i].IsDir
+		}
+		return files[i].Name < files[j].Name
+	})
+}
+
+func baseName(p string) string {
+	return path.Base(p)
+}
+
+type localFileSystem struct{}
+
+func localFileInfo(info os.FileInfo) FileInfo {
+	return FileInfo{
+		Name:    info.Name(),
+		Size:    info.Size(),
+		Mode:    info.Mode(),
+		ModTime: info.ModTime(),
+		IsDir:   info.IsDir(),
+	}
+}
+
+func (localFileSystem) Stat(p string) (*FileInfo, error) {
+	info, err := os.Stat(filepath.FromSlash(p))
+	if err != nil {
+		return nil, err
+	}
+	result := localFileInfo(info)
+	return &result, nil
+}
+
+func (localFileSystem) ReadDir(p string) ([]FileInfo, error) {
+	entries, err := os.ReadDir(filepath.FromSlash(p))
+	if err != nil {
+		return nil, err
+	}
+	files := make([]FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			// entry removed while listing
+			continue
+		}
+		files = append(files, localFileInfo(info))
+	}
+	return files, nil
+}
+
+func (localFileSystem) Open(p string) (io.ReadCloser, error) {
+	return os.Open(filepath.FromSlash(p))
+}
+
+func (localFileSystem) Create(p string) (io.WriteCloser, error) {
+	return os.Create(filepath.FromSlash(p))
+}
+
+func (localFileSystem) Mkdir(p string) error {
+	return os.Mkdir(filepath.FromSlash(p), 0755)
+}
+
+func (localFileSystem) Rename(oldPath string, newPath string) error {
+	return os.Rename(filepath.FromSlash(oldPath), filepath.FromSlash(newPath))
+}
+
+func (localFileSystem) Remove(p string) error {
+	return os.Remove(filepath.FromSlash(p))
+}
+
+func (localFileSystem) Chmod(p string, mode os.FileMode) error {
+	return os.Chmod(filepath.FromSlash(p), mode)
+}
+
+func (localFileSystem) Close() error {
+	return nil
+}
@@ -0,0 +1,402 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// retry interval of a forward whose server is not connected, a reconnect of the server retries at once
+const forwardRetryInterval = 10 * time.Second
+
+// listen failures on this host are not retried, the address is usually in use
+var errForwardListen = errors.New("forward listen failed")
+
+// ForwardConfig port forward through the pooled SSH connection of a server
+type ForwardConfig struct {
+	ID       uint
+	ServerID uint
+	Name     string
+	Type     constant.ForwardType // local or remote
+	Listen   string               // local: address on this host, remote: address on the server, such as 127.0.0.1:15432
+	Target   string               // local: address dialed from the server, remote: address dialed from this host
+}
+
+// ValidateForwardConfig check type and addresses of a forward before it is saved
+func ValidateForwardConfig(config *ForwardConfig) error {
+	if config.ServerID == constant.LocalServerID {
+		return fmt.Errorf("port forwarding needs an SSH server, not the local server")
+	}
+	if config.Type != constant.ForwardLocal && config.Type != constant.ForwardRemote {
+		return fmt.Errorf("forward type must be local or remote")
+	}
+	for _, addr := range []string{config.Listen, config.Target} {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("invalid address %q, expected host:port", addr)
+		}
+		if number, err := strconv.Atoi(port); err != nil || number <= 0 || number > 65535 {
+			return fmt.Errorf("invalid port in %q", addr)
+		}
+		if addr == config.Target && host == "" {
+			return fmt.Errorf("target %q needs a host", addr)
+		}
+	}
+	return nil
+}
+
+// ForwardStats state and traffic of a forward, counters start at zero whenever the forward is started
+type ForwardStats struct {
+	Status          constant.ForwardStatus
+	LastError       string    // why the forward is waiting, empty when running
+	StartedAt       time.Time // when the tunnel was last established
+	Reestablished   int       // times the tunnel was re-established after the connection was lost
+	ActiveConns     int64
+	TotalConns      uint64
+	FailedConns     uint64 // connections whose target could not be dialed
+	BytesToTarget   uint64
+	BytesFromTarget uint64
+}
+
+// Forward running port forward, re-established whenever its server reconnects
+type Forward struct {
+	config ForwardConfig
+	mutex  sync.Mutex
+	stats  ForwardStats // Status, LastError, StartedAt and Reestablished, guarded by mutex
+
+	activeConns     atomic.Int64
+	totalConns      atomic.Uint64
+	failedConns     atomic.Uint64
+	bytesToTarget   atomic.Uint64
+	bytesFromTarget atomic.Uint64
+
+	wake   chan struct{} // server reconnected, try again now
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Stats snapshot of state and counters
+func (f *Forward) Stats() ForwardStats {
+	f.mutex.Lock()
+	stats := f.stats
+	f.mutex.Unlock()
+	stats.ActiveConns = f.activeConns.Load()
+	stats.TotalConns = f.totalConns.Load()
+	stats.FailedConns = f.failedConns.Load()
+	stats.BytesToTarget = f.bytesToTarget.Load()
+	stats.BytesFromTarget = f.bytesFromTarget.Load()
+	return stats
+}
+
+func (f *Forward) setStatus(status constant.ForwardStatus, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if status == constant.ForwardRunning {
+		if !f.stats.StartedAt.IsZero() {
+			f.stats.Reestablished++
+		}
+		f.stats.StartedAt = time.Now()
+	}
+	f.stats.Status = status
+	f.stats.LastError = ""
+	if err != nil {
+		f.stats.LastError = err.Error()
+	}
+}
+
+// ForwardManager running port forwards by forward ID
+type ForwardManager struct {
+	mutex    sync.RWMutex
+	forwards map[uint]*Forward
+}
+
+var forwardManager = ForwardManager{
+	forwards: make(map[uint]*Forward),
+}
+
+func GetForwardManager() *ForwardManager {
+	return &forwardManager
+}
+
+// Start open the forward and keep it open until Stop
+// if the server is not connected the forward waits for it, only a failed listen on this host is returned
+func (m *ForwardManager) Start(config ForwardConfig) error {
+	if err := ValidateForwardConfig(&config); err != nil {
+		return err
+	}
+	m.mutex.Lock()
+	if m.forwards[config.ID] != nil {
+		m.mutex.Unlock()
+		return fmt.Errorf("forward already running")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	forward := &Forward{
+		config: config,
+		stats:  ForwardStats{Status: constant.ForwardWaiting},
+		wake:   make(chan struct{}, 1),
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	m.forwards[config.ID] = forward
+	m.mutex.Unlock()
+
+	first := make(chan error, 1)
+	go forward.run(ctx, first)
+	if err := <-first; errors.Is(err, errForwardListen) {
+		m.Stop(config.ID)
+		return err
+	}
+	return nil
+}
+
+// Stop close the forward and its connections, false if it was not running
+func (m *ForwardManager) Stop(forwardID uint) bool {
+	m.mutex.Lock()
+	forward := m.forwards[forwardID]
+	delete(m.forwards, forwardID)
+	m.mutex.Unlock()
+	if forward == nil {
+		return false
+	}
+	forward.cancel()
+	<-forward.done
+	return true
+}
+
+// StopServer stop all forwards of a deleted server
+func (m *ForwardManager) StopServer(serverID uint) {
+	for _, forward := range m.GetForwards() {
+		if forward.config.ServerID == serverID {
+			m.Stop(forward.config.ID)
+		}
+	}
+}
+
+// GetForward running forward, nil if it is stopped
+func (m *ForwardManager) GetForward(forwardID uint) *Forward {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.forwards[forwardID]
+}
+
+func (m *ForwardManager) GetForwards() []*Forward {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	forwards := make([]*Forward, 0, len(m.forwards))
+	for _, forward := range m.forwards {
+		forwards = append(forwards, forward)
+	}
+	return forwards
+}
+
+// wake forwards of a server that just connected
+func (m *ForwardManager) serverConnected(serverID uint) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	for _, forward := range m.forwards {
+		if forward.config.ServerID != serverID {
+			continue
+		}
+		select {
+		case forward.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// establish the tunnel again every time it is lost, the result of the first attempt is sent to first
+func (f *Forward) run(ctx context.Context, first chan<- error) {
+	defer close(f.done)
+	defer f.setStatus(constant.ForwardStopped, nil)
+
+	for {
+		err := f.serve(ctx, func() {
+			if first != nil {
+				first <- nil
+				first = nil
+			}
+		})
+		if first != nil {
+			// the first attempt failed before the tunnel came up
+			first <- err
+			first = nil
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		f.setStatus(constant.ForwardWaiting, err)
+		logs.Logger.Warn("port forward waiting for server",
+			zap.String("forward", f.config.Name),
+			zap.String("server_id", strconv.Itoa(int(f.config.ServerID))),
+			zap.Error(err))
+
+		timer := time.NewTimer(forwardRetryInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-f.wake:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// open the tunnel and forward connections until the SSH connection is lost or ctx is done,
+// established is called once the tunnel is up
+func (f *Forward) serve(ctx context.Context, established func()) error {
+	connectionPool.mutex.RLock()
+	server := connectionPool.servers[f.config.ServerID]
+	connectionPool.mutex.RUnlock()
+	if server == nil {
+		return fmt.Errorf("%w: server not exists", ErrConnectionBroken)
+	}
+
+	// the forward holds the client, so a lazy connection is not closed while the forward runs
+	client, release, err := server.AcquireClient(ctx)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	listener, err := f.listen(client)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	f.setStatus(constant.ForwardRunning, nil)
+	established()
+	logs.Logger.Info("port forward established",
+		zap.String("forward", f.config.Name),
+		zap.String("type", string(f.config.Type)),
+		zap.String("listen", f.config.Listen),
+		zap.String("target", f.config.Target))
+
+	// close the listener and every connection once the client is gone or the forward stops
+	serveCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	clientClosed := make(chan struct{})
+	go func() {
+		client.Wait()
+		close(clientClosed)
+	}()
+	go func() {
+		select {
+		case <-serveCtx.Done():
+		case <-clientClosed:
+		}
+		cancel()
+		listener.Close()
+	}()
+
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			select {
+			case <-clientClosed:
+				return fmt.Errorf("%w: SSH connection lost", ErrConnectionBroken)
+			default:
+				return fmt.Errorf("%w: %v", ErrConnectionBroken, err)
+			}
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f.pipe(serveCtx, client, conn)
+		}()
+	}
+}
+
+func (f *Forward) listen(client *ssh.Client) (net.Listener, error) {
+	if f.config.Type == constant.ForwardRemote {
+		listener, err := client.Listen("tcp", f.config.Listen)
+		if err != nil {
+			// the connection may be broken, or the address in use on the server, retry either way
+			return nil, fmt.Errorf("%w: listen on server %s failed: %v", ErrConnectionBroken, f.config.Listen, err)
+		}
+		return listener, nil
+	}
+	listener, err := net.Listen("tcp", f.config.Listen)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errForwardListen, err)
+	}
+	return listener, nil
+}
+
+// copy between an accepted connection and the target until both sides are done
+func (f *Forward) pipe(ctx context.Context, client *ssh.Client, conn net.Conn) {
+	defer conn.Close()
+	f.totalConns.Add(1)
+
+	var target net.Conn
+	var err error
+	if f.config.Type == constant.ForwardRemote {
+		dialer := net.Dialer{Timeout: 10 * time.Second}
+		target, err = dialer.DialContext(ctx, "tcp", f.config.Target)
+	} else {
+		target, err = client.DialContext(ctx, "tcp", f.config.Target)
+	}
+	if err != nil {
+		f.failedConns.Add(1)
+		logs.Logger.Warn("port forward dial target failed",
+			zap.String("forward", f.config.Name),
+			zap.String("target", f.config.Target),
+			zap.Error(err))
+		return
+	}
+	defer target.Close()
+
+	f.activeConns.Add(1)
+	defer f.activeConns.Add(-1)
+	stop := context.AfterFunc(ctx, func() {
+		conn.Close()
+		target.Close()
+	})
+	defer stop()
+
+	done := make(chan struct{})
+	go func() {
+		copyCounted(target, conn, &f.bytesToTarget)
+		close(done)
+	}()
+	copyCounted(conn, target, &f.bytesFromTarget)
+	<-done
+}
+
+// copy src to dst and half-close dst, so the other direction can still finish
+func copyCounted(dst net.Conn, src net.Conn, counter *atomic.Uint64) {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, werr := dst.Write(buf[:n]); werr != nil {
+				break
+			}
+			counter.Add(uint64(n))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if closer, ok := dst.(interface{ CloseWrite() error }); ok {
+		closer.CloseWrite()
+	} else {
+		dst.Close()
+	}
+}
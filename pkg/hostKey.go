@@ -0,0 +1,219 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	ErrHostKeyUnknown  = errors.New("host key not trusted")
+	ErrHostKeyMismatch = errors.New("host key mismatch")
+)
+
+// HostKeyInfo describes the pinned and pending host key of an address
+type HostKeyInfo struct {
+	Address            string
+	Status             constant.HostKeyStatus
+	KeyType            string
+	Fingerprint        string // pinned key fingerprint
+	PendingKeyType     string // key type presented by the host but not accepted yet
+	PendingFingerprint string // fingerprint presented by the host but not accepted yet
+}
+
+// HostKeyStore persists trusted host keys in an OpenSSH known_hosts file
+type HostKeyStore struct {
+	path    string
+	pending map[string]ssh.PublicKey // normalized address -> key presented on last failed handshake
+	mutex   sync.Mutex
+}
+
+var hostKeyStore = HostKeyStore{
+	path:    viper.GetString("Server.KnownHostsFile"),
+	pending: make(map[string]ssh.PublicKey),
+	mutex:   sync.Mutex{},
+}
+
+// probeKey never matches a real host key, it is used to list the keys pinned for an address
+var probeKey, _ = ssh.NewPublicKey(ed25519.PublicKey(make([]byte, ed25519.PublicKeySize)))
+
+func GetHostKeyStore() *HostKeyStore {
+	return &hostKeyStore
+}
+
+// load known_hosts file, create it if not exists
+func (h *HostKeyStore) load() (ssh.HostKeyCallback, error) {
+	if h.path == "" {
+		h.path = "config/known_hosts"
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return nil, fmt.Errorf("create known_hosts dir failed: %v", err)
+	}
+	f, err := os.OpenFile(h.path, os.O_CREATE|os.O_RDONLY, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("open known_hosts failed: %v", err)
+	}
+	f.Close()
+	return knownhosts.New(h.path)
+}
+
+// HostKeyCallback verify host key against known_hosts, unknown or changed keys are kept as pending
+func (h *HostKeyStore) HostKeyCallback(hostname string, remote net.Addr, key ssh.PublicKey) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	check, err := h.load()
+	if err != nil {
+		return err
+	}
+
+	address := knownhosts.Normalize(hostname)
+	err = check(hostname, remote, key)
+	if err == nil {
+		delete(h.pending, address)
+		return nil
+	}
+
+	var keyErr *knownhosts.KeyError
+	if !errors.As(err, &keyErr) {
+		return err
+	}
+
+	h.pending[address] = key
+	if len(keyErr.Want) == 0 {
+		logs.Logger.Warn("unknown SSH host key, waiting for approval",
+			zap.String("address", address),
+			zap.String("fingerprint", ssh.FingerprintSHA256(key)))
+		return fmt.Errorf("%w: %s presented %s key %s", ErrHostKeyUnknown, address, key.Type(), ssh.FingerprintSHA256(key))
+	}
+
+	logs.Logger.Error("SSH host key mismatch, possible man-in-the-middle attack",
+		zap.String("address", address),
+		zap.String("want", ssh.FingerprintSHA256(keyErr.Want[0].Key)),
+		zap.String("got", ssh.FingerprintSHA256(key)))
+	return fmt.Errorf("%w: %s presented %s key %s, pinned %s", ErrHostKeyMismatch, address, key.Type(), ssh.FingerprintSHA256(key), ssh.FingerprintSHA256(keyErr.Want[0].Key))
+}
+
+// GetHostKeyInfo get pinned and pending host key of address (ip:port)
+func (h *HostKeyStore) GetHostKeyInfo(hostname string) (*HostKeyInfo, error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	check, err := h.load()
+	if err != nil {
+		return nil, err
+	}
+
+	address := knownhosts.Normalize(hostname)
+	info := &HostKeyInfo{Address: address, Status: constant.HostKeyNone}
+
+	var keyErr *knownhosts.KeyError
+	if err := check(hostname, &net.TCPAddr{}, probeKey); errors.As(err, &keyErr) && len(keyErr.Want) > 0 {
+		info.Status = constant.HostKeyTrusted
+		info.KeyType = keyErr.Want[0].Key.Type()
+		info.Fingerprint = ssh.FingerprintSHA256(keyErr.Want[0].Key)
+	}
+
+	if key, ok := h.pending[address]; ok {
+		info.PendingKeyType = key.Type()
+		info.PendingFingerprint = ssh.FingerprintSHA256(key)
+		if info.Status == constant.HostKeyTrusted {
+			info.Status = constant.HostKeyChanged
+		} else {
+			info.Status = constant.HostKeyPending
+		}
+	}
+	return info, nil
+}
+
+// AcceptHostKey pin the pending key of address, fingerprint must equal the pending key fingerprint
+// any previously pinned key of this address is replaced
+func (h *HostKeyStore) AcceptHostKey(hostname string, fingerprint string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	address := knownhosts.Normalize(hostname)
+	key, ok := h.pending[address]
+	if !ok {
+		return fmt.Errorf("no pending host key for %s", address)
+	}
+	if ssh.FingerprintSHA256(key) != fingerprint {
+		return fmt.Errorf("fingerprint not match pending host key")
+	}
+
+	if err := h.removeLines(address); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(h.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("open known_hosts failed: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(knownhosts.Line([]string{address}, key) + "\n"); err != nil {
+		return fmt.Errorf("write known_hosts failed: %v", err)
+	}
+
+	delete(h.pending, address)
+	logs.Logger.Info("SSH host key accepted", zap.String("address", address), zap.String("fingerprint", fingerprint))
+	return nil
+}
+
+// ResetHostKey remove pinned and pending key of address, next connection will ask for approval again
+func (h *HostKeyStore) ResetHostKey(hostname string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	address := knownhosts.Normalize(hostname)
+	delete(h.pending, address)
+	return h.removeLines(address)
+}
+
+// remove plain (not hashed) known_hosts lines of address
+func (h *HostKeyStore) removeLines(address string) error {
+	if _, err := h.load(); err != nil {
+		return err
+	}
+	content, err := os.ReadFile(h.path)
+	if err != nil {
+		return fmt.Errorf("read known_hosts failed: %v", err)
+	}
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		_, hosts, _, _, _, err := ssh.ParseKnownHosts(line)
+		if err == nil && containsHost(hosts, address) {
+			continue
+		}
+		out.Write(line)
+		out.WriteByte('\n')
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read known_hosts failed: %v", err)
+	}
+	return os.WriteFile(h.path, out.Bytes(), 0600)
+}
+
+func containsHost(hosts []string, address string) bool {
+	for _, host := range hosts {
+		if host == address {
+			return true
+		}
+	}
+	return false
+}
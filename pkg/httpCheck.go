@@ -0,0 +1,271 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// HTTPCheckSpec request and assertions of http and http_native checks, without a spec
+// the check sends a GET and accepts any 2xx or 3xx status
+type HTTPCheckSpec struct {
+	Method        string            `json:"method,omitempty" yaml:"method,omitempty"` // GET if empty
+	Headers       map[string]string `json:"headers,omitempty" yaml:"headers,omitempty"`
+	Body          string            `json:"body,omitempty" yaml:"body,omitempty"`
+	ExpectStatus  []int             `json:"expect_status,omitempty" yaml:"expect_status,omitempty"` // accepted status codes, any 2xx or 3xx if empty
+	BodyContains  string            `json:"body_contains,omitempty" yaml:"body_contains,omitempty"`
+	BodyRegex     string            `json:"body_regex,omitempty" yaml:"body_regex,omitempty"`
+	JSON          []JSONAssertion   `json:"json,omitempty" yaml:"json,omitempty"`                     // all must hold
+	MaxLatency    int               `json:"max_latency_ms,omitempty" yaml:"max_latency_ms,omitempty"` // milliseconds, 0 means no limit
+	TLSSkipVerify bool              `json:"tls_skip_verify,omitempty" yaml:"tls_skip_verify,omitempty"`
+}
+
+// JSONAssertion value at path of a JSON response body must equal Equals
+type JSONAssertion struct {
+	Path   string `json:"path" yaml:"path"`     // such as $.status or $.checks[0].name
+	Equals any    `json:"equals" yaml:"equals"` // string, number, bool, null, list or object
+}
+
+func (s *HTTPCheckSpec) method() string {
+	if s == nil || s.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(s.Method)
+}
+
+// body assertions need the response body, otherwise it is discarded
+func (s *HTTPCheckSpec) needsBody() bool {
+	return s != nil && (s.BodyContains != "" || s.BodyRegex != "" || len(s.JSON) > 0)
+}
+
+// ValidateHTTPCheck check spec of an app, only http and http_native checks take one
+func ValidateHTTPCheck(checkType constant.AppCheckType, spec *HTTPCheckSpec) error {
+	if spec == nil {
+		return nil
+	}
+	if checkType != constant.AppCheckTypeHttp && checkType != constant.AppCheckTypeHttpNative {
+		return fmt.Errorf("http check spec is only used by http and http_native checks")
+	}
+	for _, r := range spec.Method {
+		if !(r >= 'A' && r <= 'Z' || r >= 'a' && r <= 'z') {
+			return fmt.Errorf("invalid http method %q", spec.Method)
+		}
+	}
+	for name := range spec.Headers {
+		if name == "" || strings.ContainsAny(name, " :\r\n") {
+			return fmt.Errorf("invalid header name %q", name)
+		}
+		if strings.ContainsAny(spec.Headers[name], "\r\n") {
+			return fmt.Errorf("value of header %s must be a single line", name)
+		}
+	}
+	for _, status := range spec.ExpectStatus {
+		if status < 100 || status > 599 {
+			return fmt.Errorf("invalid expected status %d", status)
+		}
+	}
+	if _, err := regexp.Compile(spec.BodyRegex); err != nil {
+		return fmt.Errorf("invalid body regex: %w", err)
+	}
+	for _, assertion := range spec.JSON {
+		if _, err := parseJSONPath(assertion.Path); err != nil {
+			return err
+		}
+		if _, err := json.Marshal(assertion.Equals); err != nil {
+			return fmt.Errorf("expected value of %s is not a JSON value: %w", assertion.Path, err)
+		}
+	}
+	if spec.MaxLatency < 0 {
+		return fmt.Errorf("max latency must not be negative")
+	}
+	return nil
+}
+
+// evaluate response against the spec, the error names the first assertion that failed
+func (s *HTTPCheckSpec) evaluate(status int, body []byte, latency time.Duration) error {
+	if s == nil || len(s.ExpectStatus) == 0 {
+		if status < 200 || status >= 400 {
+			return fmt.Errorf("status: got %d, expected 2xx or 3xx", status)
+		}
+	} else if !slices.Contains(s.ExpectStatus, status) {
+		return fmt.Errorf("status: got %d, expected one of %v", status, s.ExpectStatus)
+	}
+	if s == nil {
+		return nil
+	}
+	if limit := time.Duration(s.MaxLatency) * time.Millisecond; limit > 0 && latency > limit {
+		return fmt.Errorf("max_latency_ms: took %dms, limit %dms", latency.Milliseconds(), s.MaxLatency)
+	}
+	if s.BodyContains != "" && !bytes.Contains(body, []byte(s.BodyContains)) {
+		return fmt.Errorf("body_contains: body does not contain %q", s.BodyContains)
+	}
+	if s.BodyRegex != "" {
+		re, err := regexp.Compile(s.BodyRegex)
+		if err != nil {
+			return fmt.Errorf("body_regex: %w", err)
+		}
+		if !re.Match(body) {
+			return fmt.Errorf("body_regex: body does not match %s", s.BodyRegex)
+		}
+	}
+	if len(s.JSON) == 0 {
+		return nil
+	}
+	var document any
+	if err := json.Unmarshal(body, &document); err != nil {
+		return fmt.Errorf("json: body is not JSON: %w", err)
+	}
+	for _, assertion := range s.JSON {
+		if err := assertion.check(document); err != nil {
+			return fmt.Errorf("json %s: %w", assertion.Path, err)
+		}
+	}
+	return nil
+}
+
+func (a *JSONAssertion) check(document any) error {
+	path, err := parseJSONPath(a.Path)
+	if err != nil {
+		return err
+	}
+	value := document
+	for _, step := range path {
+		switch node := value.(type) {
+		case map[string]any:
+			child, ok := node[step.key]
+			if step.index >= 0 || !ok {
+				return fmt.Errorf("not found")
+			}
+			value = child
+		case []any:
+			if step.index < 0 || step.index >= len(node) {
+				return fmt.Errorf("not found")
+			}
+			value = node[step.index]
+		default:
+			return fmt.Errorf("not found")
+		}
+	}
+	// compare as canonical JSON, so 1 equals 1.0 and object key order does not matter
+	actual, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	expected, err := json.Marshal(a.Equals)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(actual, expected) {
+		return fmt.Errorf("got %s, expected %s", actual, expected)
+	}
+	return nil
+}
+
+// jsonPathStep object key, or list index when index >= 0
+type jsonPathStep struct {
+	key   string
+	index int
+}
+
+// parseJSONPath parse the subset of JSONPath naming a single value: $.a.b, $.a[0], $['a.b']
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	invalid := fmt.Errorf("invalid json path %q, use a form like $.status or $.checks[0].name", path)
+	rest, ok := strings.CutPrefix(path, "$")
+	if !ok {
+		return nil, invalid
+	}
+	var steps []jsonPathStep
+	for rest != "" {
+		switch {
+		case rest[0] == '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, invalid
+			}
+			steps = append(steps, jsonPathStep{key: rest[:end], index: -1})
+			rest = rest[end:]
+		case strings.HasPrefix(rest, "['") || strings.HasPrefix(rest, `["`):
+			quote := rest[1]
+			end := strings.IndexByte(rest[2:], quote)
+			if end < 0 || !strings.HasPrefix(rest[2+end:], string(quote)+"]") {
+				return nil, invalid
+			}
+			steps = append(steps, jsonPathStep{key: rest[2 : 2+end], index: -1})
+			rest = rest[2+end+2:]
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, invalid
+			}
+			index, err := strconv.Atoi(rest[1:end])
+			if err != nil || index < 0 {
+				return nil, invalid
+			}
+			steps = append(steps, jsonPathStep{index: index})
+			rest = rest[end+1:]
+		default:
+			return nil, invalid
+		}
+	}
+	return steps, nil
+}
+
+// curl command of an http check over SSH, the first output line holds status code and total time,
+// the body goes through a temp file so that trimming a large body never cuts off the status line
+func (s *HTTPCheckSpec) curlCommand(url string) string {
+	args := []string{"curl", "-s", "-S"}
+	if method := s.method(); method != http.MethodGet {
+		args = append(args, "-X", method)
+	}
+	if s != nil {
+		for _, name := range slices.Sorted(maps.Keys(s.Headers)) {
+			args = append(args, "-H", shellQuote(name+": "+s.Headers[name]))
+		}
+		if s.Body != "" {
+			args = append(args, "--data-binary", shellQuote(s.Body))
+		}
+		if s.TLSSkipVerify {
+			args = append(args, "-k")
+		}
+	}
+	output := "/dev/null"
+	if s.needsBody() {
+		output = `"$body"`
+	}
+	args = append(args, "-o", output, "-w", shellQuote(`%{http_code} %{time_total}\n`), shellQuote(url))
+	if !s.needsBody() {
+		return strings.Join(args, " ")
+	}
+	return fmt.Sprintf(`body=$(mktemp) || exit 1; %s; code=$?; head -c %d "$body"; rm -f "$body"; exit $code`,
+		strings.Join(args, " "), nativeCheckBodyLimit)
+}
+
+// split curl output into body, status code and total time
+func parseCurlOutput(output string) ([]byte, int, time.Duration, error) {
+	first, body, _ := strings.Cut(output, "\n")
+	fields := strings.Fields(first)
+	if len(fields) != 2 {
+		return nil, 0, 0, fmt.Errorf("unexpected curl output %q", first)
+	}
+	status, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("unexpected curl status %q", fields[0])
+	}
+	seconds, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return nil, 0, 0, fmt.Errorf("unexpected curl time %q", fields[1])
+	}
+	return []byte(body), status, time.Duration(seconds * float64(time.Second)), nil
+}
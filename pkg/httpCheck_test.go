@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseCurlOutput(t *testing.T) {
+	tests := []struct {
+		name    string
+		output  string
+		body    string
+		status  int
+		latency time.Duration
+		wantErr bool
+	}{
+		{name: "no body", output: "204 0.125\n", status: 204, latency: 125 * time.Millisecond},
+		{name: "body", output: "200 0.5\n{\"status\":\"up\"}\nsecond line", body: "{\"status\":\"up\"}\nsecond line", status: 200, latency: 500 * time.Millisecond},
+		{name: "connection failed", output: "000 0.001\n", status: 0, latency: time.Millisecond},
+		{name: "empty", output: "", wantErr: true},
+		{name: "bad status", output: "abc 0.1\n", wantErr: true},
+		{name: "bad time", output: "200 fast\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, status, latency, err := parseCurlOutput(tt.output)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if string(body) != tt.body || status != tt.status || latency != tt.latency {
+				t.Fatalf("got %q %d %v, want %q %d %v", body, status, latency, tt.body, tt.status, tt.latency)
+			}
+		})
+	}
+}
+
+// run the curl command the way it runs over SSH, stdout trimmed to the command output limit
+func runCurlCommand(t *testing.T, cmd string) string {
+	t.Helper()
+	stdout := &limitedBuffer{limit: maxCommandOutput()}
+	command := exec.CommandContext(context.Background(), "/bin/sh", "-c", cmd)
+	command.Stdout = stdout
+	if err := command.Run(); err != nil {
+		t.Fatalf("%s: %v", cmd, err)
+	}
+	return stdout.String()
+}
+
+func TestCurlCommandLargeBody(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not installed")
+	}
+	large := strings.Repeat("x", 2*nativeCheckBodyLimit) + "tail"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Check") != "it's me" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(large))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		spec     *HTTPCheckSpec
+		needBody bool
+	}{
+		{name: "status only", spec: &HTTPCheckSpec{Headers: map[string]string{"X-Check": "it's me"}}},
+		{name: "body assertion", spec: &HTTPCheckSpec{Headers: map[string]string{"X-Check": "it's me"}, BodyContains: "xxx"}, needBody: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, status, _, err := parseCurlOutput(runCurlCommand(t, tt.spec.curlCommand(server.URL)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != http.StatusAccepted {
+				t.Fatalf("status = %d, want %d", status, http.StatusAccepted)
+			}
+			// the body is trimmed, the status line before it is not
+			if tt.needBody != (len(body) > 0) || len(body) > nativeCheckBodyLimit || !strings.HasPrefix(large, string(body)) {
+				t.Fatalf("body has %d bytes, want a prefix of the response up to %d bytes", len(body), nativeCheckBodyLimit)
+			}
+			if err := tt.spec.evaluate(status, body, 0); err != nil {
+				t.Fatalf("evaluate: %v", err)
+			}
+		})
+	}
+}
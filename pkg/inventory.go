@@ -0,0 +1,611 @@
+package pkg
+
+import (
+	"bufio"
+	"fmt"
+	"maps"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+)
+
+// inventory formats accepted by ParseInventory
+const (
+	InventoryAuto        = "auto"
+	InventorySSHConfig   = "ssh_config"
+	InventoryAnsibleINI  = "ansible_ini"
+	InventoryAnsibleYAML = "ansible_yaml"
+)
+
+// InventoryHost host read from an OpenSSH client config or an Ansible inventory
+type InventoryHost struct {
+	Alias          string // Host alias or Ansible inventory hostname
+	HostName       string // address to connect to, the alias if not set
+	Port           int    // 0 if not set
+	User           string
+	IdentityFile   string
+	Password       string
+	BecomeMethod   string
+	BecomePassword string
+	ProxyJump      string   // alias of another host, or [user@]host[:port]
+	Groups         []string // Ansible groups of the host, sorted
+	Line           int      // line of the host in the source, 0 for YAML
+}
+
+// Address host to connect to
+func (h *InventoryHost) Address() string {
+	if h.HostName != "" {
+		return h.HostName
+	}
+	return h.Alias
+}
+
+// ParseInventory parse an inventory in format, auto detects the format from the content
+func ParseInventory(format string, content string) ([]InventoryHost, string, error) {
+	if format == "" || format == InventoryAuto {
+		format = DetectInventoryFormat(content)
+	}
+	var hosts []InventoryHost
+	var err error
+	switch format {
+	case InventorySSHConfig:
+		hosts, err = ParseSSHConfig(content)
+	case InventoryAnsibleINI:
+		hosts, err = ParseAnsibleINI(content)
+	case InventoryAnsibleYAML:
+		hosts, err = ParseAnsibleYAML(content)
+	default:
+		return nil, format, fmt.Errorf("unknown inventory format %q, expected ssh_config, ansible_ini or ansible_yaml", format)
+	}
+	return hosts, format, err
+}
+
+// DetectInventoryFormat guess the format from the first directive of content
+func DetectInventoryFormat(content string) string {
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") || line == "---" {
+			continue
+		}
+		keyword, _ := splitSSHConfigLine(line)
+		keyword = strings.ToLower(keyword)
+		switch {
+		case strings.HasPrefix(line, "["):
+			return InventoryAnsibleINI
+		case keyword == "host" || keyword == "match" || keyword == "include" || sshConfigKeywords[keyword]:
+			return InventorySSHConfig
+		case strings.HasSuffix(line, ":") || strings.Contains(line, ": "):
+			return InventoryAnsibleYAML
+		}
+		return InventoryAnsibleINI
+	}
+	return InventoryAnsibleINI
+}
+
+// client config keywords used by the import, others are ignored
+var sshConfigKeywords = map[string]bool{
+	"hostname":     true,
+	"port":         true,
+	"user":         true,
+	"identityfile": true,
+	"proxyjump":    true,
+}
+
+type sshConfigBlock struct {
+	patterns []string
+	options  map[string]string // first value of each keyword, keyword in lower case
+}
+
+// ParseSSHConfig parse OpenSSH client config, every Host alias without wildcards becomes a host
+// options are taken from all matching Host blocks, the first value wins as in ssh
+// Match blocks and Include are not supported and skipped
+func ParseSSHConfig(content string) ([]InventoryHost, error) {
+	var blocks []*sshConfigBlock
+	global := &sshConfigBlock{patterns: []string{"*"}, options: make(map[string]string)}
+	blocks = append(blocks, global)
+	current := global
+	var aliases []string
+	aliasLine := make(map[string]int)
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keyword, value := splitSSHConfigLine(line)
+		keyword = strings.ToLower(keyword)
+		switch keyword {
+		case "host":
+			patterns := strings.Fields(value)
+			if len(patterns) == 0 {
+				return nil, fmt.Errorf("line %d: Host without pattern", number)
+			}
+			current = &sshConfigBlock{patterns: patterns, options: make(map[string]string)}
+			blocks = append(blocks, current)
+			for _, pattern := range patterns {
+				if strings.ContainsAny(pattern, "*?!") {
+					continue
+				}
+				if _, ok := aliasLine[pattern]; !ok {
+					aliasLine[pattern] = number
+					aliases = append(aliases, pattern)
+				}
+			}
+		case "match":
+			// conditions cannot be evaluated here, options of the block apply to no host
+			current = &sshConfigBlock{options: make(map[string]string)}
+		default:
+			if !sshConfigKeywords[keyword] {
+				continue
+			}
+			if value == "" {
+				return nil, fmt.Errorf("line %d: %s without value", number, keyword)
+			}
+			if _, ok := current.options[keyword]; !ok {
+				current.options[keyword] = value
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	hosts := make([]InventoryHost, 0, len(aliases))
+	for _, alias := range aliases {
+		options := make(map[string]string)
+		// options before the first Host apply to every host, and come first like in ssh
+		for _, block := range blocks {
+			if !matchSSHPatterns(block.patterns, alias) {
+				continue
+			}
+			for keyword, value := range block.options {
+				if _, ok := options[keyword]; !ok {
+					options[keyword] = value
+				}
+			}
+		}
+
+		host := InventoryHost{
+			Alias:        alias,
+			HostName:     strings.ReplaceAll(options["hostname"], "%h", alias),
+			User:         options["user"],
+			IdentityFile: expandHome(unquote(options["identityfile"])),
+			Line:         aliasLine[alias],
+		}
+		if port := options["port"]; port != "" {
+			number, err := strconv.Atoi(port)
+			if err != nil || number <= 0 || number > 65535 {
+				return nil, fmt.Errorf("host %s: invalid port %q", alias, port)
+			}
+			host.Port = number
+		}
+		if jump := options["proxyjump"]; jump != "" && !strings.EqualFold(jump, "none") {
+			host.ProxyJump = jump
+		}
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// keyword value or keyword=value
+func splitSSHConfigLine(line string) (string, string) {
+	index := strings.IndexAny(line, " \t=")
+	if index < 0 {
+		return line, ""
+	}
+	value := strings.TrimSpace(line[index:])
+	value = strings.TrimSpace(strings.TrimPrefix(value, "="))
+	return line[:index], value
+}
+
+// alias matches one of the patterns and none of the negated ones
+func matchSSHPatterns(patterns []string, alias string) bool {
+	matched := false
+	for _, pattern := range patterns {
+		if negated, ok := strings.CutPrefix(pattern, "!"); ok {
+			if ok, _ := path.Match(negated, alias); ok {
+				return false
+			}
+			continue
+		}
+		if ok, _ := path.Match(pattern, alias); ok {
+			matched = true
+		}
+	}
+	return matched
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+func expandHome(file string) string {
+	if rest, ok := strings.CutPrefix(file, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return file
+}
+
+// ansible inventory before group and host vars are merged
+type ansibleInventory struct {
+	hosts    []string                     // in order of first appearance
+	hostLine map[string]int               // line of first appearance in INI inventories
+	hostVars map[string]map[string]string // by host
+	groups   map[string]*ansibleGroup
+}
+
+type ansibleGroup struct {
+	hosts    []string
+	children []string
+	vars     map[string]string
+}
+
+func newAnsibleInventory() *ansibleInventory {
+	return &ansibleInventory{
+		hostLine: make(map[string]int),
+		hostVars: make(map[string]map[string]string),
+		groups:   map[string]*ansibleGroup{"all": {vars: make(map[string]string)}},
+	}
+}
+
+func (inv *ansibleInventory) group(name string) *ansibleGroup {
+	group := inv.groups[name]
+	if group == nil {
+		group = &ansibleGroup{vars: make(map[string]string)}
+		inv.groups[name] = group
+	}
+	return group
+}
+
+func (inv *ansibleInventory) addHost(group string, host string, vars map[string]string, line int) {
+	if _, ok := inv.hostVars[host]; !ok {
+		inv.hosts = append(inv.hosts, host)
+		inv.hostVars[host] = make(map[string]string)
+		inv.hostLine[host] = line
+	}
+	for key, value := range vars {
+		inv.hostVars[host][key] = value
+	}
+	if group != "" && !slices.Contains(inv.group(group).hosts, host) {
+		inv.group(group).hosts = append(inv.group(group).hosts, host)
+	}
+}
+
+// ParseAnsibleINI parse an Ansible INI inventory with [group], [group:vars] and [group:children] sections,
+// numeric ranges such as web[01:10].example.com are expanded
+func ParseAnsibleINI(content string) ([]InventoryHost, error) {
+	inv := newAnsibleInventory()
+	section, kind := "ungrouped", "hosts"
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid section %s", number, line)
+			}
+			section, kind, _ = strings.Cut(line[1:len(line)-1], ":")
+			if kind == "" {
+				kind = "hosts"
+			}
+			if kind != "hosts" && kind != "vars" && kind != "children" {
+				return nil, fmt.Errorf("line %d: unknown section type %s", number, kind)
+			}
+			inv.group(section)
+			continue
+		}
+
+		switch kind {
+		case "vars":
+			key, value, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("line %d: expected key=value in [%s:vars]", number, section)
+			}
+			inv.group(section).vars[strings.TrimSpace(key)] = unquoteINIValue(strings.TrimSpace(value))
+		case "children":
+			inv.group(section).children = append(inv.group(section).children, strings.Fields(line)[0])
+			inv.group(strings.Fields(line)[0])
+		default:
+			fields, err := splitINIFields(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", number, err)
+			}
+			vars := make(map[string]string)
+			for _, field := range fields[1:] {
+				key, value, ok := strings.Cut(field, "=")
+				if !ok {
+					return nil, fmt.Errorf("line %d: expected key=value after host, got %s", number, field)
+				}
+				vars[key] = unquoteINIValue(value)
+			}
+			pattern := fields[0]
+			// host:port, IPv6 addresses have more than one colon
+			if name, port, ok := strings.Cut(pattern, ":"); ok && !strings.Contains(port, ":") {
+				if _, err := strconv.Atoi(port); err == nil {
+					pattern = name
+					if _, set := vars["ansible_port"]; !set {
+						vars["ansible_port"] = port
+					}
+				}
+			}
+			names, err := expandHostRange(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %v", number, err)
+			}
+			for _, name := range names {
+				inv.addHost(section, name, vars, number)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return inv.resolve()
+}
+
+// split at whitespace outside of quotes
+func splitINIFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	var quote rune
+scan:
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+			field.WriteRune(r)
+		case r == '"' || r == '\'':
+			quote = r
+			field.WriteRune(r)
+		case r == '#':
+			// comment after the host
+			if field.Len() == 0 {
+				break scan
+			}
+			field.WriteRune(r)
+		case r == ' ' || r == '\t':
+			if field.Len() > 0 {
+				fields = append(fields, field.String())
+				field.Reset()
+			}
+		default:
+			field.WriteRune(r)
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote")
+	}
+	if field.Len() > 0 {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+func unquoteINIValue(value string) string {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// web[01:03].example.com is web01, web02 and web03
+func expandHostRange(name string) ([]string, error) {
+	start := strings.Index(name, "[")
+	if start < 0 {
+		return []string{name}, nil
+	}
+	end := strings.Index(name[start:], "]")
+	if end < 0 {
+		return nil, fmt.Errorf("invalid host range %s", name)
+	}
+	end += start
+	from, to, ok := strings.Cut(name[start+1:end], ":")
+	first, err1 := strconv.Atoi(from)
+	last, err2 := strconv.Atoi(to)
+	if !ok || err1 != nil || err2 != nil || first > last {
+		return nil, fmt.Errorf("invalid host range %s, only numeric ranges like [01:10] are supported", name)
+	}
+	rest, err := expandHostRange(name[end+1:])
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for i := first; i <= last; i++ {
+		number := fmt.Sprintf("%0*d", len(from), i)
+		for _, suffix := range rest {
+			names = append(names, name[:start]+number+suffix)
+		}
+	}
+	return names, nil
+}
+
+// ParseAnsibleYAML parse an Ansible YAML inventory of groups with hosts, vars and children
+func ParseAnsibleYAML(content string) ([]InventoryHost, error) {
+	var root map[string]*ansibleYAMLGroup
+	if err := yaml.Unmarshal([]byte(content), &root); err != nil {
+		return nil, fmt.Errorf("invalid YAML inventory: %v", err)
+	}
+	inv := newAnsibleInventory()
+	for _, name := range slices.Sorted(maps.Keys(root)) {
+		inv.addYAMLGroup(name, root[name])
+	}
+	return inv.resolve()
+}
+
+type ansibleYAMLGroup struct {
+	Hosts    map[string]map[string]any    `yaml:"hosts"`
+	Vars     map[string]any               `yaml:"vars"`
+	Children map[string]*ansibleYAMLGroup `yaml:"children"`
+}
+
+func (inv *ansibleInventory) addYAMLGroup(name string, group *ansibleYAMLGroup) {
+	inv.group(name)
+	if group == nil {
+		return
+	}
+	for key, value := range group.Vars {
+		inv.group(name).vars[key] = fmt.Sprint(value)
+	}
+	for _, host := range slices.Sorted(maps.Keys(group.Hosts)) {
+		vars := make(map[string]string)
+		for key, value := range group.Hosts[host] {
+			vars[key] = fmt.Sprint(value)
+		}
+		inv.addHost(name, host, vars, 0)
+	}
+	for _, child := range slices.Sorted(maps.Keys(group.Children)) {
+		if !slices.Contains(inv.group(name).children, child) {
+			inv.group(name).children = append(inv.group(name).children, child)
+		}
+		inv.addYAMLGroup(child, group.Children[child])
+	}
+}
+
+// merge vars of every host: all, then its groups from parent to child, then host vars
+func (inv *ansibleInventory) resolve() ([]InventoryHost, error) {
+	parents := make(map[string][]string)
+	for name, group := range inv.groups {
+		for _, child := range group.children {
+			parents[child] = append(parents[child], name)
+		}
+	}
+	// depth of a group below all, guards against loops in children
+	depth := make(map[string]int)
+	var groupDepth func(name string, seen map[string]bool) int
+	groupDepth = func(name string, seen map[string]bool) int {
+		if d, ok := depth[name]; ok {
+			return d
+		}
+		if seen[name] {
+			return 0
+		}
+		seen[name] = true
+		d := 0
+		for _, parent := range parents[name] {
+			d = max(d, groupDepth(parent, seen)+1)
+		}
+		depth[name] = d
+		return d
+	}
+
+	hosts := make([]InventoryHost, 0, len(inv.hosts))
+	for _, name := range inv.hosts {
+		// groups of the host including their ancestors
+		member := make(map[string]bool)
+		var visit func(group string)
+		visit = func(group string) {
+			if member[group] {
+				return
+			}
+			member[group] = true
+			for _, parent := range parents[group] {
+				visit(parent)
+			}
+		}
+		for group, g := range inv.groups {
+			if slices.Contains(g.hosts, name) {
+				visit(group)
+			}
+		}
+		groups := make([]string, 0, len(member))
+		for group := range member {
+			if group != "all" && group != "ungrouped" {
+				groups = append(groups, group)
+			}
+		}
+		slices.SortFunc(groups, func(a, b string) int {
+			if da, db := groupDepth(a, map[string]bool{}), groupDepth(b, map[string]bool{}); da != db {
+				return da - db
+			}
+			return strings.Compare(a, b)
+		})
+
+		vars := make(map[string]string)
+		for key, value := range inv.groups["all"].vars {
+			vars[key] = value
+		}
+		for _, group := range groups {
+			for key, value := range inv.groups[group].vars {
+				vars[key] = value
+			}
+		}
+		for key, value := range inv.hostVars[name] {
+			vars[key] = value
+		}
+
+		host, err := newAnsibleHost(name, vars)
+		if err != nil {
+			return nil, err
+		}
+		host.Line = inv.hostLine[name]
+		slices.Sort(groups)
+		host.Groups = groups
+		hosts = append(hosts, host)
+	}
+	return hosts, nil
+}
+
+// connection vars of Ansible, older ansible_ssh_* names are accepted as well
+func newAnsibleHost(name string, vars map[string]string) (InventoryHost, error) {
+	first := func(keys ...string) string {
+		for _, key := range keys {
+			if value := vars[key]; value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	host := InventoryHost{
+		Alias:          name,
+		HostName:       first("ansible_host", "ansible_ssh_host"),
+		User:           first("ansible_user", "ansible_ssh_user"),
+		IdentityFile:   expandHome(first("ansible_ssh_private_key_file", "ansible_private_key_file")),
+		Password:       first("ansible_password", "ansible_ssh_pass"),
+		BecomeMethod:   first("ansible_become_method"),
+		BecomePassword: first("ansible_become_password", "ansible_become_pass"),
+		ProxyJump:      proxyJumpFromArgs(first("ansible_ssh_common_args", "ansible_ssh_extra_args")),
+	}
+	if port := first("ansible_port", "ansible_ssh_port"); port != "" {
+		number, err := strconv.Atoi(port)
+		if err != nil || number <= 0 || number > 65535 {
+			return host, fmt.Errorf("host %s: invalid port %q", name, port)
+		}
+		host.Port = number
+	}
+	return host, nil
+}
+
+// jump host from ssh arguments such as -J bastion or -o ProxyJump=bastion
+func proxyJumpFromArgs(args string) string {
+	fields := strings.Fields(strings.Trim(args, `"'`))
+	for i, field := range fields {
+		switch {
+		case field == "-J" && i+1 < len(fields):
+			return fields[i+1]
+		case strings.HasPrefix(field, "-J"):
+			return field[2:]
+		case field == "-o" && i+1 < len(fields):
+			if key, value, ok := strings.Cut(fields[i+1], "="); ok && strings.EqualFold(key, "ProxyJump") {
+				return value
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,260 @@
+package pkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func checkInventoryHosts(t *testing.T, got []InventoryHost, want []InventoryHost) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d hosts, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("host %d:\n got %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestParseSSHConfig(t *testing.T) {
+	t.Setenv("HOME", "/home/tester")
+	content := `# hosts of the lab
+Host web1 web2
+    HostName %h.example.com
+    User deploy
+
+Host db
+    HostName 10.0.0.5
+    Port 2222
+    IdentityFile "~/.ssh/db key"
+    ProxyJump bastion
+
+Host bastion
+    HostName=bastion.example.com
+    ProxyJump none
+
+Host *.internal
+    User internal
+
+Host web1
+    User ignored
+
+Match host web2
+    User matched
+
+Host * !bastion
+    User fallback
+    ProxyJump bastion
+`
+	hosts, err := ParseSSHConfig(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInventoryHosts(t, hosts, []InventoryHost{
+		{Alias: "web1", HostName: "web1.example.com", User: "deploy", ProxyJump: "bastion", Line: 2},
+		{Alias: "web2", HostName: "web2.example.com", User: "deploy", ProxyJump: "bastion", Line: 2},
+		{Alias: "db", HostName: "10.0.0.5", Port: 2222, User: "fallback", IdentityFile: "/home/tester/.ssh/db key", ProxyJump: "bastion", Line: 6},
+		{Alias: "bastion", HostName: "bastion.example.com", Line: 12},
+	})
+
+	// options before the first Host apply to every host and win over later ones
+	hosts, err = ParseSSHConfig("User root\nPort 2200\n\nHost app\n    User app\n    Port 22\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInventoryHosts(t, hosts, []InventoryHost{{Alias: "app", User: "root", Port: 2200, Line: 4}})
+
+	for name, content := range map[string]string{
+		"host without pattern": "Host\n",
+		"invalid port":         "Host app\n    Port ssh\n",
+		"port out of range":    "Host app\n    Port 70000\n",
+		"option without value": "Host app\n    HostName\n",
+	} {
+		if _, err := ParseSSHConfig(content); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestDetectInventoryFormat(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"# comment\nHost web\n  HostName 10.0.0.1\n", InventorySSHConfig},
+		{"IdentityFile ~/.ssh/id_ed25519\n", InventorySSHConfig},
+		{"Include ~/.ssh/config.d/*\n", InventorySSHConfig},
+		{"[web]\nweb1\n", InventoryAnsibleINI},
+		{"; comment\nweb1 ansible_host=10.0.0.1\n", InventoryAnsibleINI},
+		{"---\nall:\n  hosts:\n", InventoryAnsibleYAML},
+		{"web:\n  hosts:\n", InventoryAnsibleYAML},
+		{"", InventoryAnsibleINI},
+	}
+	for _, tt := range tests {
+		if got := DetectInventoryFormat(tt.content); got != tt.want {
+			t.Errorf("DetectInventoryFormat(%q) = %s, want %s", tt.content, got, tt.want)
+		}
+	}
+	if _, _, err := ParseInventory("csv", ""); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
+
+func TestExpandHostRange(t *testing.T) {
+	tests := []struct {
+		name string
+		want []string
+	}{
+		{"web.example.com", []string{"web.example.com"}},
+		{"web[01:03].example.com", []string{"web01.example.com", "web02.example.com", "web03.example.com"}},
+		{"db[8:10]", []string{"db8", "db9", "db10"}},
+		{"r[1:2]n[1:2]", []string{"r1n1", "r1n2", "r2n1", "r2n2"}},
+		{"one[5:5]", []string{"one5"}},
+	}
+	for _, tt := range tests {
+		got, err := expandHostRange(tt.name)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("expandHostRange(%s) = %v, %v, want %v", tt.name, got, err, tt.want)
+		}
+	}
+	for _, name := range []string{"web[a:c]", "web[3:1]", "web[01:03", "web[1]", "web[1:2]x[a:b]"} {
+		if got, err := expandHostRange(name); err == nil {
+			t.Errorf("expandHostRange(%s) = %v, want error", name, got)
+		}
+	}
+}
+
+func TestParseAnsibleINI(t *testing.T) {
+	content := `# comment
+bastion.example.com ansible_user=jump
+
+[web]
+web[01:02].example.com ansible_port=2201
+web03.example.com:2222 ansible_host=10.0.0.3  # comment
+
+[db]
+db1 ansible_host="10.0.1.1" ansible_ssh_common_args='-o ProxyJump=bastion.example.com'
+web01.example.com
+
+[web:vars]
+ansible_user=www
+ansible_become_method=sudo
+
+[prod:children]
+web
+db
+
+[prod:vars]
+ansible_user=produser
+ansible_port=22
+ansible_ssh_pass = "pa ss"
+
+[all:vars]
+ansible_user=default
+`
+	hosts, err := ParseAnsibleINI(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// vars of all, then parent groups, then child groups, then the host win
+	checkInventoryHosts(t, hosts, []InventoryHost{
+		{Alias: "bastion.example.com", User: "jump", Groups: []string{}, Line: 2},
+		{Alias: "web01.example.com", Port: 2201, User: "www", Password: "pa ss", BecomeMethod: "sudo", Groups: []string{"db", "prod", "web"}, Line: 5},
+		{Alias: "web02.example.com", Port: 2201, User: "www", Password: "pa ss", BecomeMethod: "sudo", Groups: []string{"prod", "web"}, Line: 5},
+		{Alias: "web03.example.com", HostName: "10.0.0.3", Port: 2222, User: "www", Password: "pa ss", BecomeMethod: "sudo", Groups: []string{"prod", "web"}, Line: 6},
+		{Alias: "db1", HostName: "10.0.1.1", Port: 22, User: "produser", Password: "pa ss", ProxyJump: "bastion.example.com", Groups: []string{"db", "prod"}, Line: 9},
+	})
+}
+
+func TestParseAnsibleINIChildrenLoop(t *testing.T) {
+	hosts, err := ParseAnsibleINI("[a:children]\nb\n\n[b:children]\na\n\n[a]\nh1\n\n[a:vars]\nansible_user=a\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInventoryHosts(t, hosts, []InventoryHost{{Alias: "h1", User: "a", Groups: []string{"a", "b"}, Line: 8}})
+}
+
+func TestParseAnsibleINIErrors(t *testing.T) {
+	tests := map[string]string{
+		"unclosed section":   "[web\nweb1\n",
+		"unknown section":    "[web:hosts2]\nweb1\n",
+		"vars without value": "[web:vars]\nansible_user\n",
+		"host var without =": "web1 ansible_user\n",
+		"unterminated quote": "web1 ansible_user='deploy\n",
+		"invalid range":      "web[1:a]\n",
+		"invalid port":       "web1 ansible_port=ssh\n",
+		"invalid group port": "[web]\nweb1\n\n[web:vars]\nansible_port=0\n",
+	}
+	for name, content := range tests {
+		if _, err := ParseAnsibleINI(content); err == nil {
+			t.Errorf("%s: no error", name)
+		} else if name == "unclosed section" && !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("%s: error without line: %v", name, err)
+		}
+	}
+}
+
+func TestParseAnsibleYAML(t *testing.T) {
+	content := `all:
+  vars:
+    ansible_user: default
+  hosts:
+    bastion:
+      ansible_host: 192.0.2.1
+  children:
+    prod:
+      vars:
+        ansible_user: produser
+      children:
+        web:
+          hosts:
+            web1:
+              ansible_port: 2201
+            web2:
+          vars:
+            ansible_become_password: secret
+        db:
+          hosts:
+            db1:
+              ansible_ssh_host: 10.0.1.1
+              ansible_ssh_extra_args: -J bastion
+              ansible_user: dbadmin
+    staging:
+`
+	hosts, err := ParseAnsibleYAML(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkInventoryHosts(t, hosts, []InventoryHost{
+		{Alias: "bastion", HostName: "192.0.2.1", User: "default", Groups: []string{}},
+		{Alias: "db1", HostName: "10.0.1.1", User: "dbadmin", ProxyJump: "bastion", Groups: []string{"db", "prod"}},
+		{Alias: "web1", Port: 2201, User: "produser", BecomePassword: "secret", Groups: []string{"prod", "web"}},
+		{Alias: "web2", User: "produser", BecomePassword: "secret", Groups: []string{"prod", "web"}},
+	})
+
+	if _, err := ParseAnsibleYAML("all: [\n"); err == nil {
+		t.Error("invalid YAML accepted")
+	}
+	if _, err := ParseAnsibleYAML("all:\n  hosts:\n    web1:\n      ansible_port: 99999\n"); err == nil {
+		t.Error("invalid port accepted")
+	}
+}
+
+func TestProxyJumpFromArgs(t *testing.T) {
+	tests := map[string]string{
+		"-J bastion":                        "bastion",
+		"-Jadmin@bastion:2222":              "admin@bastion:2222",
+		`"-o ProxyJump=bastion -o Foo=bar"`: "bastion",
+		"-o proxyjump=jump1,jump2":          "jump1,jump2",
+		"-o StrictHostKeyChecking=no":       "",
+		"-J":                                "",
+		"":                                  "",
+	}
+	for args, want := range tests {
+		if got := proxyJumpFromArgs(args); got != want {
+			t.Errorf("proxyJumpFromArgs(%q) = %q, want %q", args, got, want)
+		}
+	}
+}
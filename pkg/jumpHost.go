@@ -0,0 +1,191 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// dial addr through the pooled client of jump server and run SSH handshake over the tunnel
+func dialThroughJumpServer(jumpServerID uint, addr string, clientConfig *ssh.ClientConfig) (*ssh.Client, error) {
+	connectionPool.mutex.RLock()
+	jumpServer, ok := connectionPool.servers[jumpServerID]
+	connectionPool.mutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("jump server %d not exists", jumpServerID)
+	}
+
+	// in lazy mode this opens the jump server connection if needed
+	jumpClient, release, err := jumpServer.AcquireClient(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("jump server %d not connected: %v", jumpServerID, err)
+	}
+
+	conn, err := jumpClient.Dial("tcp", addr)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("dial %s through jump server %d failed: %v", addr, jumpServerID, err)
+	}
+
+	// ssh channels do not support deadlines, close the tunnel if handshake takes too long
+	timer := time.AfterFunc(clientConfig.Timeout, func() {
+		conn.Close()
+	})
+	clientConn, chans, reqs, err := ssh.NewClientConn(conn, addr, clientConfig)
+	if !timer.Stop() {
+		if err == nil {
+			clientConn.Close()
+		}
+		release()
+		return nil, fmt.Errorf("handshake with %s through jump server %d timeout", addr, jumpServerID)
+	}
+	if err != nil {
+		conn.Close()
+		release()
+		return nil, err
+	}
+	client := ssh.NewClient(clientConn, chans, reqs)
+	// the tunnel uses the jump server connection as long as the client is open
+	go func() {
+		client.Wait()
+		release()
+	}()
+	return client, nil
+}
+
+// JumpServerChain jump servers from the first hop to the nearest one of server
+func (c *ConnectionPool) JumpServerChain(serverID uint) ([]*Server, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	return c.jumpServerChain(serverID)
+}
+
+// must be called with c.mutex held
+func (c *ConnectionPool) jumpServerChain(serverID uint) ([]*Server, error) {
+	server, ok := c.servers[serverID]
+	if !ok {
+		return nil, nil
+	}
+
+	chain := make([]*Server, 0)
+	visited := map[uint]bool{serverID: true}
+	for jumpServerID := server.JumpServerID; jumpServerID != 0; {
+		if visited[jumpServerID] {
+			return nil, fmt.Errorf("jump server chain of server %d has a loop", serverID)
+		}
+		visited[jumpServerID] = true
+		jumpServer, ok := c.servers[jumpServerID]
+		if !ok {
+			return nil, fmt.Errorf("jump server %d not exists", jumpServerID)
+		}
+		chain = append([]*Server{jumpServer}, chain...)
+		jumpServerID = jumpServer.JumpServerID
+	}
+	return chain, nil
+}
+
+// CheckJumpServer validate that server may use jump server without creating a loop
+func (c *ConnectionPool) CheckJumpServer(serverID uint, jumpServerID uint) error {
+	if jumpServerID == 0 {
+		return nil
+	}
+	if jumpServerID == constant.LocalServerID {
+		return fmt.Errorf("local server cannot be used as jump server")
+	}
+	if jumpServerID == serverID {
+		return fmt.Errorf("server cannot jump through itself")
+	}
+
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	visited := map[uint]bool{serverID: true}
+	for id := jumpServerID; id != 0; {
+		if visited[id] {
+			return fmt.Errorf("jump server chain has a loop")
+		}
+		visited[id] = true
+		jumpServer, ok := c.servers[id]
+		if !ok {
+			return fmt.Errorf("jump server %d not exists", id)
+		}
+		id = jumpServer.JumpServerID
+	}
+	return nil
+}
+
+// GetJumpChildren IDs of servers that use serverID as their direct jump server
+func (c *ConnectionPool) GetJumpChildren(serverID uint) []uint {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	ids := make([]uint, 0)
+	for id, server := range c.servers {
+		if server.JumpServerID == serverID {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// sort servers so that every jump server comes before the servers behind it
+// must be called with c.mutex held
+func (c *ConnectionPool) sortByJumpDepth(servers []*Server) {
+	depth := make(map[uint]int, len(servers))
+	for _, s := range servers {
+		chain, err := c.jumpServerChain(s.ID)
+		if err != nil {
+			logs.Logger.Warn("invalid jump server chain",
+				zap.String("server_id", strconv.Itoa(int(s.ID))),
+				zap.Error(err))
+		}
+		depth[s.ID] = len(chain)
+	}
+	sort.SliceStable(servers, func(i, j int) bool {
+		return depth[servers[i].ID] < depth[servers[j].ID]
+	})
+}
+
+// ConnectServers connect servers level by level of their jump chains,
+// servers on the same level are connected concurrently
+func (c *ConnectionPool) ConnectServers(configs []*ServerConfig) {
+	pending := make(map[uint]*ServerConfig, len(configs))
+	for _, config := range configs {
+		pending[config.ID] = config
+	}
+
+	for len(pending) > 0 {
+		// a server is ready when its jump server is not waiting to be connected
+		ready := make([]*ServerConfig, 0)
+		for _, config := range pending {
+			if _, waiting := pending[config.JumpServerID]; !waiting {
+				ready = append(ready, config)
+			}
+		}
+		if len(ready) == 0 {
+			// remaining servers form a loop, connect them anyway to surface the error
+			for _, config := range pending {
+				ready = append(ready, config)
+			}
+		}
+
+		var wg sync.WaitGroup
+		for _, config := range ready {
+			delete(pending, config.ID)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := c.NewConnection(config); err != nil {
+					logs.Logger.Error("NewConnection failed", zap.String("server_id", strconv.Itoa(int(config.ID))), zap.Error(err))
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
@@ -0,0 +1,250 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"GolangOM/ws"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// connection modes, see Server.ConnectionMode
+const (
+	connectionModePersistent = "persistent" // every server keeps a connection, MaxConnectionNumber limits registered servers
+	connectionModeLazy       = "lazy"       // connections open on demand, MaxConnectionNumber limits open connections
+)
+
+func lazyConnectionMode() bool {
+	return viper.GetString("Server.ConnectionMode") == connectionModeLazy
+}
+
+// idle time after which an unused connection is closed in lazy mode
+func idleTimeout() time.Duration {
+	timeout := viper.GetInt("Server.IdleTimeout")
+	if timeout <= 0 {
+		timeout = 300
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// how long callers queue for a free connection in lazy mode
+func connectionWaitTimeout() time.Duration {
+	timeout := viper.GetInt("Server.ConnectionWaitTimeout")
+	if timeout <= 0 {
+		timeout = 30
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+var errPoolSaturated = errors.New("connection pool saturated")
+
+// lazyState bookkeeping of on-demand connections, guarded by ConnectionPool.mutex
+type lazyState struct {
+	inUse    int       // callers holding the client
+	lastUsed time.Time // last acquire or release, background use not counted
+}
+
+type backgroundUseKey struct{}
+
+// withBackgroundUse mark ctx of periodic work such as metrics sampling, in lazy mode it only uses
+// connections that are already open and does not count as use, so they still close once idle
+func withBackgroundUse(ctx context.Context) context.Context {
+	return context.WithValue(ctx, backgroundUseKey{}, true)
+}
+
+func backgroundUse(ctx context.Context) bool {
+	background, _ := ctx.Value(backgroundUseKey{}).(bool)
+	return background
+}
+
+// AcquireClient SSH client of server for one use, in lazy mode the connection is opened on demand
+// and callers queue while the pool is saturated, release must be called once the client is not used anymore
+func (s *Server) AcquireClient(ctx context.Context) (*ssh.Client, func(), error) {
+	if !connectionPool.lazyMode {
+		// check if SSH client is valid
+		if !s.CheckSSHConnection() {
+			return nil, nil, fmt.Errorf("%w: SSH not init", ErrConnectionBroken)
+		}
+		return s.SSHClient, func() {}, nil
+	}
+	return connectionPool.acquire(ctx, s, true)
+}
+
+// number of open or opening connections, must be called with c.mutex held
+func (c *ConnectionPool) openClientsLocked() int {
+	count := 0
+	for _, server := range c.servers {
+		if server.SSHClient != nil || server.reconnecting {
+			count++
+		}
+	}
+	return count
+}
+
+// wake up callers waiting for a free connection, must be called with c.mutex held
+func (c *ConnectionPool) notifyLocked() {
+	close(c.released)
+	c.released = make(chan struct{})
+}
+
+// close connection of server and mark it idle, must be called with c.mutex held
+// the caller broadcasts the change with emitIdle once the mutex is released
+func (c *ConnectionPool) setIdleLocked(server *Server) {
+	if server.SSHClient != nil {
+		server.SSHClient.Close()
+		server.SSHClient = nil
+	}
+	server.Status = constant.Idle
+	c.notifyLocked()
+}
+
+// broadcast servers set idle over WebSocket, call without c.mutex held so a slow browser cannot stall the pool
+func emitIdle(serverIDs []uint) {
+	for _, serverID := range serverIDs {
+		ws.SendMessage(ws.Message{
+			ServerID:     serverID,
+			ServerStatus: constant.Idle,
+		})
+	}
+}
+
+// close the least recently used connection nobody holds, false if every connection is in use
+// the evicted server is appended to idled, must be called with c.mutex held
+func (c *ConnectionPool) evictIdleLocked(idled *[]uint) bool {
+	var victim *Server
+	for _, server := range c.servers {
+		if server.SSHClient == nil || server.reconnecting || server.lazy.inUse > 0 {
+			continue
+		}
+		if victim == nil || server.lazy.lastUsed.Before(victim.lazy.lastUsed) {
+			victim = server
+		}
+	}
+	if victim == nil {
+		return false
+	}
+	logs.Logger.Debug("evict idle SSH connection", zap.String("server_id", strconv.Itoa(int(victim.ID))))
+	c.setIdleLocked(victim)
+	*idled = append(*idled, victim.ID)
+	return true
+}
+
+// acquire client of server, opening it if needed, wait decides whether to queue when the pool is saturated
+func (c *ConnectionPool) acquire(ctx context.Context, server *Server, wait bool) (*ssh.Client, func(), error) {
+	ctx, cancel := context.WithTimeout(ctx, connectionWaitTimeout())
+	defer cancel()
+
+	for {
+		var idled []uint
+		c.mutex.Lock()
+		if current, exists := c.servers[server.ID]; !exists || current != server {
+			c.mutex.Unlock()
+			return nil, nil, fmt.Errorf("%w: server removed", ErrConnectionBroken)
+		}
+
+		switch {
+		case server.Status == constant.Connected && server.SSHClient != nil:
+			client := server.SSHClient
+			touch := !backgroundUse(ctx)
+			server.lazy.inUse++
+			if touch {
+				server.lazy.lastUsed = time.Now()
+			}
+			c.mutex.Unlock()
+			return client, c.releaseFunc(server, touch), nil
+		case backgroundUse(ctx):
+			c.mutex.Unlock()
+			return nil, nil, fmt.Errorf("%w: no open connection", ErrConnectionBroken)
+		case server.reconnecting:
+			// another caller is connecting, wait for it
+		case server.Status == constant.Disconnected && server.NextRetryAt.After(time.Now()):
+			// respect backoff, connecting again now would fail the same way
+			lastError, nextRetryAt := server.LastError, server.NextRetryAt
+			c.mutex.Unlock()
+			return nil, nil, fmt.Errorf("%w: %s, next retry at %s", ErrConnectionBroken, lastError, nextRetryAt.Format(time.RFC3339))
+		case c.openClientsLocked() < c.maxConnectionNumber || c.evictIdleLocked(&idled):
+			server.reconnecting = true
+			c.mutex.Unlock()
+			emitIdle(idled)
+			if err := c.reconnect(server); err != nil {
+				return nil, nil, fmt.Errorf("%w: %v", ErrConnectionBroken, err)
+			}
+			continue
+		}
+
+		released := c.released
+		c.mutex.Unlock()
+		if !wait {
+			return nil, nil, errPoolSaturated
+		}
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return nil, nil, fmt.Errorf("wait for free connection failed, pool saturated: %w", ctx.Err())
+		}
+	}
+}
+
+// register server in lazy mode, it is connected right away only if a connection is free
+func (c *ConnectionPool) newLazyConnection(server *Server) error {
+	server.Status = constant.Idle
+	server.reconnecting = false
+	if err := c.AddServerToConnectionPool(server); err != nil {
+		return err
+	}
+
+	_, release, err := c.acquire(context.Background(), server, false)
+	if errors.Is(err, errPoolSaturated) {
+		// stays idle until a command needs it
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	release()
+	logs.Logger.Info("SSH connect successfully", zap.String("ip", server.IP), zap.String("id", strconv.Itoa(int(server.ID))))
+	return nil
+}
+
+// touch false leaves lastUsed as it was, for background use
+func (c *ConnectionPool) releaseFunc(server *Server, touch bool) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			c.mutex.Lock()
+			defer c.mutex.Unlock()
+			server.lazy.inUse--
+			if touch {
+				server.lazy.lastUsed = time.Now()
+			}
+			c.notifyLocked()
+		})
+	}
+}
+
+// close connections unused for longer than the idle timeout
+func (c *ConnectionPool) reapIdleClients() {
+	deadline := time.Now().Add(-idleTimeout())
+	var idled []uint
+	c.mutex.Lock()
+	for _, server := range c.servers {
+		if server.SSHClient == nil || server.reconnecting || server.lazy.inUse > 0 {
+			continue
+		}
+		if server.lazy.lastUsed.Before(deadline) {
+			logs.Logger.Debug("close idle SSH connection", zap.String("server_id", strconv.Itoa(int(server.ID))))
+			c.setIdleLocked(server)
+			idled = append(idled, server.ID)
+		}
+	}
+	c.mutex.Unlock()
+	emitIdle(idled)
+}
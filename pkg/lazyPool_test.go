@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// server with an open lazy connection last used at lastUsed, removed again before the test ends
+func addLazyServer(t *testing.T, id uint, status constant.ConnectStatus, lastUsed time.Time) *Server {
+	t.Helper()
+	server := &Server{ID: id, Status: status, lazy: lazyState{lastUsed: lastUsed}}
+	if status == constant.Connected {
+		server.SSHClient = &ssh.Client{}
+	}
+	connectionPool.mutex.Lock()
+	connectionPool.servers[id] = server
+	connectionPool.mutex.Unlock()
+	t.Cleanup(func() {
+		connectionPool.mutex.Lock()
+		delete(connectionPool.servers, id)
+		connectionPool.mutex.Unlock()
+	})
+	return server
+}
+
+func lazyLastUsed(server *Server) time.Time {
+	connectionPool.mutex.Lock()
+	defer connectionPool.mutex.Unlock()
+	return server.lazy.lastUsed
+}
+
+func TestBackgroundUseKeepsIdleTime(t *testing.T) {
+	lastUsed := time.Now().Add(-time.Hour)
+	server := addLazyServer(t, 301, constant.Connected, lastUsed)
+
+	_, release, err := connectionPool.acquire(withBackgroundUse(context.Background()), server, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if got := lazyLastUsed(server); !got.Equal(lastUsed) {
+		t.Fatalf("background use moved lastUsed to %v", got)
+	}
+
+	_, release, err = connectionPool.acquire(context.Background(), server, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if got := lazyLastUsed(server); !got.After(lastUsed) {
+		t.Fatalf("use left lastUsed at %v", got)
+	}
+}
+
+func TestBackgroundUseDoesNotConnect(t *testing.T) {
+	server := addLazyServer(t, 302, constant.Idle, time.Now().Add(-time.Hour))
+	_, _, err := connectionPool.acquire(withBackgroundUse(context.Background()), server, false)
+	if !errors.Is(err, ErrConnectionBroken) {
+		t.Fatalf("err = %v, want ErrConnectionBroken", err)
+	}
+	connectionPool.mutex.Lock()
+	defer connectionPool.mutex.Unlock()
+	if server.reconnecting || server.SSHClient != nil {
+		t.Fatal("background use opened the connection")
+	}
+}
@@ -0,0 +1,15 @@
+//go:build !unix
+
+package pkg
+
+import (
+	"context"
+	"os/exec"
+)
+
+// shell command of cmd, cmd /C on windows
+func localShellCommand(ctx context.Context, cmd string) *exec.Cmd {
+	command := exec.CommandContext(ctx, "cmd", "/C", cmd)
+	command.WaitDelay = localWaitDelay
+	return command
+}
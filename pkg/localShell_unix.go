@@ -0,0 +1,20 @@
+//go:build unix
+
+package pkg
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+)
+
+// shell command of cmd in its own process group, so canceling it also kills what the shell started
+func localShellCommand(ctx context.Context, cmd string) *exec.Cmd {
+	command := exec.CommandContext(ctx, "/bin/sh", "-c", cmd)
+	command.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	command.Cancel = func() error {
+		return syscall.Kill(-command.Process.Pid, syscall.SIGKILL)
+	}
+	command.WaitDelay = localWaitDelay
+	return command
+}
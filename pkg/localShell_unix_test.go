@@ -0,0 +1,64 @@
+//go:build unix
+
+package pkg
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestLocalExecutorBackgroundProcess(t *testing.T) {
+	// the background sleep inherits stdout and stderr, as nohup ./app & does in a start script
+	startTime := time.Now()
+	result, err := LocalExecutor{}.Execute(context.Background(), "sleep 10 & echo started")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.Success() || strings.TrimSpace(result.Stdout) != "started" {
+		t.Fatalf("result: %+v", result)
+	}
+	if elapsed := time.Since(startTime); elapsed > localWaitDelay+5*time.Second {
+		t.Fatalf("waited %v for the background process", elapsed)
+	}
+}
+
+func TestLocalExecutorTimeoutKillsProcessGroup(t *testing.T) {
+	pidFile := filepath.Join(t.TempDir(), "pid")
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	startTime := time.Now()
+	_, err := LocalExecutor{}.Execute(ctx, "sleep 30 & echo $! > "+shellQuote(pidFile)+"; wait")
+	if err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Fatalf("err = %v, want canceled", err)
+	}
+	if elapsed := time.Since(startTime); elapsed > localWaitDelay+5*time.Second {
+		t.Fatalf("timed out command returned after %v", elapsed)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the killed child may linger as a zombie of the shell for a moment
+	deadline := time.Now().Add(2 * time.Second)
+	for syscall.Kill(pid, 0) == nil && time.Now().Before(deadline) {
+		if state, _ := os.ReadFile(filepath.Join("/proc", strconv.Itoa(pid), "stat")); strings.Contains(string(state), ") Z ") {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if syscall.Kill(pid, 0) == nil {
+		t.Fatalf("background process %d survived the timeout", pid)
+	}
+}
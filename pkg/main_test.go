@@ -0,0 +1,15 @@
+package pkg
+
+import (
+	"GolangOM/logs"
+	"os"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+// tests run without config/configs.yaml, keep the production logger from writing logs/app.log
+func TestMain(m *testing.M) {
+	logs.Logger = zap.NewNop()
+	os.Exit(m.Run())
+}
@@ -0,0 +1,319 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"GolangOM/logs"
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+)
+
+// metric names, labels are given in braces
+const (
+	MetricCPUUsedPercent    = "cpu_used_percent"
+	MetricMemoryUsedPercent = "memory_used_percent"
+	MetricMemoryUsedBytes   = "memory_used_bytes"
+	MetricMemoryTotalBytes  = "memory_total_bytes"
+	MetricSwapUsedPercent   = "swap_used_percent"
+	MetricLoad1             = "load1"
+	MetricLoad5             = "load5"
+	MetricLoad15            = "load15"
+	MetricLoad5PerCPU       = "load5_per_cpu"                     // load5 divided by online CPUs, comparable across hosts
+	MetricDiskUsedPercent   = "disk_used_percent"                 // {mount}
+	MetricDiskUsedBytes     = "disk_used_bytes"                   // {mount}
+	MetricDiskTotalBytes    = "disk_total_bytes"                  // {mount}
+	MetricNetworkRxRate     = "network_receive_bytes_per_second"  // {device}
+	MetricNetworkTxRate     = "network_transmit_bytes_per_second" // {device}
+)
+
+// MetricPoint one value of a sample
+type MetricPoint struct {
+	Name   string
+	Labels map[string]string // such as mount of disk metrics, nil if none
+	Value  float64
+}
+
+// MetricSample resource usage of a server at one time
+type MetricSample struct {
+	ServerID uint
+	Time     time.Time
+	Points   []MetricPoint
+}
+
+// FormatLabels canonical form of labels sorted by name, such as mount="/",
+// empty for no labels
+func FormatLabels(labels map[string]string) string {
+	names := slices.Sorted(maps.Keys(labels))
+	parts := make([]string, 0, len(names))
+	for _, name := range names {
+		parts = append(parts, name+"="+strconv.Quote(labels[name]))
+	}
+	return strings.Join(parts, ",")
+}
+
+// counters from /proc that only make sense as a rate between two samples
+type metricCounters struct {
+	time     time.Time
+	cpuTotal uint64
+	cpuIdle  uint64
+	rxBytes  map[string]uint64 // by network device
+	txBytes  map[string]uint64
+}
+
+// MetricsCollector samples resource usage of connected servers and the local server periodically
+type MetricsCollector struct {
+	mutex    sync.RWMutex
+	previous map[uint]*metricCounters
+	latest   map[uint]*MetricSample
+	handler  func(sample *MetricSample)
+}
+
+var metricsCollector = MetricsCollector{
+	previous: make(map[uint]*metricCounters),
+	latest:   make(map[uint]*MetricSample),
+}
+
+func GetMetricsCollector() *MetricsCollector {
+	return &metricsCollector
+}
+
+// SetSampleHandler handler called with every sample, such as persisting it
+func (m *MetricsCollector) SetSampleHandler(handler func(sample *MetricSample)) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.handler = handler
+}
+
+// LatestSample last sample of server, nil if none was taken yet
+func (m *MetricsCollector) LatestSample(serverID uint) *MetricSample {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.latest[serverID]
+}
+
+// Forget drop state of a removed server
+func (m *MetricsCollector) Forget(serverID uint) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.previous, serverID)
+	delete(m.latest, serverID)
+}
+
+// section marker of the metrics script output
+const metricsMarker = "==golang-om-metrics:"
+
+var metricsScript = strings.Join([]string{
+	"echo '" + metricsMarker + "stat'; head -n 1 /proc/stat",
+	"echo '" + metricsMarker + "cpus'; grep -c '^cpu[0-9]' /proc/stat",
+	"echo '" + metricsMarker + "meminfo'; cat /proc/meminfo",
+	"echo '" + metricsMarker + "loadavg'; cat /proc/loadavg",
+	"echo '" + metricsMarker + "df'; df -PkT 2>/dev/null || df -Pk 2>/dev/null",
+	"echo '" + metricsMarker + "netdev'; cat /proc/net/dev",
+	"true",
+}, "\n")
+
+// StartMetricsTicker sample every interval seconds, runs next to the connection check ticker
+// servers that are not connected are skipped, so lazy connections are never opened for metrics,
+// and sampling does not count as use, so they are still closed once idle
+func (m *MetricsCollector) StartMetricsTicker(interval int) {
+	if !viper.GetBool("Metrics.Enabled") {
+		return
+	}
+	if interval <= 0 {
+		interval = 60
+	}
+	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, server := range GetConnectionPool().GetServers() {
+			if server.ID != constant.LocalServerID && server.Status != constant.Connected {
+				continue
+			}
+			go func() {
+				ctx, cancel := context.WithTimeout(withBackgroundUse(context.Background()), time.Duration(interval)*time.Second)
+				defer cancel()
+				if _, err := m.Sample(ctx, server); err != nil {
+					logs.Logger.Debug("sample metrics failed",
+						zap.String("server_id", strconv.Itoa(int(server.ID))),
+						zap.Error(err))
+				}
+			}()
+		}
+	}
+}
+
+// Sample read resource usage of server and pass it to the sample handler,
+// rates such as CPU usage are computed against the previous sample and missing in the first one
+func (m *MetricsCollector) Sample(ctx context.Context, server *Server) (*MetricSample, error) {
+	result, err := server.ExecuteCommandContext(ctx, metricsScript)
+	if err != nil {
+		return nil, err
+	}
+	if !result.Success() {
+		return nil, fmt.Errorf("sample metrics failed: %s, err out: %s", result.exitDescription(), result.Stderr)
+	}
+
+	now := time.Now()
+	sections := splitSections(result.Stdout, metricsMarker)
+	counters := parseMetricCounters(sections)
+	counters.time = now
+
+	sample := &MetricSample{ServerID: server.ID, Time: now}
+	sample.Points = append(sample.Points, parseMemoryMetrics(sections["meminfo"])...)
+	loadPoints := parseLoadMetrics(firstLine(sections["loadavg"]))
+	sample.Points = append(sample.Points, loadPoints...)
+	if cpus, _ := strconv.Atoi(firstLine(sections["cpus"])); cpus > 0 && len(loadPoints) == 3 {
+		sample.Points = append(sample.Points, MetricPoint{Name: MetricLoad5PerCPU, Value: loadPoints[1].Value / float64(cpus)})
+	}
+	for _, fs := range parseDf(sections["df"]) {
+		if fs.Size == 0 {
+			continue
+		}
+		labels := map[string]string{"mount": fs.Mount}
+		sample.Points = append(sample.Points,
+			MetricPoint{Name: MetricDiskUsedPercent, Labels: labels, Value: float64(fs.Used) * 100 / float64(fs.Size)},
+			MetricPoint{Name: MetricDiskUsedBytes, Labels: labels, Value: float64(fs.Used)},
+			MetricPoint{Name: MetricDiskTotalBytes, Labels: labels, Value: float64(fs.Size)},
+		)
+	}
+
+	m.mutex.Lock()
+	previous := m.previous[server.ID]
+	m.previous[server.ID] = counters
+	m.mutex.Unlock()
+	if previous != nil {
+		sample.Points = append(sample.Points, rateMetrics(previous, counters)...)
+	}
+	if len(sample.Points) == 0 {
+		return nil, fmt.Errorf("no metrics in output, /proc is not available")
+	}
+
+	m.mutex.Lock()
+	m.latest[server.ID] = sample
+	handler := m.handler
+	m.mutex.Unlock()
+	if handler != nil {
+		handler(sample)
+	}
+	alertManager.evaluate(sample)
+	return sample, nil
+}
+
+func parseMetricCounters(sections map[string][]string) *metricCounters {
+	counters := &metricCounters{
+		rxBytes: make(map[string]uint64),
+		txBytes: make(map[string]uint64),
+	}
+
+	// cpu  user nice system idle iowait irq softirq steal guest guest_nice
+	fields := strings.Fields(firstLine(sections["stat"]))
+	if len(fields) > 5 && fields[0] == "cpu" {
+		// guest time is already part of user time
+		for i, field := range fields[1:min(len(fields), 9)] {
+			value, _ := strconv.ParseUint(field, 10, 64)
+			counters.cpuTotal += value
+			if i == 3 || i == 4 {
+				counters.cpuIdle += value
+			}
+		}
+	}
+
+	// eth0: rx_bytes rx_packets ... (8 receive fields) tx_bytes ...
+	for _, line := range sections["netdev"] {
+		device, stats, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		device = strings.TrimSpace(device)
+		fields := strings.Fields(stats)
+		if device == "lo" || len(fields) < 9 {
+			continue
+		}
+		counters.rxBytes[device], _ = strconv.ParseUint(fields[0], 10, 64)
+		counters.txBytes[device], _ = strconv.ParseUint(fields[8], 10, 64)
+	}
+	return counters
+}
+
+func parseMemoryMetrics(lines []string) []MetricPoint {
+	values := make(map[string]uint64)
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 {
+			kb, _ := strconv.ParseUint(fields[1], 10, 64)
+			values[strings.TrimSuffix(fields[0], ":")] = kb * 1024
+		}
+	}
+
+	total := values["MemTotal"]
+	if total == 0 {
+		return nil
+	}
+	available, ok := values["MemAvailable"]
+	if !ok {
+		// kernels before 3.14
+		available = values["MemFree"] + values["Buffers"] + values["Cached"]
+	}
+	used := total - min(available, total)
+	points := []MetricPoint{
+		{Name: MetricMemoryUsedPercent, Value: float64(used) * 100 / float64(total)},
+		{Name: MetricMemoryUsedBytes, Value: float64(used)},
+		{Name: MetricMemoryTotalBytes, Value: float64(total)},
+	}
+	if swapTotal := values["SwapTotal"]; swapTotal > 0 {
+		swapUsed := swapTotal - min(values["SwapFree"], swapTotal)
+		points = append(points, MetricPoint{Name: MetricSwapUsedPercent, Value: float64(swapUsed) * 100 / float64(swapTotal)})
+	}
+	return points
+}
+
+// 0.52 0.58 0.59 1/467 12345
+func parseLoadMetrics(line string) []MetricPoint {
+	fields := strings.Fields(line)
+	if len(fields) < 3 {
+		return nil
+	}
+	points := make([]MetricPoint, 0, 3)
+	for i, name := range []string{MetricLoad1, MetricLoad5, MetricLoad15} {
+		value, err := strconv.ParseFloat(fields[i], 64)
+		if err != nil {
+			return nil
+		}
+		points = append(points, MetricPoint{Name: name, Value: value})
+	}
+	return points
+}
+
+// CPU usage and network throughput between two samples, counters that went backwards (reboot) are skipped
+func rateMetrics(previous *metricCounters, current *metricCounters) []MetricPoint {
+	var points []MetricPoint
+	if current.cpuTotal > previous.cpuTotal && current.cpuIdle >= previous.cpuIdle {
+		total := current.cpuTotal - previous.cpuTotal
+		idle := min(current.cpuIdle-previous.cpuIdle, total)
+		points = append(points, MetricPoint{Name: MetricCPUUsedPercent, Value: float64(total-idle) * 100 / float64(total)})
+	}
+
+	seconds := current.time.Sub(previous.time).Seconds()
+	if seconds <= 0 {
+		return points
+	}
+	for _, device := range slices.Sorted(maps.Keys(current.rxBytes)) {
+		labels := map[string]string{"device": device}
+		if rx, ok := previous.rxBytes[device]; ok && current.rxBytes[device] >= rx {
+			points = append(points, MetricPoint{Name: MetricNetworkRxRate, Labels: labels, Value: float64(current.rxBytes[device]-rx) / seconds})
+		}
+		if tx, ok := previous.txBytes[device]; ok && current.txBytes[device] >= tx {
+			points = append(points, MetricPoint{Name: MetricNetworkTxRate, Labels: labels, Value: float64(current.txBytes[device]-tx) / seconds})
+		}
+	}
+	return points
+}
@@ -0,0 +1,250 @@
+package pkg
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+// output of metricsScript captured on a 4 CPU host, cpu and netdev counters are filled in per sample
+const metricsOutputTemplate = `==golang-om-metrics:stat
+cpu  {cpu}
+==golang-om-metrics:cpus
+4
+==golang-om-metrics:meminfo
+MemTotal:        8000000 kB
+MemFree:          500000 kB
+MemAvailable:    2000000 kB
+Buffers:          100000 kB
+Cached:          1500000 kB
+SwapCached:            0 kB
+SwapTotal:       1000000 kB
+SwapFree:         750000 kB
+==golang-om-metrics:loadavg
+0.52 1.20 0.59 1/467 12345
+==golang-om-metrics:df
+Filesystem     Type     1024-blocks     Used Available Capacity Mounted on
+devtmpfs       devtmpfs     3066620        0   3066620       0% /dev
+tmpfs          tmpfs        6147400        0   6147400       0% /dev/shm
+/dev/vda1      ext4       100000000 25000000  75000000      25% /
+/dev/vdb1      xfs          2000000  1500000    500000      75% /mnt/my data
+==golang-om-metrics:netdev
+Inter-|   Receive                                                |  Transmit
+ face |bytes    packets errs drop fifo frame compressed multicast|bytes    packets errs drop fifo colls carrier compressed
+    lo: 143116523   15289    0    0    0     0          0         0 143116523   15289    0    0    0     0       0          0
+  eth0: {eth0}
+`
+
+func metricsOutput(cpu string, eth0 string) string {
+	return strings.NewReplacer("{cpu}", cpu, "{eth0}", eth0).Replace(metricsOutputTemplate)
+}
+
+// netdev line of eth0 with rx and tx bytes
+func netdevCounters(rx string, tx string) string {
+	return rx + "     202    0    0    0     0          0         0 " + tx + "     204    0    0    0     0       0          0"
+}
+
+func findMetric(points []MetricPoint, name string, labels string) (float64, bool) {
+	for _, point := range points {
+		if point.Name == name && FormatLabels(point.Labels) == labels {
+			return point.Value, true
+		}
+	}
+	return 0, false
+}
+
+func TestParseMetricCounters(t *testing.T) {
+	output := metricsOutput("111659 0 16730 618707 561 0 16 3276 100 0", netdevCounters("23883", "19508"))
+	counters := parseMetricCounters(splitSections(output, metricsMarker))
+	// user nice system idle iowait irq softirq steal, guest is part of user already
+	if counters.cpuTotal != 111659+16730+618707+561+16+3276 || counters.cpuIdle != 618707+561 {
+		t.Fatalf("cpu counters: total %d, idle %d", counters.cpuTotal, counters.cpuIdle)
+	}
+	if len(counters.rxBytes) != 1 || counters.rxBytes["eth0"] != 23883 || counters.txBytes["eth0"] != 19508 {
+		t.Fatalf("network counters: rx %v, tx %v", counters.rxBytes, counters.txBytes)
+	}
+
+	// old kernels print only four cpu fields
+	counters = parseMetricCounters(map[string][]string{"stat": {"cpu  100 0 50 850"}})
+	if counters.cpuTotal != 0 {
+		t.Fatalf("short cpu line parsed: %d", counters.cpuTotal)
+	}
+	counters = parseMetricCounters(map[string][]string{"stat": {"cpu  100 0 50 850 0"}})
+	if counters.cpuTotal != 1000 || counters.cpuIdle != 850 {
+		t.Fatalf("five field cpu line: total %d, idle %d", counters.cpuTotal, counters.cpuIdle)
+	}
+}
+
+func TestParseMemoryMetrics(t *testing.T) {
+	sections := splitSections(metricsOutput("", ""), metricsMarker)
+	points := parseMemoryMetrics(sections["meminfo"])
+	want := map[string]float64{
+		MetricMemoryTotalBytes:  8000000 * 1024,
+		MetricMemoryUsedBytes:   6000000 * 1024,
+		MetricMemoryUsedPercent: 75,
+		MetricSwapUsedPercent:   25,
+	}
+	if len(points) != len(want) {
+		t.Fatalf("points: %+v", points)
+	}
+	for name, value := range want {
+		if got, _ := findMetric(points, name, ""); got != value {
+			t.Errorf("%s = %v, want %v", name, got, value)
+		}
+	}
+
+	// kernels before 3.14 have no MemAvailable, hosts without swap have no swap metric
+	points = parseMemoryMetrics([]string{
+		"MemTotal:        1000000 kB",
+		"MemFree:          100000 kB",
+		"Buffers:           50000 kB",
+		"Cached:           250000 kB",
+		"SwapTotal:             0 kB",
+		"SwapFree:              0 kB",
+	})
+	if got, _ := findMetric(points, MetricMemoryUsedPercent, ""); got != 60 {
+		t.Errorf("used percent without MemAvailable = %v", got)
+	}
+	if _, ok := findMetric(points, MetricSwapUsedPercent, ""); ok {
+		t.Error("swap metric without swap")
+	}
+
+	// containers may report more available than total
+	points = parseMemoryMetrics([]string{"MemTotal: 1000 kB", "MemAvailable: 2000 kB"})
+	if got, _ := findMetric(points, MetricMemoryUsedBytes, ""); got != 0 {
+		t.Errorf("used bytes with available above total = %v", got)
+	}
+	if points := parseMemoryMetrics([]string{"MemFree: 100 kB"}); points != nil {
+		t.Errorf("points without MemTotal: %+v", points)
+	}
+}
+
+func TestRateMetrics(t *testing.T) {
+	start := time.Date(2026, 10, 17, 6, 0, 0, 0, time.UTC)
+	counters := func(offset time.Duration, total uint64, idle uint64, rx uint64, tx uint64) *metricCounters {
+		return &metricCounters{
+			time:     start.Add(offset),
+			cpuTotal: total,
+			cpuIdle:  idle,
+			rxBytes:  map[string]uint64{"eth0": rx},
+			txBytes:  map[string]uint64{"eth0": tx},
+		}
+	}
+	tests := []struct {
+		name     string
+		previous *metricCounters
+		current  *metricCounters
+		want     map[string]float64 // missing metrics must not be reported
+	}{
+		{
+			name:     "steady",
+			previous: counters(0, 1000, 800, 1000, 5000),
+			current:  counters(10*time.Second, 2000, 1550, 21000, 5500),
+			want:     map[string]float64{MetricCPUUsedPercent: 25, MetricNetworkRxRate: 2000, MetricNetworkTxRate: 50},
+		},
+		{
+			name:     "reboot resets every counter",
+			previous: counters(0, 50000000, 40000000, 900000000, 800000000),
+			current:  counters(60*time.Second, 3000, 2000, 12000, 3000),
+			want:     map[string]float64{},
+		},
+		{
+			name:     "32 bit network counter wrapped",
+			previous: counters(0, 1000, 800, math.MaxUint32-1000, 5000),
+			current:  counters(10*time.Second, 2000, 1800, 4000, 6000),
+			want:     map[string]float64{MetricCPUUsedPercent: 0, MetricNetworkTxRate: 100},
+		},
+		{
+			name:     "idle counter went backwards",
+			previous: counters(0, 1000, 800, 0, 0),
+			current:  counters(10*time.Second, 2000, 700, 0, 0),
+			want:     map[string]float64{MetricNetworkRxRate: 0, MetricNetworkTxRate: 0},
+		},
+		{
+			name:     "idle above total is capped",
+			previous: counters(0, 1000, 800, 0, 0),
+			current:  counters(10*time.Second, 1100, 1000, 0, 0),
+			want:     map[string]float64{MetricCPUUsedPercent: 0, MetricNetworkRxRate: 0, MetricNetworkTxRate: 0},
+		},
+		{
+			name:     "same time",
+			previous: counters(0, 1000, 800, 0, 0),
+			current:  counters(0, 2000, 1600, 100, 100),
+			want:     map[string]float64{MetricCPUUsedPercent: 20},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			points := rateMetrics(tt.previous, tt.current)
+			if len(points) != len(tt.want) {
+				t.Fatalf("points: %+v", points)
+			}
+			for name, value := range tt.want {
+				labels := ""
+				if name != MetricCPUUsedPercent {
+					labels = `device="eth0"`
+				}
+				got, ok := findMetric(points, name, labels)
+				if !ok || math.Abs(got-value) > 1e-9 {
+					t.Errorf("%s = %v (reported %v), want %v", name, got, ok, value)
+				}
+			}
+		})
+	}
+
+	// devices that showed up since the previous sample have no rate yet
+	previous := counters(0, 1000, 800, 100, 100)
+	current := counters(10*time.Second, 2000, 1600, 200, 200)
+	current.rxBytes["eth1"], current.txBytes["eth1"] = 50, 50
+	for _, point := range rateMetrics(previous, current) {
+		if point.Labels["device"] == "eth1" {
+			t.Fatalf("rate of new device: %+v", point)
+		}
+	}
+}
+
+func TestSampleMetrics(t *testing.T) {
+	fake := addFakeServer(t, 110)
+	server := GetConnectionPool().GetServerByID(110)
+	collector := &MetricsCollector{previous: make(map[uint]*metricCounters), latest: make(map[uint]*MetricSample)}
+
+	fake.SetResult(metricsScript, &CommandResult{Stdout: metricsOutput("1000 0 200 800 0 0 0 0", netdevCounters("1000", "1000"))})
+	first, err := collector.Sample(context.Background(), server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := findMetric(first.Points, MetricCPUUsedPercent, ""); ok {
+		t.Fatal("first sample has a cpu rate")
+	}
+	if got, _ := findMetric(first.Points, MetricLoad5PerCPU, ""); got != 0.3 {
+		t.Errorf("load5 per cpu = %v", got)
+	}
+	if got, _ := findMetric(first.Points, MetricDiskUsedPercent, `mount="/mnt/my data"`); got != 75 {
+		t.Errorf("disk used percent of mount with a space = %v", got)
+	}
+	if _, ok := findMetric(first.Points, MetricDiskUsedPercent, `mount="/dev/shm"`); ok {
+		t.Error("tmpfs reported")
+	}
+	if collector.LatestSample(110) != first {
+		t.Error("latest sample not kept")
+	}
+
+	fake.SetResult(metricsScript, &CommandResult{Stdout: metricsOutput("1500 0 300 1000 0 0 0 0", netdevCounters("1000000", "1000"))})
+	second, err := collector.Sample(context.Background(), server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := findMetric(second.Points, MetricCPUUsedPercent, ""); math.Abs(got-75) > 1e-9 {
+		t.Errorf("cpu used percent = %v", got)
+	}
+	if got, ok := findMetric(second.Points, MetricNetworkRxRate, `device="eth0"`); !ok || got <= 0 {
+		t.Errorf("network receive rate = %v, %v", got, ok)
+	}
+
+	fake.SetResult(metricsScript, &CommandResult{Stdout: "==golang-om-metrics:stat\n"})
+	if _, err := collector.Sample(context.Background(), server); err == nil {
+		t.Error("sample without /proc succeeded")
+	}
+}
@@ -0,0 +1,163 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"GolangOM/ws"
+	"math/rand/v2"
+	"time"
+
+	"github.com/spf13/viper"
+	"golang.org/x/crypto/ssh"
+)
+
+// ConnectionEvent connected or disconnected transition of a server
+type ConnectionEvent struct {
+	ServerID uint
+	Status   constant.ConnectStatus
+	Reason   string // error that caused a disconnect, empty when connected
+	Time     time.Time
+}
+
+// SetConnectionEventHandler handler called on every status transition, such as persisting history
+// the handler runs in its own goroutine and must be safe for concurrent use
+func (c *ConnectionPool) SetConnectionEventHandler(handler func(event ConnectionEvent)) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.eventHandler = handler
+}
+
+// delay before reconnect attempt after failures failed attempts in a row,
+// exponential from Server.ReconnectBaseDelay up to Server.ReconnectMaxDelay with equal jitter,
+// so servers that went down together do not retry in lockstep
+func reconnectDelay(failures int) time.Duration {
+	base := viper.GetInt("Server.ReconnectBaseDelay")
+	if base <= 0 {
+		base = 5
+	}
+	maxDelay := viper.GetInt("Server.ReconnectMaxDelay")
+	if maxDelay <= 0 {
+		maxDelay = 600
+	}
+
+	delay := time.Duration(maxDelay) * time.Second
+	if shift := failures - 1; shift < 20 {
+		delay = min(delay, time.Duration(base)*time.Second<<max(shift, 0))
+	}
+	half := delay / 2
+	return half + rand.N(half+1)
+}
+
+// set server connected with client, must be called with c.mutex held
+// returns the transition event, nil if the server was already connected
+func (c *ConnectionPool) setConnectedLocked(server *Server, client *ssh.Client) *ConnectionEvent {
+	wasConnected := server.Status == constant.Connected
+	if server.SSHClient != nil && server.SSHClient != client {
+		server.SSHClient.Close()
+	}
+	server.SSHClient = client
+	server.Status = constant.Connected
+	server.LastCheckTime = time.Now()
+	server.LastError = ""
+	server.NextRetryAt = time.Time{}
+	server.failures = 0
+	server.lazy.lastUsed = server.LastCheckTime
+
+	// servers behind it may have failed because of it, retry them right away
+	for _, child := range c.servers {
+		if child.JumpServerID == server.ID && child.Status == constant.Disconnected {
+			child.NextRetryAt = time.Time{}
+		}
+	}
+
+	if wasConnected {
+		return nil
+	}
+	return &ConnectionEvent{ServerID: server.ID, Status: constant.Connected, Time: server.LastCheckTime}
+}
+
+// set server disconnected because of err, must be called with c.mutex held
+// attempt is true when err comes from a failed connect attempt, which increases the backoff,
+// a dropped connection is retried right away
+func (c *ConnectionPool) setDisconnectedLocked(server *Server, err error, attempt bool) *ConnectionEvent {
+	wasDisconnected := server.Status == constant.Disconnected
+	if server.SSHClient != nil {
+		server.SSHClient.Close()
+		server.SSHClient = nil
+	}
+	server.Status = constant.Disconnected
+	server.LastCheckTime = time.Now()
+	server.LastError = err.Error()
+	if attempt {
+		server.failures++
+		server.NextRetryAt = time.Now().Add(reconnectDelay(server.failures))
+	} else {
+		server.NextRetryAt = time.Now()
+	}
+
+	if wasDisconnected {
+		return nil
+	}
+	return &ConnectionEvent{ServerID: server.ID, Status: constant.Disconnected, Reason: server.LastError, Time: server.LastCheckTime}
+}
+
+// broadcast transition over WebSocket and pass it to the event handler, call without c.mutex held
+func (c *ConnectionPool) emitConnectionEvent(event *ConnectionEvent) {
+	if event == nil {
+		return
+	}
+	ws.SendMessage(ws.Message{
+		ServerID:     event.ServerID,
+		ServerStatus: event.Status,
+	})
+
+	c.mutex.RLock()
+	handler := c.eventHandler
+	c.mutex.RUnlock()
+	if handler != nil {
+		go handler(*event)
+	}
+}
+
+// mark server as reconnecting, false if another reconnect of it is in progress
+func (c *ConnectionPool) beginReconnect(server *Server) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if server.reconnecting {
+		return false
+	}
+	server.reconnecting = true
+	return true
+}
+
+// reconnect server and record the result, beginReconnect must have returned true
+func (c *ConnectionPool) reconnect(server *Server) error {
+	client, err := sshConnect(server.serverConfig())
+
+	c.mutex.Lock()
+	server.reconnecting = false
+	var event *ConnectionEvent
+	connected := false
+	if current, exists := c.servers[server.ID]; !exists || current != server {
+		// removed or replaced while connecting
+		if client != nil {
+			client.Close()
+		}
+	} else if err != nil {
+		event = c.setDisconnectedLocked(server, err, true)
+	} else {
+		event = c.setConnectedLocked(server, client)
+		connected = true
+	}
+	// callers waiting in acquire may use the connection or the slot now
+	c.notifyLocked()
+	c.mutex.Unlock()
+
+	c.emitConnectionEvent(event)
+	if connected {
+		// the host may have changed while it was away, such as a kernel upgrade
+		c.refreshFactsAsync(server)
+		// port forwards of the server were lost with the old connection
+		forwardManager.serverConnected(server.ID)
+	}
+	return err
+}
@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// label keys and values, such as env=prod or role=web, keys may use a dns style prefix like team.example.com/owner
+const (
+	maxLabelKeyLength   = 63
+	maxLabelValueLength = 255
+)
+
+func validLabelChar(r rune, key bool) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+		return true
+	case key && r == '/':
+		return true
+	}
+	return false
+}
+
+// ValidateLabels check keys and values of labels, values may be empty so a label can serve as a plain tag
+func ValidateLabels(labels map[string]string) error {
+	for key, value := range labels {
+		if key == "" || len(key) > maxLabelKeyLength {
+			return fmt.Errorf("label key %q must be 1 to %d characters", key, maxLabelKeyLength)
+		}
+		if len(value) > maxLabelValueLength {
+			return fmt.Errorf("value of label %q is longer than %d characters", key, maxLabelValueLength)
+		}
+		for _, r := range key {
+			if !validLabelChar(r, true) {
+				return fmt.Errorf("invalid character %q in label key %q", r, key)
+			}
+		}
+		for _, r := range value {
+			if !validLabelChar(r, false) {
+				return fmt.Errorf("invalid character %q in value of label %q", r, key)
+			}
+		}
+	}
+	return nil
+}
+
+// selector requirement operators
+const (
+	selectorEquals    = "="
+	selectorNotEquals = "!="
+	selectorIn        = "in"
+	selectorNotIn     = "notin"
+	selectorExists    = "exists"
+	selectorNotExists = "!"
+)
+
+type selectorRequirement struct {
+	key    string
+	op     string
+	values []string
+}
+
+func (r *selectorRequirement) matches(labels map[string]string) bool {
+	value, ok := labels[r.key]
+	switch r.op {
+	case selectorEquals:
+		return ok && value == r.values[0]
+	case selectorNotEquals:
+		return !ok || value != r.values[0]
+	case selectorIn:
+		return ok && slices.Contains(r.values, value)
+	case selectorNotIn:
+		return !ok || !slices.Contains(r.values, value)
+	case selectorExists:
+		return ok
+	case selectorNotExists:
+		return !ok
+	}
+	return false
+}
+
+// LabelSelector requirements on labels that must all hold, the empty selector matches everything
+type LabelSelector struct {
+	text         string
+	requirements []selectorRequirement
+}
+
+// ParseLabelSelector parse comma separated requirements:
+// env=prod, env!=prod, env in (prod,staging), env notin (dev), gpu (has label), !legacy (has no label)
+func ParseLabelSelector(text string) (*LabelSelector, error) {
+	selector := &LabelSelector{text: strings.TrimSpace(text)}
+	for _, part := range splitSelector(selector.text) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			return nil, fmt.Errorf("empty requirement in selector %q", text)
+		}
+		requirement, err := parseRequirement(part)
+		if err != nil {
+			return nil, err
+		}
+		selector.requirements = append(selector.requirements, requirement)
+	}
+	return selector, nil
+}
+
+// split at commas outside of parentheses
+func splitSelector(text string) []string {
+	if text == "" {
+		return nil
+	}
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range text {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, text[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, text[start:])
+}
+
+func parseRequirement(part string) (selectorRequirement, error) {
+	if key, ok := strings.CutPrefix(part, "!"); ok && !strings.Contains(key, "=") {
+		return selectorRequirement{key: strings.TrimSpace(key), op: selectorNotExists}, checkSelectorKey(strings.TrimSpace(key))
+	}
+	if key, value, ok := strings.Cut(part, "!="); ok {
+		return newValueRequirement(key, selectorNotEquals, value)
+	}
+	if key, value, ok := strings.Cut(part, "=="); ok {
+		return newValueRequirement(key, selectorEquals, value)
+	}
+	if key, value, ok := strings.Cut(part, "="); ok {
+		return newValueRequirement(key, selectorEquals, value)
+	}
+
+	fields := strings.Fields(part)
+	if len(fields) == 1 {
+		return selectorRequirement{key: fields[0], op: selectorExists}, checkSelectorKey(fields[0])
+	}
+	if len(fields) >= 2 && (fields[1] == selectorIn || fields[1] == selectorNotIn) {
+		key, op := fields[0], fields[1]
+		list := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(strings.TrimPrefix(part, key)), op))
+		if !strings.HasPrefix(list, "(") || !strings.HasSuffix(list, ")") {
+			return selectorRequirement{}, fmt.Errorf("values of %q must be in parentheses, such as %s %s (a,b)", part, key, op)
+		}
+		requirement := selectorRequirement{key: key, op: op}
+		for _, value := range strings.Split(list[1:len(list)-1], ",") {
+			value = strings.TrimSpace(value)
+			if err := ValidateLabels(map[string]string{key: value}); err != nil {
+				return selectorRequirement{}, err
+			}
+			requirement.values = append(requirement.values, value)
+		}
+		return requirement, nil
+	}
+	return selectorRequirement{}, fmt.Errorf("invalid selector requirement %q", part)
+}
+
+func newValueRequirement(key string, op string, value string) (selectorRequirement, error) {
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if err := ValidateLabels(map[string]string{key: value}); err != nil {
+		return selectorRequirement{}, err
+	}
+	return selectorRequirement{key: key, op: op, values: []string{value}}, nil
+}
+
+func checkSelectorKey(key string) error {
+	return ValidateLabels(map[string]string{key: ""})
+}
+
+// Empty true if the selector has no requirements
+func (s *LabelSelector) Empty() bool {
+	return s == nil || len(s.requirements) == 0
+}
+
+// Matches labels fulfil every requirement of the selector
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	if s == nil {
+		return true
+	}
+	for i := range s.requirements {
+		if !s.requirements[i].matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *LabelSelector) String() string {
+	if s == nil {
+		return ""
+	}
+	return s.text
+}
+
+// SelectServers pooled servers, including the local server, whose labels match selector
+func (c *ConnectionPool) SelectServers(selector *LabelSelector) []*Server {
+	servers := c.GetServers()
+	selected := make([]*Server, 0, len(servers))
+	for _, server := range servers {
+		if selector.Matches(server.Labels) {
+			selected = append(selected, server)
+		}
+	}
+	return selected
+}
+
+// labels of pooled server, nil if it does not exist
+func (c *ConnectionPool) serverLabels(serverID uint) map[string]string {
+	if serverID == LocalServer.ID {
+		return LocalServer.Labels
+	}
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	if server := c.servers[serverID]; server != nil {
+		return server.Labels
+	}
+	return nil
+}
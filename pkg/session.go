@@ -0,0 +1,160 @@
+package pkg
+
+import (
+	"GolangOM/logs"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrSessionBusy no SSH session could be opened in time because the server's sessions are all in use,
+// the command did not run, so its result says nothing about the server or app
+var ErrSessionBusy = errors.New("SSH sessions busy")
+
+// concurrent sessions per server, OpenSSH allows 10 by default (MaxSessions)
+func maxSessions() int {
+	limit := viper.GetInt("Server.MaxSessions")
+	if limit <= 0 {
+		limit = 8
+	}
+	return limit
+}
+
+// how long callers queue for a free session
+func sessionWaitTimeout() time.Duration {
+	timeout := viper.GetInt("Server.SessionWaitTimeout")
+	if timeout <= 0 {
+		timeout = 30
+	}
+	return time.Duration(timeout) * time.Second
+}
+
+// SessionStats session usage and queueing of a server since it was added
+type SessionStats struct {
+	Limit     int
+	InUse     int
+	Waiting   int
+	Acquired  uint64        // sessions opened
+	Timeouts  uint64        // callers that gave up waiting
+	Rejected  uint64        // sessions refused by the server although below the limit
+	TotalWait time.Duration // time spent queueing, over all acquired sessions
+	MaxWait   time.Duration
+}
+
+// sessionLimiter bounds concurrent sessions of one server so its MaxSessions is never exceeded
+type sessionLimiter struct {
+	slots chan struct{}
+	mutex sync.Mutex
+	stats SessionStats
+}
+
+func newSessionLimiter(limit int) *sessionLimiter {
+	return &sessionLimiter{
+		slots: make(chan struct{}, limit),
+		stats: SessionStats{Limit: limit},
+	}
+}
+
+// wait for a free slot until ctx is done
+func (l *sessionLimiter) acquire(ctx context.Context) error {
+	l.mutex.Lock()
+	l.stats.Waiting++
+	l.mutex.Unlock()
+
+	start := time.Now()
+	var err error
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	wait := time.Since(start)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.stats.Waiting--
+	if err != nil {
+		l.stats.Timeouts++
+		return err
+	}
+	l.stats.InUse++
+	l.stats.Acquired++
+	l.stats.TotalWait += wait
+	l.stats.MaxWait = max(l.stats.MaxWait, wait)
+	return nil
+}
+
+func (l *sessionLimiter) release() {
+	l.mutex.Lock()
+	l.stats.InUse--
+	l.mutex.Unlock()
+	<-l.slots
+}
+
+// SessionStats session usage of server, zero for the local server
+func (s *Server) SessionStats() SessionStats {
+	if s.sessions == nil {
+		return SessionStats{}
+	}
+	s.sessions.mutex.Lock()
+	defer s.sessions.mutex.Unlock()
+	return s.sessions.stats
+}
+
+// open a session on client, queueing while all sessions of the server are in use,
+// release must be called after the session is closed
+func (s *Server) openSession(ctx context.Context, client *ssh.Client) (*ssh.Session, func(), error) {
+	if s.sessions == nil {
+		session, err := client.NewSession()
+		return session, func() {}, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, sessionWaitTimeout())
+	defer cancel()
+
+	// the server may refuse sessions below our limit when other clients use it too,
+	// wait and retry until ctx is done instead of failing right away
+	retryDelay := 100 * time.Millisecond
+	for {
+		if err := s.sessions.acquire(ctx); err != nil {
+			logs.Logger.Warn("wait for SSH session timeout",
+				zap.String("server_id", strconv.Itoa(int(s.ID))),
+				zap.Error(err))
+			return nil, nil, fmt.Errorf("%w: %v", ErrSessionBusy, err)
+		}
+		session, err := client.NewSession()
+		if err == nil {
+			var once sync.Once
+			return session, func() { once.Do(s.sessions.release) }, nil
+		}
+		s.sessions.release()
+
+		var openErr *ssh.OpenChannelError
+		if !errors.As(err, &openErr) {
+			return nil, nil, err
+		}
+		s.sessions.mutex.Lock()
+		s.sessions.stats.Rejected++
+		s.sessions.mutex.Unlock()
+		logs.Logger.Debug("SSH session rejected by server, retry",
+			zap.String("server_id", strconv.Itoa(int(s.ID))),
+			zap.Error(err))
+
+		select {
+		case <-time.After(retryDelay):
+			retryDelay = min(retryDelay*2, 2*time.Second)
+		case <-ctx.Done():
+			s.sessions.mutex.Lock()
+			s.sessions.stats.Timeouts++
+			s.sessions.mutex.Unlock()
+			return nil, nil, fmt.Errorf("%w: %v", ErrSessionBusy, err)
+		}
+	}
+}
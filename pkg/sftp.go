@@ -0,0 +1,564 @@
+package pkg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// minimal SFTP (version 3) client over an SSH subsystem session,
+// responses are matched to requests by id, so file reads and writes keep several chunks in flight
+
+const (
+	sftpFxpInit      = 1
+	sftpFxpVersion   = 2
+	sftpFxpOpen      = 3
+	sftpFxpClose     = 4
+	sftpFxpRead      = 5
+	sftpFxpWrite     = 6
+	sftpFxpSetstat   = 9
+	sftpFxpOpendir   = 11
+	sftpFxpReaddir   = 12
+	sftpFxpRemove    = 13
+	sftpFxpMkdir     = 14
+	sftpFxpRmdir     = 15
+	sftpFxpStat      = 17
+	sftpFxpRename    = 18
+	sftpFxpStatus    = 101
+	sftpFxpHandle    = 102
+	sftpFxpData      = 103
+	sftpFxpName      = 104
+	sftpFxpAttrs     = 105
+	sftpFxfRead      = 0x01
+	sftpFxfWrite     = 0x02
+	sftpFxfCreat     = 0x08
+	sftpFxfTrunc     = 0x10
+	sftpAttrSize     = 0x01
+	sftpAttrUIDGID   = 0x02
+	sftpAttrPerm     = 0x04
+	sftpAttrTime     = 0x08
+	sftpAttrExt      = 0x80000000
+	sftpStatusOK     = 0
+	sftpStatusEOF    = 1
+	sftpStatusNoSuch = 2
+	sftpChunkSize    = 32 * 1024
+	sftpMaxPacket    = 256 * 1024
+	sftpMaxInflight  = 16 // read or write requests of one file sent ahead of their responses
+)
+
+type sftpResponse struct {
+	packetType byte
+	buf        *sftpBuffer
+	err        error
+}
+
+type sftpClient struct {
+	session    io.Closer // ssh session running the sftp subsystem
+	stdin      io.WriteCloser
+	stdout     io.Reader
+	nextID     uint32
+	pending    map[uint32]chan sftpResponse // requests waiting for their response
+	err        error                        // set once responses can no longer be read
+	mutex      sync.Mutex                   // guards nextID, pending and err
+	writeMutex sync.Mutex                   // one packet on the wire at a time
+	release    func()                       // give the pooled connection back, nil if not pooled
+}
+
+// open sftp subsystem on session and negotiate protocol version, the session is closed on failure
+func newSftpClient(session *ssh.Session) (*sftpClient, error) {
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		return nil, err
+	}
+	if err := session.RequestSubsystem("sftp"); err != nil {
+		session.Close()
+		return nil, fmt.Errorf("request sftp subsystem failed: %v", err)
+	}
+	return startSftpClient(session, stdin, stdout)
+}
+
+// negotiate protocol version over the subsystem streams, session is closed on failure
+func startSftpClient(session io.Closer, stdin io.WriteCloser, stdout io.Reader) (*sftpClient, error) {
+	c := &sftpClient{session: session, stdin: stdin, stdout: stdout}
+	init := []byte{sftpFxpInit}
+	init = binary.BigEndian.AppendUint32(init, 3)
+	if err := c.writePacket(init); err != nil {
+		c.Close()
+		return nil, err
+	}
+	packetType, _, err := c.readPacket()
+	if err != nil {
+		c.Close()
+		return nil, err
+	}
+	if packetType != sftpFxpVersion {
+		c.Close()
+		return nil, fmt.Errorf("sftp: unexpected packet %d during init", packetType)
+	}
+	c.pending = make(map[uint32]chan sftpResponse)
+	go c.readResponses()
+	return c, nil
+}
+
+func (c *sftpClient) Close() error {
+	c.stdin.Close()
+	err := c.session.Close()
+	if c.release != nil {
+		c.release()
+	}
+	return err
+}
+
+func (c *sftpClient) writePacket(payload []byte) error {
+	packet := binary.BigEndian.AppendUint32(make([]byte, 0, len(payload)+4), uint32(len(payload)))
+	_, err := c.stdin.Write(append(packet, payload...))
+	return err
+}
+
+func (c *sftpClient) readPacket() (byte, []byte, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(c.stdout, header[:]); err != nil {
+		return 0, nil, err
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	if length == 0 || length > sftpMaxPacket {
+		return 0, nil, fmt.Errorf("sftp: invalid packet length %d", length)
+	}
+	packet := make([]byte, length)
+	if _, err := io.ReadFull(c.stdout, packet); err != nil {
+		return 0, nil, err
+	}
+	return packet[0], packet[1:], nil
+}
+
+// hand each response to the request waiting for it, until the session ends
+func (c *sftpClient) readResponses() {
+	var err error
+	for err == nil {
+		var packetType byte
+		var resp []byte
+		packetType, resp, err = c.readPacket()
+		if err != nil {
+			break
+		}
+		buf := &sftpBuffer{data: resp}
+		id := buf.uint32()
+		c.mutex.Lock()
+		waiting, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mutex.Unlock()
+		switch {
+		case buf.err != nil:
+			err = buf.err
+		case !ok:
+			err = fmt.Errorf("sftp: response to unknown request %d", id)
+		default:
+			waiting <- sftpResponse{packetType: packetType, buf: buf}
+		}
+	}
+	// io.EOF here means the session ended, not that a file did
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.err = err
+	for id, waiting := range c.pending {
+		waiting <- sftpResponse{err: err}
+		delete(c.pending, id)
+	}
+}
+
+// send request without waiting, its response arrives on the returned channel,
+// payload starts after the request id
+func (c *sftpClient) send(packetType byte, payload []byte) (<-chan sftpResponse, error) {
+	waiting := make(chan sftpResponse, 1)
+	c.mutex.Lock()
+	if c.err != nil {
+		c.mutex.Unlock()
+		return nil, c.err
+	}
+	c.nextID++
+	id := c.nextID
+	c.pending[id] = waiting
+	c.mutex.Unlock()
+
+	packet := []byte{packetType}
+	packet = binary.BigEndian.AppendUint32(packet, id)
+	c.writeMutex.Lock()
+	err := c.writePacket(append(packet, payload...))
+	c.writeMutex.Unlock()
+	if err != nil {
+		c.mutex.Lock()
+		delete(c.pending, id)
+		c.mutex.Unlock()
+		return nil, err
+	}
+	return waiting, nil
+}
+
+func waitResponse(waiting <-chan sftpResponse) (byte, *sftpBuffer, error) {
+	resp := <-waiting
+	return resp.packetType, resp.buf, resp.err
+}
+
+// send request and wait for its response
+func (c *sftpClient) request(packetType byte, payload []byte) (byte, *sftpBuffer, error) {
+	waiting, err := c.send(packetType, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	return waitResponse(waiting)
+}
+
+// request expecting a plain status response
+func (c *sftpClient) requestStatus(packetType byte, payload []byte) error {
+	respType, buf, err := c.request(packetType, payload)
+	if err != nil {
+		return err
+	}
+	return buf.status(respType)
+}
+
+// request expecting a handle response
+func (c *sftpClient) requestHandle(packetType byte, payload []byte) (string, error) {
+	respType, buf, err := c.request(packetType, payload)
+	if err != nil {
+		return "", err
+	}
+	if respType != sftpFxpHandle {
+		return "", buf.status(respType)
+	}
+	handle := buf.string()
+	return handle, buf.err
+}
+
+func (c *sftpClient) closeHandle(handle string) error {
+	return c.requestStatus(sftpFxpClose, appendSftpString(nil, handle))
+}
+
+func (c *sftpClient) Stat(path string) (*FileInfo, error) {
+	respType, buf, err := c.request(sftpFxpStat, appendSftpString(nil, path))
+	if err != nil {
+		return nil, err
+	}
+	if respType != sftpFxpAttrs {
+		return nil, buf.status(respType)
+	}
+	info := buf.attrs()
+	info.Name = baseName(path)
+	return &info, buf.err
+}
+
+func (c *sftpClient) ReadDir(path string) ([]FileInfo, error) {
+	handle, err := c.requestHandle(sftpFxpOpendir, appendSftpString(nil, path))
+	if err != nil {
+		return nil, err
+	}
+	defer c.closeHandle(handle)
+
+	files := make([]FileInfo, 0)
+	for {
+		respType, buf, err := c.request(sftpFxpReaddir, appendSftpString(nil, handle))
+		if err != nil {
+			return nil, err
+		}
+		if respType != sftpFxpName {
+			if err := buf.status(respType); err != io.EOF {
+				return nil, err
+			}
+			return files, nil
+		}
+		count := buf.uint32()
+		for i := uint32(0); i < count && buf.err == nil; i++ {
+			name := buf.string()
+			buf.string() // long name, ls -l style, not needed
+			info := buf.attrs()
+			if name == "." || name == ".." {
+				continue
+			}
+			info.Name = name
+			files = append(files, info)
+		}
+		if buf.err != nil {
+			return nil, buf.err
+		}
+	}
+}
+
+func (c *sftpClient) Open(path string) (io.ReadCloser, error) {
+	payload := appendSftpString(nil, path)
+	payload = binary.BigEndian.AppendUint32(payload, sftpFxfRead)
+	payload = binary.BigEndian.AppendUint32(payload, 0) // empty attrs
+	handle, err := c.requestHandle(sftpFxpOpen, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpFile{client: c, handle: handle}, nil
+}
+
+func (c *sftpClient) Create(path string) (io.WriteCloser, error) {
+	payload := appendSftpString(nil, path)
+	payload = binary.BigEndian.AppendUint32(payload, sftpFxfWrite|sftpFxfCreat|sftpFxfTrunc)
+	payload = binary.BigEndian.AppendUint32(payload, 0) // empty attrs
+	handle, err := c.requestHandle(sftpFxpOpen, payload)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpFile{client: c, handle: handle}, nil
+}
+
+func (c *sftpClient) Mkdir(path string) error {
+	payload := appendSftpString(nil, path)
+	payload = binary.BigEndian.AppendUint32(payload, 0) // empty attrs
+	return c.requestStatus(sftpFxpMkdir, payload)
+}
+
+func (c *sftpClient) Rename(oldPath string, newPath string) error {
+	return c.requestStatus(sftpFxpRename, appendSftpString(appendSftpString(nil, oldPath), newPath))
+}
+
+func (c *sftpClient) Remove(path string) error {
+	info, err := c.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir {
+		return c.requestStatus(sftpFxpRmdir, appendSftpString(nil, path))
+	}
+	return c.requestStatus(sftpFxpRemove, appendSftpString(nil, path))
+}
+
+func (c *sftpClient) Chmod(path string, mode os.FileMode) error {
+	payload := appendSftpString(nil, path)
+	payload = binary.BigEndian.AppendUint32(payload, sftpAttrPerm)
+	payload = binary.BigEndian.AppendUint32(payload, uint32(mode.Perm()))
+	return c.requestStatus(sftpFxpSetstat, payload)
+}
+
+// sftpFile remote file handle, reads and writes sequentially with up to sftpMaxInflight chunks in flight
+type sftpFile struct {
+	client *sftpClient
+	handle string
+	offset uint64                // next byte returned by Read or sent by Write
+	reads  []<-chan sftpResponse // reads sent ahead, in offset order
+	next   uint64                // offset of the next read to send
+	data   []byte                // received but not yet returned by Read
+	eof    bool
+	writes []<-chan sftpResponse // writes not yet acknowledged
+	err    error                 // first failed write, returned by the next Write or Close
+}
+
+func (f *sftpFile) Read(p []byte) (int, error) {
+	for len(f.data) == 0 {
+		if f.eof {
+			return 0, io.EOF
+		}
+		if err := f.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, f.data)
+	f.data = f.data[n:]
+	return n, nil
+}
+
+// top up the reads sent ahead and take the oldest response
+func (f *sftpFile) fill() error {
+	for len(f.reads) < sftpMaxInflight {
+		payload := appendSftpString(nil, f.handle)
+		payload = binary.BigEndian.AppendUint64(payload, f.next)
+		payload = binary.BigEndian.AppendUint32(payload, sftpChunkSize)
+		waiting, err := f.client.send(sftpFxpRead, payload)
+		if err != nil {
+			return err
+		}
+		f.reads = append(f.reads, waiting)
+		f.next += sftpChunkSize
+	}
+	respType, buf, err := waitResponse(f.reads[0])
+	f.reads = f.reads[1:]
+	if err != nil {
+		return err
+	}
+	if respType != sftpFxpData {
+		err := buf.status(respType)
+		if err == io.EOF {
+			f.eof = true
+			return nil
+		}
+		return err
+	}
+	data := buf.string()
+	if buf.err != nil {
+		return buf.err
+	}
+	f.offset += uint64(len(data))
+	if len(data) < sftpChunkSize {
+		// a short read leaves a gap before the reads sent after it, drop them and continue from here
+		f.reads = nil
+		f.next = f.offset
+	}
+	f.data = []byte(data)
+	return nil
+}
+
+func (f *sftpFile) Write(p []byte) (int, error) {
+	written := 0
+	for written < len(p) {
+		if f.err != nil {
+			return written, f.err
+		}
+		chunk := p[written:]
+		if len(chunk) > sftpChunkSize {
+			chunk = chunk[:sftpChunkSize]
+		}
+		payload := appendSftpString(nil, f.handle)
+		payload = binary.BigEndian.AppendUint64(payload, f.offset)
+		payload = appendSftpString(payload, string(chunk))
+		waiting, err := f.client.send(sftpFxpWrite, payload)
+		if err != nil {
+			return written, err
+		}
+		f.writes = append(f.writes, waiting)
+		written += len(chunk)
+		f.offset += uint64(len(chunk))
+		if len(f.writes) >= sftpMaxInflight {
+			f.waitWrite()
+		}
+	}
+	return written, nil
+}
+
+// wait for the oldest unacknowledged write, keeping the first failure
+func (f *sftpFile) waitWrite() {
+	respType, buf, err := waitResponse(f.writes[0])
+	f.writes = f.writes[1:]
+	if err == nil {
+		err = buf.status(respType)
+	}
+	if f.err == nil {
+		f.err = err
+	}
+}
+
+// Close waits for the pending writes, their errors are reported here
+func (f *sftpFile) Close() error {
+	for len(f.writes) > 0 {
+		f.waitWrite()
+	}
+	err := f.client.closeHandle(f.handle)
+	if f.err != nil {
+		return f.err
+	}
+	return err
+}
+
+// sftpBuffer decodes SFTP wire types, the first decode error is kept in err
+type sftpBuffer struct {
+	data []byte
+	err  error
+}
+
+func (b *sftpBuffer) uint32() uint32 {
+	if b.err != nil {
+		return 0
+	}
+	if len(b.data) < 4 {
+		b.err = errors.New("sftp: short packet")
+		return 0
+	}
+	v := binary.BigEndian.Uint32(b.data)
+	b.data = b.data[4:]
+	return v
+}
+
+func (b *sftpBuffer) uint64() uint64 {
+	high := b.uint32()
+	low := b.uint32()
+	return uint64(high)<<32 | uint64(low)
+}
+
+func (b *sftpBuffer) string() string {
+	length := b.uint32()
+	if b.err != nil {
+		return ""
+	}
+	if uint32(len(b.data)) < length {
+		b.err = errors.New("sftp: short packet")
+		return ""
+	}
+	v := string(b.data[:length])
+	b.data = b.data[length:]
+	return v
+}
+
+func (b *sftpBuffer) attrs() FileInfo {
+	var info FileInfo
+	flags := b.uint32()
+	if flags&sftpAttrSize != 0 {
+		info.Size = int64(b.uint64())
+	}
+	if flags&sftpAttrUIDGID != 0 {
+		b.uint32()
+		b.uint32()
+	}
+	if flags&sftpAttrPerm != 0 {
+		perm := b.uint32()
+		info.Mode = os.FileMode(perm & 0777)
+		info.IsDir = perm&0170000 == 0040000 // S_IFDIR
+		if info.IsDir {
+			info.Mode |= os.ModeDir
+		}
+	}
+	if flags&sftpAttrTime != 0 {
+		b.uint32() // access time
+		info.ModTime = time.Unix(int64(b.uint32()), 0)
+	}
+	if flags&sftpAttrExt != 0 {
+		count := b.uint32()
+		for i := uint32(0); i < count && b.err == nil; i++ {
+			b.string()
+			b.string()
+		}
+	}
+	return info
+}
+
+// convert status response to error, io.EOF for end of file or directory
+func (b *sftpBuffer) status(packetType byte) error {
+	if packetType != sftpFxpStatus {
+		return fmt.Errorf("sftp: unexpected packet %d", packetType)
+	}
+	code := b.uint32()
+	msg := b.string()
+	if b.err != nil {
+		return b.err
+	}
+	switch code {
+	case sftpStatusOK:
+		return nil
+	case sftpStatusEOF:
+		return io.EOF
+	case sftpStatusNoSuch:
+		return fmt.Errorf("sftp: %w: %s", os.ErrNotExist, msg)
+	}
+	return fmt.Errorf("sftp: status %d: %s", code, msg)
+}
+
+func appendSftpString(buf []byte, s string) []byte {
+	buf = binary.BigEndian.AppendUint32(buf, uint32(len(s)))
+	return append(buf, s...)
+}
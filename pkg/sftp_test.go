@@ -0,0 +1,431 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// sftpTestServer answers the SFTP v3 requests sent by sftpClient from a local directory
+type sftpTestServer struct {
+	root    string
+	in      io.Reader
+	out     io.Writer
+	handles map[string]any // *os.File, or []os.DirEntry still to list
+	next    int
+
+	latency     time.Duration // delay of each response, requests are still handled in order
+	maxRead     int           // shorten reads to this many bytes, 0 for no limit
+	failWrites  bool
+	inflight    atomic.Int32 // requests answered but not yet sent back
+	maxInflight atomic.Int32
+	sending     sync.WaitGroup
+}
+
+func newSftpTestPair(t *testing.T, server *sftpTestServer) (*sftpClient, string) {
+	t.Helper()
+	root := t.TempDir()
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+	server.root, server.in, server.out, server.handles = root, serverIn, serverOut, map[string]any{}
+	go func() {
+		server.serve()
+		server.sending.Wait()
+		serverOut.Close()
+	}()
+	closer := closerFunc(func() error { return serverIn.Close() })
+	client, err := startSftpClient(closer, clientOut, clientIn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, root
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error { return f() }
+
+func (s *sftpTestServer) serve() {
+	for {
+		var header [4]byte
+		if _, err := io.ReadFull(s.in, header[:]); err != nil {
+			return
+		}
+		packet := make([]byte, binary.BigEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(s.in, packet); err != nil {
+			return
+		}
+		if packet[0] == sftpFxpInit {
+			s.send(binary.BigEndian.AppendUint32([]byte{sftpFxpVersion}, 3))
+			continue
+		}
+		buf := &sftpBuffer{data: packet[1:]}
+		id := buf.uint32()
+		respType, payload := s.handle(packet[0], buf)
+		resp := append(binary.BigEndian.AppendUint32([]byte{respType}, id), payload...)
+		if s.latency == 0 {
+			s.send(resp)
+			continue
+		}
+		if n := s.inflight.Add(1); n > s.maxInflight.Load() {
+			s.maxInflight.Store(n)
+		}
+		s.sending.Add(1)
+		time.AfterFunc(s.latency, func() {
+			defer s.sending.Done()
+			s.inflight.Add(-1)
+			s.send(resp)
+		})
+	}
+}
+
+func (s *sftpTestServer) send(payload []byte) {
+	packet := binary.BigEndian.AppendUint32(nil, uint32(len(payload)))
+	s.out.Write(append(packet, payload...))
+}
+
+func (s *sftpTestServer) local(p string) string {
+	return filepath.Join(s.root, filepath.FromSlash(p))
+}
+
+func (s *sftpTestServer) newHandle(v any) []byte {
+	s.next++
+	handle := strings.Repeat("h", s.next)
+	s.handles[handle] = v
+	return appendSftpString(nil, handle)
+}
+
+func sftpStatusPayload(err error) (byte, []byte) {
+	code := uint32(sftpStatusOK)
+	switch {
+	case err == io.EOF:
+		code = sftpStatusEOF
+	case errors.Is(err, os.ErrNotExist):
+		code = sftpStatusNoSuch
+	case err != nil:
+		code = 4 // SSH_FX_FAILURE
+	}
+	msg := ""
+	if err != nil {
+		msg = err.Error()
+	}
+	return sftpFxpStatus, appendSftpString(appendSftpString(binary.BigEndian.AppendUint32(nil, code), msg), "")
+}
+
+func appendSftpTestAttrs(buf []byte, info os.FileInfo) []byte {
+	perm := uint32(info.Mode().Perm()) | 0100000
+	if info.IsDir() {
+		perm = uint32(info.Mode().Perm()) | 0040000
+	}
+	buf = binary.BigEndian.AppendUint32(buf, sftpAttrSize|sftpAttrPerm|sftpAttrTime|sftpAttrExt)
+	buf = binary.BigEndian.AppendUint64(buf, uint64(info.Size()))
+	buf = binary.BigEndian.AppendUint32(buf, perm)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(info.ModTime().Unix()))
+	buf = binary.BigEndian.AppendUint32(buf, uint32(info.ModTime().Unix()))
+	buf = binary.BigEndian.AppendUint32(buf, 1)
+	return appendSftpString(appendSftpString(buf, "test@example.com"), "ignored")
+}
+
+func (s *sftpTestServer) handle(packetType byte, buf *sftpBuffer) (byte, []byte) {
+	switch packetType {
+	case sftpFxpOpen:
+		name := buf.string()
+		flags := buf.uint32()
+		mode := os.O_RDONLY
+		if flags&sftpFxfWrite != 0 {
+			mode = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+		}
+		f, err := os.OpenFile(s.local(name), mode, 0644)
+		if err != nil {
+			return sftpStatusPayload(err)
+		}
+		return sftpFxpHandle, s.newHandle(f)
+	case sftpFxpOpendir:
+		entries, err := os.ReadDir(s.local(buf.string()))
+		if err != nil {
+			return sftpStatusPayload(err)
+		}
+		return sftpFxpHandle, s.newHandle(entries)
+	case sftpFxpReaddir:
+		handle := buf.string()
+		entries := s.handles[handle].([]os.DirEntry)
+		if len(entries) == 0 {
+			return sftpStatusPayload(io.EOF)
+		}
+		// one entry per response so the client has to keep reading, "." comes with the first
+		var names [][]byte
+		if s.handles[handle+"."] == nil {
+			s.handles[handle+"."] = true
+			info, _ := os.Stat(s.root)
+			names = append(names, appendSftpTestAttrs(appendSftpString(appendSftpString(nil, "."), "."), info))
+		}
+		info, _ := entries[0].Info()
+		names = append(names, appendSftpTestAttrs(appendSftpString(appendSftpString(nil, entries[0].Name()), "long"), info))
+		s.handles[handle] = entries[1:]
+		payload := binary.BigEndian.AppendUint32(nil, uint32(len(names)))
+		return sftpFxpName, append(payload, bytes.Join(names, nil)...)
+	case sftpFxpRead:
+		f := s.handles[buf.string()].(*os.File)
+		offset := buf.uint64()
+		data := make([]byte, buf.uint32())
+		if s.maxRead > 0 && len(data) > s.maxRead {
+			data = data[:s.maxRead]
+		}
+		n, err := f.ReadAt(data, int64(offset))
+		if n == 0 {
+			return sftpStatusPayload(err)
+		}
+		return sftpFxpData, appendSftpString(nil, string(data[:n]))
+	case sftpFxpWrite:
+		f := s.handles[buf.string()].(*os.File)
+		offset := buf.uint64()
+		if s.failWrites {
+			return sftpStatusPayload(errors.New("no space left on device"))
+		}
+		_, err := f.WriteAt([]byte(buf.string()), int64(offset))
+		return sftpStatusPayload(err)
+	case sftpFxpClose:
+		handle := buf.string()
+		if f, ok := s.handles[handle].(*os.File); ok {
+			f.Close()
+		}
+		delete(s.handles, handle)
+		return sftpStatusPayload(nil)
+	case sftpFxpStat:
+		info, err := os.Stat(s.local(buf.string()))
+		if err != nil {
+			return sftpStatusPayload(err)
+		}
+		return sftpFxpAttrs, appendSftpTestAttrs(nil, info)
+	case sftpFxpSetstat:
+		name := buf.string()
+		if buf.uint32() != sftpAttrPerm {
+			return sftpStatusPayload(errors.New("only permissions are supported"))
+		}
+		return sftpStatusPayload(os.Chmod(s.local(name), os.FileMode(buf.uint32())))
+	case sftpFxpMkdir:
+		return sftpStatusPayload(os.Mkdir(s.local(buf.string()), 0755))
+	case sftpFxpRename:
+		oldPath := buf.string()
+		return sftpStatusPayload(os.Rename(s.local(oldPath), s.local(buf.string())))
+	case sftpFxpRemove, sftpFxpRmdir:
+		return sftpStatusPayload(os.Remove(s.local(buf.string())))
+	}
+	return sftpStatusPayload(errors.New("unsupported request"))
+}
+
+func TestSftpClientRoundTrip(t *testing.T) {
+	client, root := newSftpTestPair(t, &sftpTestServer{})
+
+	if err := client.Mkdir("/data"); err != nil {
+		t.Fatal(err)
+	}
+	// larger than one chunk, so reads and writes are split
+	content := bytes.Repeat([]byte("0123456789abcdef"), 3*sftpChunkSize/16+7)
+	w, err := client.Create("/data/a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := w.Write(content); err != nil || n != len(content) {
+		t.Fatalf("write: %d, %v", n, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(root, "data", "a.bin")); !bytes.Equal(data, content) {
+		t.Fatalf("server got %d bytes, want %d", len(data), len(content))
+	}
+
+	r, err := client.Open("/data/a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("read %d bytes, %v", len(data), err)
+	}
+
+	if err := client.Chmod("/data/a.bin", 0600); err != nil {
+		t.Fatal(err)
+	}
+	info, err := client.Stat("/data/a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "a.bin" || info.Size != int64(len(content)) || info.Mode != 0600 || info.IsDir {
+		t.Fatalf("stat: %+v", info)
+	}
+	if info.ModTime.IsZero() || time.Since(info.ModTime) > time.Hour {
+		t.Fatalf("stat mod time: %v", info.ModTime)
+	}
+
+	if err := client.Mkdir("/data/sub"); err != nil {
+		t.Fatal(err)
+	}
+	files, err := client.ReadDir("/data")
+	if err != nil {
+		t.Fatal(err)
+	}
+	SortFiles(files)
+	if len(files) != 2 || files[0].Name != "sub" || !files[0].IsDir || files[0].Mode&os.ModeDir == 0 || files[1].Name != "a.bin" {
+		t.Fatalf("read dir: %+v", files)
+	}
+
+	if err := client.Rename("/data/a.bin", "/data/sub/b.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Stat("/data/a.bin"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stat renamed file: %v", err)
+	}
+	if err := client.Remove("/data/sub"); err == nil {
+		t.Fatal("removed a directory that is not empty")
+	}
+	if err := client.Remove("/data/sub/b.bin"); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.Remove("/data/sub"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "data", "sub")); !os.IsNotExist(err) {
+		t.Fatalf("directory still exists: %v", err)
+	}
+	if _, err := client.Open("/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("open missing file: %v", err)
+	}
+}
+
+func TestSftpClientPipelining(t *testing.T) {
+	server := &sftpTestServer{latency: 5 * time.Millisecond}
+	client, _ := newSftpTestPair(t, server)
+	content := bytes.Repeat([]byte("0123456789abcdef"), 40*sftpChunkSize/16+3)
+
+	w, err := client.Create("/a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := server.maxInflight.Load(); got < 2 {
+		t.Fatalf("writes in flight = %d, want them pipelined", got)
+	}
+
+	server.maxInflight.Store(0)
+	r, err := client.Open("/a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("read %d bytes, %v", len(data), err)
+	}
+	if got := server.maxInflight.Load(); got < 2 {
+		t.Fatalf("reads in flight = %d, want them pipelined", got)
+	}
+}
+
+func TestSftpClientShortReads(t *testing.T) {
+	server := &sftpTestServer{maxRead: 1000}
+	client, root := newSftpTestPair(t, server)
+	content := bytes.Repeat([]byte("0123456789abcdef"), 3*sftpChunkSize/16+7)
+	if err := os.WriteFile(filepath.Join(root, "a.bin"), content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	r, err := client.Open("/a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, err := io.ReadAll(r)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("read %d bytes, %v", len(data), err)
+	}
+}
+
+func TestSftpClientWriteError(t *testing.T) {
+	client, _ := newSftpTestPair(t, &sftpTestServer{failWrites: true})
+	w, err := client.Create("/a.bin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// acknowledgements are collected later, the failure shows up by Close at the latest
+	_, writeErr := w.Write(make([]byte, 3*sftpChunkSize))
+	closeErr := w.Close()
+	if writeErr == nil && closeErr == nil {
+		t.Fatal("failed writes not reported")
+	}
+	if err := client.Mkdir("/after"); err != nil {
+		t.Fatalf("client unusable after a failed write: %v", err)
+	}
+}
+
+func TestSftpClientSessionEnd(t *testing.T) {
+	client, _ := newSftpTestPair(t, &sftpTestServer{})
+	client.session.Close()
+	if _, err := client.Stat("/"); err == nil || err == io.EOF {
+		t.Fatalf("stat after the session ended: %v", err)
+	}
+}
+
+func TestSftpBufferDecode(t *testing.T) {
+	payload := binary.BigEndian.AppendUint32(nil, sftpAttrSize|sftpAttrUIDGID|sftpAttrPerm|sftpAttrTime)
+	payload = binary.BigEndian.AppendUint64(payload, 1<<33+5)
+	payload = binary.BigEndian.AppendUint32(payload, 1000)
+	payload = binary.BigEndian.AppendUint32(payload, 1000)
+	payload = binary.BigEndian.AppendUint32(payload, 0040755)
+	payload = binary.BigEndian.AppendUint32(payload, 1)
+	payload = binary.BigEndian.AppendUint32(payload, 1700000000)
+	buf := &sftpBuffer{data: payload}
+	info := buf.attrs()
+	if buf.err != nil || len(buf.data) != 0 {
+		t.Fatalf("attrs left %d bytes, %v", len(buf.data), buf.err)
+	}
+	if info.Size != 1<<33+5 || !info.IsDir || info.Mode != os.ModeDir|0755 || info.ModTime.Unix() != 1700000000 {
+		t.Fatalf("attrs: %+v", info)
+	}
+
+	short := &sftpBuffer{data: appendSftpString(nil, "abcdef")[:7]}
+	if short.string() != "" || short.err == nil {
+		t.Fatal("short string decoded")
+	}
+	if short.uint32() != 0 {
+		t.Fatal("decoded after error")
+	}
+
+	tests := []struct {
+		code uint32
+		want error
+	}{
+		{sftpStatusOK, nil},
+		{sftpStatusEOF, io.EOF},
+		{sftpStatusNoSuch, os.ErrNotExist},
+	}
+	for _, tt := range tests {
+		status := appendSftpString(binary.BigEndian.AppendUint32(nil, tt.code), "message")
+		err := (&sftpBuffer{data: status}).status(sftpFxpStatus)
+		if !errors.Is(err, tt.want) || (tt.want == nil) != (err == nil) {
+			t.Errorf("status %d: got %v, want %v", tt.code, err, tt.want)
+		}
+	}
+	failure := appendSftpString(binary.BigEndian.AppendUint32(nil, 3), "permission denied")
+	if err := (&sftpBuffer{data: failure}).status(sftpFxpStatus); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("failure status: %v", err)
+	}
+	if err := (&sftpBuffer{}).status(sftpFxpData); err == nil {
+		t.Fatal("non status packet accepted as status")
+	}
+}
@@ -4,10 +4,8 @@ import (
 	"GolangOM/constant"
 	"GolangOM/logs"
 	"GolangOM/ws"
-	"bytes"
+	"context"
 	"fmt"
-	"os"
-	"os/exec"
 	"strconv"
 	"sync"
 	"time"
@@ -26,27 +24,48 @@ var LocalServer = &Server{
 
 // struct exposed for creating connections
 type ServerConfig struct {
-	ID         uint
-	IP         string
-	Port       int
-	User       string
-	AuthMethod constant.AuthMethod // password or key
-	Credential string              // key path
-	Password   string              // password or key password
+	ID             uint
+	IP             string
+	Port           int
+	User           string
+	AuthMethod     constant.AuthMethod   // password or key
+	Credential     string                // key path
+	Password       string                // password or key password
+	PrivateKey     string                // PEM of managed key, used instead of the key file
+	Certificate    string                // OpenSSH certificate or path to it, default is <key file>-cert.pub
+	BecomeMethod   constant.BecomeMethod // sudo or su, empty means sudo
+	BecomePassword string                // password answered to sudo or su prompts
+	SSHKeyID       uint                  // ID of managed key
+	JumpServerID   uint                  // connect through this pooled server, 0 means direct
+	Labels         map[string]string     // such as env=prod, matched by label selectors
 }
 
 // server struct
 type Server struct {
-	ID            uint
-	IP            string
-	Port          int
-	User          string
-	AuthMethod    constant.AuthMethod    // password or key
-	Credential    string                 // key path
-	Password      string                 // password or key password
-	Status        constant.ConnectStatus // connected, disconnected, connecting
-	LastCheckTime time.Time
-	SSHClient     *ssh.Client
+	ID             uint
+	IP             string
+	Port           int
+	User           string
+	AuthMethod     constant.AuthMethod    // password or key
+	Credential     string                 // key path
+	Password       string                 // password or key password
+	PrivateKey     string                 // PEM of managed key, used instead of the key file
+	Certificate    string                 // OpenSSH certificate or path to it, default is <key file>-cert.pub
+	BecomeMethod   constant.BecomeMethod  // sudo or su, empty means sudo
+	BecomePassword string                 // password answered to sudo or su prompts
+	SSHKeyID       uint                   // ID of managed key
+	JumpServerID   uint                   // connect through this pooled server, 0 means direct
+	Status         constant.ConnectStatus // connected, disconnected, connecting
+	LastCheckTime  time.Time
+	LastError      string    // error of the last failed connect or keepalive, empty when connected
+	NextRetryAt    time.Time // next reconnect attempt when disconnected, zero means next check
+	SSHClient      *ssh.Client
+	Executor       Executor          // runs commands, nil means the local shell for the local server and SSH otherwise
+	Labels         map[string]string // such as env=prod, matched by label selectors
+	failures       int               // failed reconnect attempts in a row
+	reconnecting   bool
+	lazy           lazyState
+	sessions       *sessionLimiter // nil means unlimited
 }
 
 type ConnectionPool struct {
@@ -54,6 +73,10 @@ type ConnectionPool struct {
 	servers             map[uint]*Server
 	connectionNumber    int
 	mutex               sync.RWMutex
+	eventHandler        func(event ConnectionEvent)
+	factsHandler        func(serverID uint, facts *HostFacts)
+	lazyMode            bool          // open connections on demand, see Server.ConnectionMode
+	released            chan struct{} // closed when a connection may have become free, see notifyLocked
 	// connection pool configuration
 }
 
@@ -62,10 +85,13 @@ var connectionPool = ConnectionPool{
 	servers:             make(map[uint]*Server),
 	connectionNumber:    0,
 	mutex:               sync.RWMutex{},
+	lazyMode:            lazyConnectionMode(),
+	released:            make(chan struct{}),
 }
 
 func init() {
 	go connectionPool.StartSSHConnectionCheckTicker(viper.GetInt("Server.CheckInterval"))
+	go metricsCollector.StartMetricsTicker(viper.GetInt("Metrics.Interval"))
 }
 
 func GetConnectionPool() *ConnectionPool {
@@ -107,7 +133,8 @@ func (c *ConnectionPool) GetServers() []*Server {
 func (c *ConnectionPool) AddServerToConnectionPool(server *Server) error {
 	connectionPool.mutex.Lock()
 	defer connectionPool.mutex.Unlock()
-	if connectionPool.connectionNumber >= connectionPool.maxConnectionNumber {
+	// in lazy mode the limit applies to open connections instead, see acquire
+	if !connectionPool.lazyMode && connectionPool.connectionNumber >= connectionPool.maxConnectionNumber {
 		return fmt.Errorf("over max connection number")
 	}
 	if _, ok := connectionPool.servers[server.ID]; ok {
@@ -129,6 +156,46 @@ func (c *ConnectionPool) RemoveServerFromConnectionPoolByID(serverID uint) {
 	}
 	delete(connectionPool.servers, serverID)
 	connectionPool.connectionNumber--
+	connectionPool.notifyLocked()
+	metricsCollector.Forget(serverID)
+}
+
+// PoolStats size of the connection pool
+type PoolStats struct {
+	Servers         int // registered servers, without the local server
+	OpenConnections int
+	MaxConnections  int
+	Lazy            bool
+}
+
+func (c *ConnectionPool) Stats() PoolStats {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+	stats := PoolStats{
+		Servers:        len(c.servers),
+		MaxConnections: c.maxConnectionNumber,
+		Lazy:           c.lazyMode,
+	}
+	for _, server := range c.servers {
+		if server.SSHClient != nil {
+			stats.OpenConnections++
+		}
+	}
+	return stats
+}
+
+// ReconnectServerByID connect server again immediately, ignoring its backoff
+func (c *ConnectionPool) ReconnectServerByID(serverID uint) error {
+	c.mutex.RLock()
+	server, ok := c.servers[serverID]
+	c.mutex.RUnlock()
+	if !ok {
+		return fmt.Errorf("server not exists")
+	}
+	if !c.beginReconnect(server) {
+		return fmt.Errorf("reconnect already in progress")
+	}
+	return c.reconnect(server)
 }
 
 // create new connection
@@ -136,16 +203,29 @@ func (c *ConnectionPool) NewConnection(config *ServerConfig) error {
 	logs.Logger.Debug("NewConnection")
 
 	server := &Server{
-		ID:            config.ID,
-		IP:            config.IP,
-		Port:          config.Port,
-		User:          config.User,
-		AuthMethod:    config.AuthMethod,
-		Credential:    config.Credential,
-		Password:      config.Password,
-		Status:        constant.Disconnected,
-		LastCheckTime: time.Now(),
-		SSHClient:     nil,
+		ID:             config.ID,
+		IP:             config.IP,
+		Port:           config.Port,
+		User:           config.User,
+		AuthMethod:     config.AuthMethod,
+		Credential:     config.Credential,
+		Password:       config.Password,
+		PrivateKey:     config.PrivateKey,
+		Certificate:    config.Certificate,
+		BecomeMethod:   config.BecomeMethod,
+		BecomePassword: config.BecomePassword,
+		SSHKeyID:       config.SSHKeyID,
+		JumpServerID:   config.JumpServerID,
+		Labels:         config.Labels,
+		Status:         constant.Connecting,
+		LastCheckTime:  time.Now(),
+		SSHClient:      nil,
+		sessions:       newSessionLimiter(maxSessions()),
+		reconnecting:   true, // keep the check ticker away until the first attempt finished
+	}
+
+	if c.lazyMode {
+		return c.newLazyConnection(server)
 	}
 
 	err := c.AddServerToConnectionPool(server)
@@ -153,37 +233,48 @@ func (c *ConnectionPool) NewConnection(config *ServerConfig) error {
 		return err
 	}
 
-	client, err := sshConnect(config)
-	if err != nil {
+	if err := c.reconnect(server); err != nil {
 		return err
 	}
 
-	connectionPool.mutex.Lock()
-	connectionPool.servers[server.ID].Status = constant.Connected
-	connectionPool.servers[server.ID].SSHClient = client
-	connectionPool.mutex.Unlock()
-
 	logs.Logger.Info("SSH connect successfully", zap.String("ip", server.IP), zap.String("id", strconv.Itoa(int(server.ID))))
 
 	return nil
 }
 
+// CheckLogin log in to the server of config once without adding it to the pool,
+// used to try new credentials before they replace working ones
+func CheckLogin(config *ServerConfig) error {
+	client, err := sshConnect(config)
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
 func sshConnect(config *ServerConfig) (*ssh.Client, error) {
-	authMethod, err := getAuthMethods(config)
+	authMethod, closeAuth, err := getAuthMethods(config)
 	if err != nil {
 		return nil, err
 	}
+	// agent connection is only needed during authentication
+	defer closeAuth()
 
 	clientConfig := &ssh.ClientConfig{
 		User:            config.User,
 		Auth:            authMethod,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+		HostKeyCallback: hostKeyStore.HostKeyCallback,
 		Timeout:         30 * time.Second,
 	}
 
 	// connection address format: ip:port
 	addr := fmt.Sprintf("%s:%d", config.IP, config.Port)
 
+	// tunnel through jump server if configured
+	if config.JumpServerID != 0 {
+		return dialThroughJumpServer(config.JumpServerID, addr, clientConfig)
+	}
+
 	// establish SSH connection
 	client, err := ssh.Dial("tcp", addr, clientConfig)
 	if err != nil {
@@ -192,118 +283,93 @@ func sshConnect(config *ServerConfig) (*ssh.Client, error) {
 	return client, nil
 }
 
-// get authentication method (password or key)
-func getAuthMethods(config *ServerConfig) ([]ssh.AuthMethod, error) {
-	var authMethods []ssh.AuthMethod
-
-	if config.AuthMethod == constant.AuthMethodPassword {
-		// password authentication
-		authMethods = append(authMethods, ssh.Password(config.Password))
-		return authMethods, nil
-	} else if config.AuthMethod == constant.AuthMethodKey {
+// get authentication method, the returned func releases resources used during authentication
+func getAuthMethods(config *ServerConfig) ([]ssh.AuthMethod, func(), error) {
+	noop := func() {}
+
+	switch config.AuthMethod {
+	case constant.AuthMethodPassword:
+		// password authentication, keyboard-interactive as well for servers that only allow PAM prompts
+		return []ssh.AuthMethod{
+			ssh.Password(config.Password),
+			ssh.KeyboardInteractive(answerPasswordChallenge(config.Password)),
+		}, noop, nil
+	case constant.AuthMethodKey:
 		// key authentication
-		key, err := os.ReadFile(config.Credential)
+		signer, err := loadSigner(config)
 		if err != nil {
-			return nil, fmt.Errorf("load key file failed: %v", err)
+			return nil, nil, err
 		}
-
-		signer, err := ssh.ParsePrivateKey(key)
+		return []ssh.AuthMethod{ssh.PublicKeys(signer)}, noop, nil
+	case constant.AuthMethodCertificate:
+		// key authentication with certificate signed by a trusted CA
+		signer, err := loadSigner(config)
 		if err != nil {
-			// try to handle key with password
-			if config.Password != "" {
-				signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(config.Password))
-			}
-			if err != nil {
-				return nil, fmt.Errorf("parse key failed: %v", err)
-			}
+			return nil, nil, err
 		}
-
-		authMethods = append(authMethods, ssh.PublicKeys(signer))
-		return authMethods, nil
-
+		cert, err := loadCertificate(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := checkCertificateValidity(cert, time.Now()); err != nil {
+			return nil, nil, err
+		}
+		certSigner, err := ssh.NewCertSigner(cert, signer)
+		if err != nil {
+			return nil, nil, fmt.Errorf("certificate does not match key: %v", err)
+		}
+		return []ssh.AuthMethod{ssh.PublicKeys(certSigner)}, noop, nil
+	case constant.AuthMethodAgent:
+		// keys and certificates held by ssh-agent
+		agentClient, conn, err := dialAgent(config)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []ssh.AuthMethod{ssh.PublicKeysCallback(agentClient.Signers)}, func() { conn.Close() }, nil
 	}
 
-	return nil, fmt.Errorf("not exists auth method")
+	return nil, nil, fmt.Errorf("not exists auth method")
 }
 
-// execute command
-func (s *Server) ExecuteCommand(cmd string) (string, error) {
-	if s.ID == constant.LocalServerID {
-		// execute local command (capture stdout and stderr combined output)
-		startTime := time.Now()
-		output, err := exec.Command(cmd).CombinedOutput()
-		result := string(output)
-
-		if err != nil {
-			// local command execution failed: return error and output details
-			errMsg := fmt.Errorf("local command failed: %v, output: %s", err, result)
-			return "", errMsg
-		}
+// Address ip:port of server, also used as known_hosts entry
+func (s *Server) Address() string {
+	return fmt.Sprintf("%s:%d", s.IP, s.Port)
+}
 
-		// local command execution successful
-		logs.Logger.Debug("local command execute success",
-			zap.String("server_id", strconv.Itoa(int(s.ID))),
-			zap.String("cmd", cmd),
-			zap.Duration("time used", time.Since(startTime)),
-			zap.Int("out length", len(result)))
-		return result, nil
+// rebuild connection config from server
+func (s *Server) serverConfig() *ServerConfig {
+	return &ServerConfig{
+		ID:             s.ID,
+		IP:             s.IP,
+		Port:           s.Port,
+		User:           s.User,
+		AuthMethod:     s.AuthMethod,
+		Credential:     s.Credential,
+		Password:       s.Password,
+		PrivateKey:     s.PrivateKey,
+		Certificate:    s.Certificate,
+		BecomeMethod:   s.BecomeMethod,
+		BecomePassword: s.BecomePassword,
+		SSHKeyID:       s.SSHKeyID,
+		JumpServerID:   s.JumpServerID,
+		Labels:         s.Labels,
 	}
+}
 
-	// check if SSH client is valid
-	if !s.CheckSSHConnection() {
-		return "", fmt.Errorf("SSH not init")
-	}
+// execute command with the default timeout, non-zero exit status is returned as error
+// use ExecuteCommandContext to get stderr, exit status and custom deadlines
+func (s *Server) ExecuteCommand(cmd string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), defaultCommandTimeout())
+	defer cancel()
 
-	// create new session
-	session, err := s.SSHClient.NewSession()
+	result, err := s.ExecuteCommandContext(ctx, cmd)
 	if err != nil {
-		return "", fmt.Errorf("create session failed: %v", err)
-	}
-	defer session.Close() // ensure session is closed
-
-	// set command execution timeout
-	done := make(chan struct{})
-	go func() {
-		select {
-		case <-done:
-			return
-		case <-time.After(30 * time.Second): // 30 second timeout
-			if err := session.Signal(ssh.SIGKILL); err != nil {
-				logs.Logger.Warn("execute command failed: overtime ",
-					zap.String("server_id", strconv.Itoa(int(s.ID))),
-					zap.String("cmd", cmd),
-					zap.Error(err))
-			}
-		}
-	}()
-	defer close(done)
-
-	// capture command output
-	var stdoutBuf, stderrBuf bytes.Buffer
-	session.Stdout = &stdoutBuf
-	session.Stderr = &stderrBuf
-
-	// execute command
-	startTime := time.Now()
-	if err := session.Run(cmd); err != nil {
-		// return error information when command execution fails
-		return "", fmt.Errorf("execute command failed: %v, err out: %s", err, stderrBuf.String())
+		return "", err
 	}
-
-	if stderrBuf.String() != "" {
-		logs.Logger.Warn("command execute warning info:  ", zap.String("warn out", stderrBuf.String()))
+	if !result.Success() {
+		return "", fmt.Errorf("execute command failed: %s, err out: %s", result.exitDescription(), result.Stderr)
 	}
-
-	// command execution successful
-	result := stdoutBuf.String()
-	logs.Logger.Debug("command execute error info:  ", zap.String("err out", stderrBuf.String()))
-	logs.Logger.Debug("command execute successfully",
-		zap.String("server_id", strconv.Itoa(int(s.ID))),
-		zap.String("cmd", cmd),
-		zap.Duration("time used", time.Since(startTime)),
-		zap.Int("out string length", len(result)))
-
-	return result, nil
+	return result.Stdout, nil
 }
 
 // CheckSSHConnection check SSH connection status
@@ -318,14 +384,18 @@ func (s *Server) CheckSSHConnection() bool {
 
 	// 2. send SSH heartbeat request (keepalive)
 	// third parameter is request data (nil is fine), true means wait for server response
-	_, _, err := s.SSHClient.SendRequest("keepalive@openssh.com", true, nil)
+	client := s.SSHClient
+	_, _, err := client.SendRequest("keepalive@openssh.com", true, nil)
 	if err != nil {
 		connectionPool.mutex.Lock()
 		// heartbeat failed: update status to disconnected, cleanup client
-		s.Status = constant.Disconnected
-		s.SSHClient.Close()
-		s.SSHClient = nil
+		// unless the client was closed on purpose meanwhile, such as an idle lazy connection
+		var event *ConnectionEvent
+		if s.SSHClient == client {
+			event = connectionPool.setDisconnectedLocked(s, fmt.Errorf("keepalive failed: %v", err), false)
+		}
 		connectionPool.mutex.Unlock()
+		connectionPool.emitConnectionEvent(event)
 		logs.Logger.Warn("SSH connection keepalive failed",
 			zap.String("server_id", strconv.Itoa(int(s.ID))),
 			zap.Error(err))
@@ -343,71 +413,78 @@ func (s *Server) CheckSSHConnection() bool {
 }
 
 // StartSSHConnectionCheckTicker start scheduled batch detection (interval configurable)
-// interval: detection interval, in seconds
+// interval: keepalive interval of connected servers, in seconds
+// disconnected servers are retried when their backoff expires, see reconnectDelay
 func (c *ConnectionPool) StartSSHConnectionCheckTicker(interval int) {
-	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	// tick every second so retries follow their backoff, keepalive still runs once per interval
+	ticker := time.NewTicker(time.Second)
 	defer ticker.Stop()
 
 	for range ticker.C {
+		now := time.Now()
 		c.mutex.RLock() // read lock: batch read servers, don't block other read operations
-		servers := make(map[uint]*Server, len(c.servers))
+		due := make(map[uint]bool, len(c.servers))
+		for k, v := range c.servers {
+			switch {
+			case v.reconnecting:
+			case c.lazyMode && v.Status != constant.Connected:
+				// lazy servers connect when they are needed, see acquire
+			case v.Status == constant.Connected:
+				// check if detection interval has been exceeded
+				due[k] = v.LastCheckTime.Add(time.Duration(interval) * time.Second).Before(now)
+			default:
+				due[k] = !v.NextRetryAt.After(now)
+			}
+		}
+		servers := make([]*Server, 0, len(due))
 		for k, v := range c.servers {
-			// check if detection interval has been exceeded
-			if v.LastCheckTime.Add(time.Duration(interval) * time.Second).Before(time.Now()) {
-				servers[k] = v
+			// connected servers behind a due jump server are checked too, their tunnels depend on it
+			chain, _ := c.jumpServerChain(k)
+			for _, jumpServer := range chain {
+				if due[jumpServer.ID] && v.Status == constant.Connected && !v.reconnecting {
+					due[k] = true
+				}
+			}
+			if due[k] {
+				servers = append(servers, v)
 			}
 		}
+		// rebuild jump chains in order: jump servers reconnect before servers behind them
+		c.sortByJumpDepth(servers)
 		c.mutex.RUnlock()
 
+		if c.lazyMode {
+			c.reapIdleClients()
+		}
+
 		// batch detect SSH connection for each server
 		for _, s := range servers {
-			// try to reconnect when detection fails
-			if !s.CheckSSHConnection() {
-				// websocket broadcast server status
-				ws.SendMessage(ws.Message{
-					ServerID:     s.ID,
-					ServerStatus: s.Status,
-				})
-
-				logs.Logger.Info("try to reconnect SSH server",
-					zap.String("server_id", strconv.Itoa(int(s.ID))))
-
-				client, err := sshConnect(&ServerConfig{
-					AuthMethod: s.AuthMethod,
-					Credential: s.Credential,
-					IP:         s.IP,
-					Password:   s.Password,
-					Port:       s.Port,
-					User:       s.User,
-				})
-				if err != nil {
-					logs.Logger.Error("reconnect SSH server failed",
-						zap.String("server_id", strconv.Itoa(int(s.ID))),
-						zap.String("server_ip", s.IP),
-						zap.Error(err),
-					)
-					continue
-				}
-				// if reconnection successful, update server status
-				c.mutex.Lock()
-				if existingServer, exists := c.servers[s.ID]; exists {
-					existingServer.SSHClient = client
-					existingServer.LastCheckTime = time.Now()
-					existingServer.Status = constant.Connected
-					ws.SendMessage(ws.Message{
-						ServerID:     s.ID,
-						ServerStatus: constant.Connected,
-					})
-				}
-				c.mutex.Unlock()
-			} else {
+			if s.CheckSSHConnection() {
 				// update server check time in UI
 				ws.SendMessage(ws.Message{
 					ServerID:     s.ID,
 					ServerStatus: s.Status,
 				})
+				continue
 			}
-		}
 
+			// try to reconnect when detection fails, lazy servers reconnect on next use
+			if c.lazyMode || !c.beginReconnect(s) {
+				continue
+			}
+			logs.Logger.Info("try to reconnect SSH server",
+				zap.String("server_id", strconv.Itoa(int(s.ID))))
+			if err := c.reconnect(s); err != nil {
+				c.mutex.RLock()
+				nextRetryAt := s.NextRetryAt
+				c.mutex.RUnlock()
+				logs.Logger.Error("reconnect SSH server failed",
+					zap.String("server_id", strconv.Itoa(int(s.ID))),
+					zap.String("server_ip", s.IP),
+					zap.Time("next_retry_at", nextRetryAt),
+					zap.Error(err),
+				)
+			}
+		}
 	}
 }
@@ -0,0 +1,146 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// load private key, managed key first, then key file on this host
+// Password is used as passphrase of an encrypted key file
+func loadSigner(config *ServerConfig) (ssh.Signer, error) {
+	key := []byte(config.PrivateKey)
+	if len(key) == 0 {
+		var err error
+		if key, err = os.ReadFile(config.Credential); err != nil {
+			return nil, fmt.Errorf("load key file failed: %v", err)
+		}
+	}
+
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		// try to handle key with password
+		if config.Password != "" {
+			signer, err = ssh.ParsePrivateKeyWithPassphrase(key, []byte(config.Password))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse key failed: %v", err)
+		}
+	}
+	return signer, nil
+}
+
+// load user certificate, Certificate holds the certificate itself or a path to it,
+// when empty <key file>-cert.pub is used like OpenSSH does
+// files are read on every connect so certificates renewed by a signing service are picked up
+func loadCertificate(config *ServerConfig) (*ssh.Certificate, error) {
+	content := strings.TrimSpace(config.Certificate)
+	if !strings.Contains(content, "-cert-v01@openssh.com ") {
+		path := content
+		if path == "" {
+			if config.Credential == "" {
+				return nil, fmt.Errorf("certificate required for managed key")
+			}
+			path = config.Credential + "-cert.pub"
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("load certificate file failed: %v", err)
+		}
+		content = string(data)
+	}
+
+	publicKey, _, _, _, err := ssh.ParseAuthorizedKey([]byte(content))
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate failed: %v", err)
+	}
+	cert, ok := publicKey.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("not a certificate: %s", publicKey.Type())
+	}
+	if cert.CertType != ssh.UserCert {
+		return nil, fmt.Errorf("not a user certificate")
+	}
+	return cert, nil
+}
+
+func certificateTime(t uint64) time.Time {
+	return time.Unix(int64(t), 0)
+}
+
+// reject certificate outside its validity period, servers would refuse it anyway
+func checkCertificateValidity(cert *ssh.Certificate, now time.Time) error {
+	unix := uint64(now.Unix())
+	if unix < cert.ValidAfter {
+		return fmt.Errorf("certificate not valid before %s", certificateTime(cert.ValidAfter).Format(time.RFC3339))
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity && unix >= cert.ValidBefore {
+		return fmt.Errorf("certificate expired at %s", certificateTime(cert.ValidBefore).Format(time.RFC3339))
+	}
+	return nil
+}
+
+// connect to ssh-agent, Credential may hold the socket path, default is SSH_AUTH_SOCK
+func dialAgent(config *ServerConfig) (agent.ExtendedAgent, net.Conn, error) {
+	socket := config.Credential
+	if socket == "" {
+		socket = os.Getenv("SSH_AUTH_SOCK")
+	}
+	if socket == "" {
+		return nil, nil, fmt.Errorf("SSH_AUTH_SOCK not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, nil, fmt.Errorf("connect ssh agent failed: %v", err)
+	}
+	return agent.NewClient(conn), conn, nil
+}
+
+// CertificateInfo user certificate of a server using certificate authentication
+type CertificateInfo struct {
+	KeyID       string
+	Principals  []string
+	ValidAfter  time.Time
+	ValidBefore time.Time // zero if the certificate never expires
+	Expired     bool
+}
+
+// CertificateInfo load certificate of server, nil if the server does not use certificate authentication
+func (s *Server) CertificateInfo() (*CertificateInfo, error) {
+	if s.AuthMethod != constant.AuthMethodCertificate {
+		return nil, nil
+	}
+	cert, err := loadCertificate(s.serverConfig())
+	if err != nil {
+		return nil, err
+	}
+	info := &CertificateInfo{
+		KeyID:      cert.KeyId,
+		Principals: cert.ValidPrincipals,
+		ValidAfter: certificateTime(cert.ValidAfter),
+	}
+	if cert.ValidBefore != ssh.CertTimeInfinity {
+		info.ValidBefore = certificateTime(cert.ValidBefore)
+		info.Expired = !time.Now().Before(info.ValidBefore)
+	}
+	return info, nil
+}
+
+// answer hidden keyboard-interactive prompts with password, visible prompts (such as a username) get an empty answer
+func answerPasswordChallenge(password string) ssh.KeyboardInteractiveChallenge {
+	return func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range questions {
+			if !echos[i] {
+				answers[i] = password
+			}
+		}
+		return answers, nil
+	}
+}
@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"GolangOM/logs"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/ssh"
+)
+
+// KeyPair managed SSH key, PrivateKey is an unencrypted OpenSSH PEM, encrypted at rest by the caller
+type KeyPair struct {
+	KeyType     string // public key algorithm, such as ssh-ed25519
+	PrivateKey  string
+	PublicKey   string // authorized_keys line
+	Fingerprint string // SHA256 fingerprint
+}
+
+var keyCommentPattern = regexp.MustCompile(`[^A-Za-z0-9._@-]+`)
+
+func newKeyPair(rawKey any, comment string) (*KeyPair, error) {
+	comment = keyCommentPattern.ReplaceAllString(comment, "-")
+	block, err := ssh.MarshalPrivateKey(rawKey, comment)
+	if err != nil {
+		return nil, fmt.Errorf("marshal private key failed: %w", err)
+	}
+	signer, err := ssh.NewSignerFromKey(rawKey)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported key: %w", err)
+	}
+	publicKey := strings.TrimSpace(string(ssh.MarshalAuthorizedKey(signer.PublicKey())))
+	if comment != "" {
+		publicKey += " " + comment
+	}
+	return &KeyPair{
+		KeyType:     signer.PublicKey().Type(),
+		PrivateKey:  string(pem.EncodeToMemory(block)),
+		PublicKey:   publicKey,
+		Fingerprint: ssh.FingerprintSHA256(signer.PublicKey()),
+	}, nil
+}
+
+// GenerateKeyPair generate ed25519 or rsa key, bits only applies to rsa and defaults to 4096
+func GenerateKeyPair(keyType string, bits int, comment string) (*KeyPair, error) {
+	switch keyType {
+	case "ed25519":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return newKeyPair(key, comment)
+	case "rsa":
+		if bits == 0 {
+			bits = 4096
+		}
+		if bits < 2048 || bits > 8192 {
+			return nil, fmt.Errorf("rsa key size must be between 2048 and 8192")
+		}
+		key, err := rsa.GenerateKey(rand.Reader, bits)
+		if err != nil {
+			return nil, err
+		}
+		return newKeyPair(key, comment)
+	}
+	return nil, fmt.Errorf("not supported key type %s, use ed25519 or rsa", keyType)
+}
+
+// ParseKeyPair parse uploaded private key, an encrypted key is decrypted with passphrase
+// and stored without it
+func ParseKeyPair(privateKey string, passphrase string, comment string) (*KeyPair, error) {
+	rawKey, err := ssh.ParseRawPrivateKey([]byte(privateKey))
+	var missingErr *ssh.PassphraseMissingError
+	if errors.As(err, &missingErr) {
+		if passphrase == "" {
+			return nil, fmt.Errorf("private key is encrypted, passphrase required")
+		}
+		rawKey, err = ssh.ParseRawPrivateKeyWithPassphrase([]byte(privateKey), []byte(passphrase))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse private key failed: %w", err)
+	}
+	return newKeyPair(rawKey, comment)
+}
+
+// quote s as a single POSIX shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+// AuthorizePublicKey append publicKey to ~/.ssh/authorized_keys of the login user,
+// runs over the current connection, nothing is appended if the key is already there
+func (s *Server) AuthorizePublicKey(ctx context.Context, publicKey string) error {
+	fields := strings.Fields(publicKey)
+	if len(fields) < 2 {
+		return fmt.Errorf("invalid public key")
+	}
+	// match on type and key data, the comment may differ
+	keyData := shellQuote(fields[0] + " " + fields[1])
+	cmd := "umask 077 && mkdir -p ~/.ssh && touch ~/.ssh/authorized_keys && " +
+		"(grep -qF " + keyData + " ~/.ssh/authorized_keys || echo " + shellQuote(publicKey) + " >> ~/.ssh/authorized_keys)"
+
+	result, err := s.ExecuteCommandContext(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if !result.Success() {
+		return fmt.Errorf("authorize public key failed: %s, err out: %s", result.exitDescription(), result.Stderr)
+	}
+	logs.Logger.Info("public key authorized",
+		zap.String("server_id", strconv.Itoa(int(s.ID))),
+		zap.String("key", fields[0]))
+	return nil
+}
@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"GolangOM/constant"
+	"context"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Terminal interactive shell attached to a PTY
+type Terminal interface {
+	io.ReadWriteCloser
+	Resize(cols int, rows int) error
+}
+
+type sshTerminal struct {
+	session *ssh.Session
+	stdin   io.WriteCloser
+	stdout  io.Reader
+	release func() // give the pooled connection back
+}
+
+// OpenTerminal start an interactive shell on server, local server uses a local PTY
+func (s *Server) OpenTerminal(cols int, rows int) (Terminal, error) {
+	if s.ID == constant.LocalServerID {
+		return openLocalTerminal(cols, rows)
+	}
+
+	client, release, err := s.AcquireClient(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	// connection and session slot stay in use while the terminal is open
+	session, releaseSession, err := s.openSession(context.Background(), client)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("create session failed: %w", err)
+	}
+	terminal := &sshTerminal{session: session, release: func() {
+		releaseSession()
+		release()
+	}}
+
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	if err := session.RequestPty("xterm-256color", rows, cols, modes); err != nil {
+		terminal.Close()
+		return nil, fmt.Errorf("request pty failed: %v", err)
+	}
+
+	terminal.stdin, err = session.StdinPipe()
+	if err != nil {
+		terminal.Close()
+		return nil, err
+	}
+	terminal.stdout, err = session.StdoutPipe()
+	if err != nil {
+		terminal.Close()
+		return nil, err
+	}
+	// stderr goes through the PTY as well, keep it on the same stream
+	session.Stderr = session.Stdout
+
+	if err := session.Shell(); err != nil {
+		terminal.Close()
+		return nil, fmt.Errorf("start shell failed: %v", err)
+	}
+
+	return terminal, nil
+}
+
+func (t *sshTerminal) Read(p []byte) (int, error) {
+	return t.stdout.Read(p)
+}
+
+func (t *sshTerminal) Write(p []byte) (int, error) {
+	return t.stdin.Write(p)
+}
+
+func (t *sshTerminal) Resize(cols int, rows int) error {
+	return t.session.WindowChange(rows, cols)
+}
+
+func (t *sshTerminal) Close() error {
+	err := t.session.Close()
+	t.release()
+	return err
+}
@@ -0,0 +1,90 @@
+//go:build linux
+
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+type localTerminal struct {
+	ptmx *os.File
+	fd   int
+	cmd  *exec.Cmd
+}
+
+// start local shell attached to a new pseudo terminal
+func openLocalTerminal(cols int, rows int) (Terminal, error) {
+	ptmx, err := os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open ptmx failed: %v", err)
+	}
+	fd := int(ptmx.Fd())
+
+	// unlock slave side and get its number
+	if err := unix.IoctlSetPointerInt(fd, unix.TIOCSPTLCK, 0); err != nil {
+		ptmx.Close()
+		return nil, fmt.Errorf("unlock pty failed: %v", err)
+	}
+	ptyNumber, err := unix.IoctlGetInt(fd, unix.TIOCGPTN)
+	if err != nil {
+		ptmx.Close()
+		return nil, fmt.Errorf("get pty number failed: %v", err)
+	}
+	tty, err := os.OpenFile("/dev/pts/"+strconv.Itoa(ptyNumber), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		ptmx.Close()
+		return nil, fmt.Errorf("open pty slave failed: %v", err)
+	}
+	defer tty.Close()
+
+	terminal := &localTerminal{ptmx: ptmx, fd: fd}
+	if err := terminal.Resize(cols, rows); err != nil {
+		ptmx.Close()
+		return nil, err
+	}
+
+	shell := os.Getenv("SHELL")
+	if shell == "" {
+		shell = "/bin/sh"
+	}
+	cmd := exec.Command(shell, "-l")
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+	// new session with the PTY as controlling terminal, so job control and Ctrl+C work
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true, Setctty: true}
+	if err := cmd.Start(); err != nil {
+		ptmx.Close()
+		return nil, fmt.Errorf("start local shell failed: %v", err)
+	}
+	terminal.cmd = cmd
+	return terminal, nil
+}
+
+func (t *localTerminal) Read(p []byte) (int, error) {
+	return t.ptmx.Read(p)
+}
+
+func (t *localTerminal) Write(p []byte) (int, error) {
+	return t.ptmx.Write(p)
+}
+
+func (t *localTerminal) Resize(cols int, rows int) error {
+	return unix.IoctlSetWinsize(t.fd, unix.TIOCSWINSZ, &unix.Winsize{Row: uint16(rows), Col: uint16(cols)})
+}
+
+func (t *localTerminal) Close() error {
+	err := t.ptmx.Close()
+	if t.cmd != nil && t.cmd.Process != nil {
+		t.cmd.Process.Kill()
+		t.cmd.Wait()
+	}
+	return err
+}
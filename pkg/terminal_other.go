@@ -0,0 +1,10 @@
+//go:build !linux
+
+package pkg
+
+import "fmt"
+
+// local PTY is only implemented for linux
+func openLocalTerminal(cols int, rows int) (Terminal, error) {
+	return nil, fmt.Errorf("local terminal not supported on this platform")
+}
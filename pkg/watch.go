@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"GolangOM/logs"
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.uber.org/zap"
+)
+
+// hidden files and directories, such as .git or editor swap files, never trigger a change
+func hiddenPath(path string) bool {
+	return strings.HasPrefix(filepath.Base(path), ".")
+}
+
+func isSymlink(path string) bool {
+	info, err := os.Lstat(path)
+	return err == nil && info.Mode()&os.ModeSymlink != 0
+}
+
+// deepest path of dir or its parents that is a symlink, empty if there is none
+func symlinkAncestor(dir string) string {
+	for path := filepath.Clean(dir); ; path = filepath.Dir(path) {
+		if isSymlink(path) {
+			return path
+		}
+		if parent := filepath.Dir(path); parent == path {
+			return ""
+		}
+	}
+}
+
+// WalkTree walk dir like filepath.WalkDir, a symlinked dir is followed,
+// fn gets paths below dir even though the files live in the link target
+func WalkTree(dir string, fn fs.WalkDirFunc) error {
+	root, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if rel, relErr := filepath.Rel(root, path); relErr == nil {
+			path = filepath.Join(dir, rel)
+		}
+		return fn(path, entry, err)
+	})
+}
+
+// watch directory and its subdirectories, new subdirectories are added as they appear
+func watchTree(watcher *fsnotify.Watcher, dir string) error {
+	return WalkTree(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		if path != dir && hiddenPath(path) {
+			return filepath.SkipDir
+		}
+		return watcher.Add(path)
+	})
+}
+
+// WatchDirectory call onChange once files under dir stop changing for debounce, until ctx is done,
+// editors and git checkouts write several files in a row and should cause a single call
+// content published by swapping a symlink is followed: a symlinked dir or parent of it, as kept by git-sync,
+// and hidden symlinks such as ..data of Kubernetes ConfigMap volumes
+func WatchDirectory(ctx context.Context, dir string, debounce time.Duration, onChange func()) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+	if err := watchTree(watcher, dir); err != nil {
+		return err
+	}
+	// the watches stay on the old target when the link is replaced, so watch the link itself as well
+	link := symlinkAncestor(dir)
+	if link != "" {
+		if err := watcher.Add(filepath.Dir(link)); err != nil {
+			return err
+		}
+	}
+
+	timer := time.NewTimer(debounce)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if link != "" && filepath.Dir(event.Name) == filepath.Dir(link) {
+				if event.Name != link || !event.Op.Has(fsnotify.Create) {
+					continue
+				}
+				// link replaced, move the watches to the new target
+				for _, path := range watcher.WatchList() {
+					if path != filepath.Dir(link) {
+						watcher.Remove(path)
+					}
+				}
+				if err := watchTree(watcher, dir); err != nil {
+					logs.Logger.Warn("watch directory failed", zap.String("dir", dir), zap.Error(err))
+				}
+				timer.Reset(debounce)
+				continue
+			}
+			if event.Op == fsnotify.Chmod || (hiddenPath(event.Name) && !isSymlink(event.Name)) {
+				continue
+			}
+			if event.Op.Has(fsnotify.Create) && !hiddenPath(event.Name) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					if err := watchTree(watcher, event.Name); err != nil {
+						logs.Logger.Warn("watch directory failed", zap.String("dir", event.Name), zap.Error(err))
+					}
+				}
+			}
+			timer.Reset(debounce)
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logs.Logger.Warn("directory watcher error", zap.String("dir", dir), zap.Error(err))
+		case <-timer.C:
+			onChange()
+		}
+	}
+}
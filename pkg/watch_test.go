@@ -0,0 +1,157 @@
+package pkg
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+const watchDebounce = 50 * time.Millisecond
+
+func startWatch(t *testing.T, dir string) <-chan struct{} {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	changes := make(chan struct{}, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- WatchDirectory(ctx, dir, watchDebounce, func() { changes <- struct{}{} })
+	}()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("WatchDirectory: %v", err)
+		}
+	})
+	// give the watcher time to add its watches
+	time.Sleep(100 * time.Millisecond)
+	return changes
+}
+
+func expectChange(t *testing.T, changes <-chan struct{}, want bool) {
+	t.Helper()
+	select {
+	case <-changes:
+		if !want {
+			t.Fatal("unexpected change")
+		}
+	case <-time.After(10 * watchDebounce):
+		if want {
+			t.Fatal("no change reported")
+		}
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// replace link atomically, the way git-sync and the kubelet do
+func swapSymlink(t *testing.T, target, link string) {
+	t.Helper()
+	tmp := link + ".tmp"
+	if err := os.Symlink(target, tmp); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchDirectory(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "servers.yaml"), "a")
+	changes := startWatch(t, dir)
+
+	writeFile(t, filepath.Join(dir, ".servers.yaml.swp"), "x")
+	expectChange(t, changes, false)
+
+	writeFile(t, filepath.Join(dir, "servers.yaml"), "b")
+	expectChange(t, changes, true)
+
+	// files of a new subdirectory are watched too
+	if err := os.Mkdir(filepath.Join(dir, "apps"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	expectChange(t, changes, true)
+	writeFile(t, filepath.Join(dir, "apps", "web.yaml"), "a")
+	expectChange(t, changes, true)
+}
+
+func TestWatchDirectorySymlinkSwap(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "rev1", "servers.yaml"), "a")
+	writeFile(t, filepath.Join(root, "rev2", "servers.yaml"), "b")
+	link := filepath.Join(root, "current")
+	if err := os.Symlink("rev1", link); err != nil {
+		t.Fatal(err)
+	}
+	changes := startWatch(t, link)
+
+	swapSymlink(t, "rev2", link)
+	expectChange(t, changes, true)
+
+	// the watches moved to the new target
+	writeFile(t, filepath.Join(root, "rev2", "servers.yaml"), "c")
+	expectChange(t, changes, true)
+	writeFile(t, filepath.Join(root, "rev1", "servers.yaml"), "c")
+	expectChange(t, changes, false)
+
+	// unrelated entries next to the link are ignored
+	writeFile(t, filepath.Join(root, "rev3", "servers.yaml"), "d")
+	expectChange(t, changes, false)
+}
+
+func TestWatchDirectoryConfigMapSwap(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "..2026_01_01", "servers.yaml"), "a")
+	writeFile(t, filepath.Join(dir, "..2026_01_02", "servers.yaml"), "b")
+	if err := os.Symlink("..2026_01_01", filepath.Join(dir, "..data")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..data", "servers.yaml"), filepath.Join(dir, "servers.yaml")); err != nil {
+		t.Fatal(err)
+	}
+	changes := startWatch(t, dir)
+
+	swapSymlink(t, "..2026_01_02", filepath.Join(dir, "..data"))
+	expectChange(t, changes, true)
+}
+
+func TestWalkTree(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "rev1", "servers.yaml"), "a")
+	writeFile(t, filepath.Join(root, "rev1", "apps", "web.yaml"), "a")
+	link := filepath.Join(root, "current")
+	if err := os.Symlink("rev1", link); err != nil {
+		t.Fatal(err)
+	}
+
+	var files []string
+	err := WalkTree(link, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(files)
+	want := []string{filepath.Join(link, "apps", "web.yaml"), filepath.Join(link, "servers.yaml")}
+	if len(files) != len(want) || files[0] != want[0] || files[1] != want[1] {
+		t.Fatalf("files = %v, want %v", files, want)
+	}
+}
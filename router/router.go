@@ -2,6 +2,7 @@ package router
 
 import (
 	"GolangOM/controller"
+	"GolangOM/logs"
 	"GolangOM/middleware"
 	"GolangOM/ws"
 	"fmt"
@@ -65,6 +66,48 @@ func InitRouter() {
 		apis.POST("/server/create", controller.CreateServerFunc())
 		apis.POST("/server/update", controller.UpdateServerFunc())
 		apis.POST("/server/delete", controller.DeleteServerFunc())
+		apis.POST("/server/reconnect", controller.ReconnectServerFunc())
+		apis.POST("/server/import", controller.ImportServersFunc())
+		apis.POST("/server/history", controller.GetServerHistoryFunc())
+		apis.POST("/server/facts/refresh", controller.RefreshServerFactsFunc())
+		apis.POST("/server/metrics", controller.GetServerMetricsFunc())
+		apis.POST("/server/hostkey/get", controller.GetHostKeyFunc())
+		apis.POST("/server/hostkey/accept", controller.AcceptHostKeyFunc())
+		apis.POST("/server/hostkey/reset", controller.ResetHostKeyFunc())
+		apis.POST("/server/files/list", controller.ListFilesFunc())
+		apis.POST("/server/files/upload", controller.UploadFileFunc())
+		apis.GET("/server/files/download", controller.DownloadFileFunc())
+		apis.POST("/server/files/mkdir", controller.MkdirFunc())
+		apis.POST("/server/files/rename", controller.RenameFileFunc())
+		apis.POST("/server/files/delete", controller.DeleteFileFunc())
+		apis.POST("/server/files/chmod", controller.ChmodFileFunc())
+		apis.GET("/group/list", controller.GetServerGroupListFunc())
+		apis.POST("/group/get", controller.GetServerGroupFunc())
+		apis.POST("/group/create", controller.CreateServerGroupFunc())
+		apis.POST("/group/update", controller.UpdateServerGroupFunc())
+		apis.POST("/group/delete", controller.DeleteServerGroupFunc())
+		apis.GET("/config/export", controller.ExportConfigFunc())
+		apis.POST("/config/import", controller.ImportConfigFunc())
+		apis.GET("/manifest/status", controller.GetManifestStatusFunc())
+		apis.POST("/manifest/reconcile", controller.ReconcileManifestsFunc())
+		apis.POST("/batch/exec", controller.BatchExecuteFunc())
+		apis.GET("/sshkey/list", controller.GetSSHKeyListFunc())
+		apis.POST("/sshkey/generate", controller.GenerateSSHKeyFunc())
+		apis.POST("/sshkey/upload", controller.UploadSSHKeyFunc())
+		apis.POST("/sshkey/delete", controller.DeleteSSHKeyFunc())
+		apis.POST("/sshkey/push", controller.PushSSHKeyFunc())
+		apis.GET("/alert/rule/list", controller.GetAlertRuleListFunc())
+		apis.POST("/alert/rule/create", controller.CreateAlertRuleFunc())
+		apis.POST("/alert/rule/update", controller.UpdateAlertRuleFunc())
+		apis.POST("/alert/rule/delete", controller.DeleteAlertRuleFunc())
+		apis.POST("/alert/list", controller.GetAlertListFunc())
+		apis.GET("/forward/list", controller.GetForwardListFunc())
+		apis.POST("/forward/get", controller.GetForwardFunc())
+		apis.POST("/forward/create", controller.CreateForwardFunc())
+		apis.POST("/forward/update", controller.UpdateForwardFunc())
+		apis.POST("/forward/delete", controller.DeleteForwardFunc())
+		apis.POST("/forward/start", controller.StartForwardFunc())
+		apis.POST("/forward/stop", controller.StopForwardFunc())
 		apis.GET("/app/list", controller.GetAppListFunc())
 		apis.POST("/app/get", controller.GetAppFunc())
 		apis.POST("/app/create", controller.CreateAppFunc())
@@ -72,6 +115,15 @@ func InitRouter() {
 		apis.POST("/app/delete", controller.DeleteAppFunc())
 
 		apis.GET("/ws", ws.WebsocketFunc())
+		apis.GET("/terminal", controller.TerminalFunc())
+	}
+
+	// scraped by Prometheus, optionally protected by its own token instead of the login session
+	if viper.GetBool("Prometheus.Enabled") {
+		if viper.GetString("Prometheus.Token") == "" {
+			logs.Logger.Warn("Prometheus /metrics is enabled without Prometheus.Token, anyone reaching the port can read server addresses and metrics")
+		}
+		r.GET("/metrics", middleware.MetricsTokenMiddleware(), controller.PrometheusMetricsFunc())
 	}
 
 	port := viper.GetInt("Server.WebUIPort")
@@ -0,0 +1,266 @@
+package util
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/viper"
+)
+
+// MasterKeyEnv environment variable holding the base64 master key, overrides the config file
+const MasterKeyEnv = "GOLANGOM_MASTER_KEY"
+
+// encrypted value: enc:v1:<master key ID>:<wrapped data key>:<sealed value>
+const secretPrefix = "enc:v1:"
+
+var ErrSecretKeyMismatch = errors.New("secret is encrypted with another master key")
+
+// SecretBox envelope encryption with AES-GCM: every value is sealed with its own random data key,
+// and the data key is sealed with the master key, so rotating the master key only rewraps data keys
+type SecretBox struct {
+	keyID string
+	aead  cipher.AEAD
+}
+
+func NewSecretBox(masterKey []byte) (*SecretBox, error) {
+	aead, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(masterKey)
+	return &SecretBox{keyID: hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("key must be 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// KeyID short ID of the master key, stored with every value to detect a wrong key
+func (b *SecretBox) KeyID() string {
+	return b.keyID
+}
+
+// IsEncryptedSecret value was produced by SecretBox.Encrypt
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+func seal(aead cipher.AEAD, plain []byte) []byte {
+	nonce := make([]byte, aead.NonceSize())
+	rand.Read(nonce)
+	return aead.Seal(nonce, nonce, plain, nil)
+}
+
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("sealed value too short")
+	}
+	nonce, data := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, data, nil)
+}
+
+// Encrypt empty values stay empty so "no password" is still recognizable
+func (b *SecretBox) Encrypt(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+	dataKey := make([]byte, 32)
+	rand.Read(dataKey)
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	return secretPrefix + b.keyID + ":" +
+		base64.StdEncoding.EncodeToString(seal(b.aead, dataKey)) + ":" +
+		base64.StdEncoding.EncodeToString(seal(dataAEAD, []byte(plain))), nil
+}
+
+// split encrypted value into key ID, wrapped data key and sealed value
+func parseSecret(value string) (string, []byte, []byte, error) {
+	parts := strings.Split(strings.TrimPrefix(value, secretPrefix), ":")
+	if len(parts) != 3 {
+		return "", nil, nil, fmt.Errorf("malformed secret")
+	}
+	wrappedKey, err := base64.StdEncoding.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed secret: %w", err)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("malformed secret: %w", err)
+	}
+	return parts[0], wrappedKey, sealed, nil
+}
+
+func (b *SecretBox) unwrapDataKey(keyID string, wrappedKey []byte) ([]byte, error) {
+	if keyID != b.keyID {
+		return nil, fmt.Errorf("%w: %s", ErrSecretKeyMismatch, keyID)
+	}
+	dataKey, err := open(b.aead, wrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("unwrap data key failed: %w", err)
+	}
+	return dataKey, nil
+}
+
+// Decrypt values that are not encrypted are returned as is, they are stored before encryption was enabled
+func (b *SecretBox) Decrypt(value string) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return value, nil
+	}
+	keyID, wrappedKey, sealed, err := parseSecret(value)
+	if err != nil {
+		return "", err
+	}
+	dataKey, err := b.unwrapDataKey(keyID, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return "", err
+	}
+	plain, err := open(dataAEAD, sealed)
+	if err != nil {
+		return "", fmt.Errorf("decrypt secret failed: %w", err)
+	}
+	return string(plain), nil
+}
+
+// Rewrap re-seal the data key of value with the master key of to, the value itself is not decrypted
+// plaintext values are encrypted, values already under to are returned unchanged
+func (b *SecretBox) Rewrap(value string, to *SecretBox) (string, error) {
+	if !IsEncryptedSecret(value) {
+		return to.Encrypt(value)
+	}
+	keyID, wrappedKey, sealed, err := parseSecret(value)
+	if err != nil {
+		return "", err
+	}
+	if keyID == to.keyID {
+		return value, nil
+	}
+	dataKey, err := b.unwrapDataKey(keyID, wrappedKey)
+	if err != nil {
+		return "", err
+	}
+	return secretPrefix + to.keyID + ":" +
+		base64.StdEncoding.EncodeToString(seal(to.aead, dataKey)) + ":" +
+		base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// GenerateMasterKey random 32 byte master key
+func GenerateMasterKey() []byte {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return key
+}
+
+func EncodeMasterKey(key []byte) string {
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func ParseMasterKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("master key is not base64: %w", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("master key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+// LoadMasterKey master key from env, then Security.MasterKey, then Security.MasterKeyFile
+// the key file is generated on first use, keyFile is empty if the key does not come from a file
+func LoadMasterKey() (key []byte, keyFile string, err error) {
+	if encoded := os.Getenv(MasterKeyEnv); encoded != "" {
+		key, err = ParseMasterKey(encoded)
+		return key, "", err
+	}
+	if encoded := viper.GetString("Security.MasterKey"); encoded != "" {
+		key, err = ParseMasterKey(encoded)
+		return key, "", err
+	}
+
+	keyFile = viper.GetString("Security.MasterKeyFile")
+	if keyFile == "" {
+		keyFile = "config/master.key"
+	}
+	content, err := os.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		key = GenerateMasterKey()
+		return key, keyFile, SaveMasterKeyFile(keyFile, key)
+	}
+	if err != nil {
+		return nil, keyFile, err
+	}
+	key, err = ParseMasterKey(string(content))
+	return key, keyFile, err
+}
+
+// SaveMasterKeyFile write key readable only by the owner, replacing the file atomically
+func SaveMasterKeyFile(keyFile string, key []byte) error {
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return err
+	}
+	tmp := keyFile + ".tmp"
+	if err := os.WriteFile(tmp, []byte(EncodeMasterKey(key)+"\n"), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, keyFile)
+}
+
+var (
+	secretBox     *SecretBox
+	secretBoxErr  error
+	secretBoxOnce sync.Once
+)
+
+// GetSecretBox secret box of the configured master key
+func GetSecretBox() (*SecretBox, error) {
+	secretBoxOnce.Do(func() {
+		key, _, err := LoadMasterKey()
+		if err != nil {
+			secretBoxErr = fmt.Errorf("load master key failed: %w", err)
+			return
+		}
+		secretBox, secretBoxErr = NewSecretBox(key)
+	})
+	return secretBox, secretBoxErr
+}
+
+// EncryptSecret encrypt with the configured master key
+func EncryptSecret(plain string) (string, error) {
+	box, err := GetSecretBox()
+	if err != nil {
+		return "", err
+	}
+	return box.Encrypt(plain)
+}
+
+// DecryptSecret decrypt with the configured master key
+func DecryptSecret(value string) (string, error) {
+	box, err := GetSecretBox()
+	if err != nil {
+		return "", err
+	}
+	return box.Decrypt(value)
+}
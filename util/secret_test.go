@@ -0,0 +1,165 @@
+package util
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func newTestSecretBox(t *testing.T) *SecretBox {
+	t.Helper()
+	box, err := NewSecretBox(GenerateMasterKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return box
+}
+
+func TestSecretBoxRoundTrip(t *testing.T) {
+	box := newTestSecretBox(t)
+	for _, plain := range []string{"p@ss:word", "密码", strings.Repeat("x", 4096)} {
+		sealed, err := box.Encrypt(plain)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !IsEncryptedSecret(sealed) || strings.Contains(sealed, plain) {
+			t.Fatalf("value not sealed: %s", sealed)
+		}
+		if !strings.HasPrefix(sealed, secretPrefix+box.KeyID()+":") {
+			t.Fatalf("value does not carry key ID %s: %s", box.KeyID(), sealed)
+		}
+		again, _ := box.Encrypt(plain)
+		if again == sealed {
+			t.Fatal("two encryptions of the same value are equal")
+		}
+		got, err := box.Decrypt(sealed)
+		if err != nil || got != plain {
+			t.Fatalf("Decrypt() = %q, %v", got, err)
+		}
+	}
+
+	if sealed, err := box.Encrypt(""); err != nil || sealed != "" {
+		t.Fatalf("empty value encrypted to %q, %v", sealed, err)
+	}
+	if got, err := box.Decrypt("stored before encryption"); err != nil || got != "stored before encryption" {
+		t.Fatalf("plaintext value: %q, %v", got, err)
+	}
+}
+
+func TestSecretBoxRejects(t *testing.T) {
+	box := newTestSecretBox(t)
+	sealed, err := box.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newTestSecretBox(t).Decrypt(sealed); !errors.Is(err, ErrSecretKeyMismatch) {
+		t.Fatalf("other key: %v", err)
+	}
+	// same key ID, different key: the data key cannot be unwrapped
+	forged := &SecretBox{keyID: box.keyID, aead: newTestSecretBox(t).aead}
+	if _, err := forged.Decrypt(sealed); err == nil || errors.Is(err, ErrSecretKeyMismatch) {
+		t.Fatalf("forged key ID: %v", err)
+	}
+
+	parts := strings.Split(sealed, ":")
+	value := []byte(parts[len(parts)-1])
+	value[len(value)/2] ^= 1
+	parts[len(parts)-1] = string(value)
+	tests := map[string]string{
+		"tampered":     strings.Join(parts, ":"),
+		"missing part": secretPrefix + box.KeyID() + ":abc",
+		"not base64":   secretPrefix + box.KeyID() + ":!!:!!",
+		"short":        secretPrefix + box.KeyID() + "::",
+	}
+	for name, value := range tests {
+		if _, err := box.Decrypt(value); err == nil {
+			t.Errorf("%s value decrypted", name)
+		}
+	}
+}
+
+func TestSecretBoxRewrap(t *testing.T) {
+	oldBox, newBox := newTestSecretBox(t), newTestSecretBox(t)
+	sealed, err := oldBox.Encrypt("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rewrapped, err := oldBox.Rewrap(sealed, newBox)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := newBox.Decrypt(rewrapped); err != nil || got != "secret" {
+		t.Fatalf("new key: %q, %v", got, err)
+	}
+	if _, err := oldBox.Decrypt(rewrapped); !errors.Is(err, ErrSecretKeyMismatch) {
+		t.Fatalf("old key still opens the rewrapped value: %v", err)
+	}
+	// only the data key is resealed, the sealed value stays as it was
+	if a, b := strings.Split(sealed, ":"), strings.Split(rewrapped, ":"); a[4] != b[4] || a[3] == b[3] {
+		t.Fatalf("rewrap changed the wrong part:\n%s\n%s", sealed, rewrapped)
+	}
+
+	// a rotation interrupted and run again leaves finished values alone
+	if again, err := oldBox.Rewrap(rewrapped, newBox); err != nil || again != rewrapped {
+		t.Fatalf("rewrap of a rewrapped value: %v", err)
+	}
+	if _, err := newTestSecretBox(t).Rewrap(sealed, newBox); !errors.Is(err, ErrSecretKeyMismatch) {
+		t.Fatalf("rewrap with a wrong current key: %v", err)
+	}
+
+	plain, err := oldBox.Rewrap("plaintext", newBox)
+	if err != nil || !IsEncryptedSecret(plain) {
+		t.Fatalf("plaintext value: %q, %v", plain, err)
+	}
+	if got, _ := newBox.Decrypt(plain); got != "plaintext" {
+		t.Fatalf("plaintext value decrypted to %q", got)
+	}
+	if empty, err := oldBox.Rewrap("", newBox); err != nil || empty != "" {
+		t.Fatalf("empty value: %q, %v", empty, err)
+	}
+}
+
+func TestParseMasterKey(t *testing.T) {
+	key := GenerateMasterKey()
+	parsed, err := ParseMasterKey(" " + EncodeMasterKey(key) + "\n")
+	if err != nil || string(parsed) != string(key) {
+		t.Fatalf("ParseMasterKey() = %v", err)
+	}
+	for _, encoded := range []string{"", "not base64!", EncodeMasterKey(key[:16])} {
+		if _, err := ParseMasterKey(encoded); err == nil {
+			t.Errorf("ParseMasterKey(%q) accepted", encoded)
+		}
+	}
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "keys", "master.key")
+	viper.Set("Security.MasterKeyFile", keyFile)
+	t.Cleanup(func() { viper.Set("Security.MasterKeyFile", nil) })
+
+	generated, file, err := LoadMasterKey()
+	if err != nil || file != keyFile {
+		t.Fatalf("first load: %s, %v", file, err)
+	}
+	info, err := os.Stat(keyFile)
+	if err != nil || info.Mode().Perm() != 0600 {
+		t.Fatalf("key file: %v, %v", info, err)
+	}
+	loaded, _, err := LoadMasterKey()
+	if err != nil || string(loaded) != string(generated) {
+		t.Fatalf("second load returned another key: %v", err)
+	}
+
+	envKey := GenerateMasterKey()
+	t.Setenv(MasterKeyEnv, EncodeMasterKey(envKey))
+	loaded, file, err = LoadMasterKey()
+	if err != nil || file != "" || string(loaded) != string(envKey) {
+		t.Fatalf("env key: %s, %v", file, err)
+	}
+}
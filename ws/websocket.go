@@ -34,6 +34,32 @@ type Message struct {
 	AppID        uint                   `json:"app_id"`
 	ServerStatus constant.ConnectStatus `json:"server_status"`
 	AppStatus    bool                   `json:"app_status"`
+	AppError     string                 `json:"app_error,omitempty"` // why the app check failed
+	Batch        *BatchProgress         `json:"batch,omitempty"`     // batch command progress, server_id and app_id stay 0
+	Alert        *AlertNotice           `json:"alert,omitempty"`     // resource alert fired or resolved, server_id and app_id stay 0
+}
+
+// AlertNotice alert of a rule on one series of a server fired or resolved
+type AlertNotice struct {
+	RuleID    uint      `json:"rule_id"`
+	RuleName  string    `json:"rule_name"`
+	ServerID  uint      `json:"server_id"`
+	Metric    string    `json:"metric"`
+	Labels    string    `json:"labels"`
+	Value     float64   `json:"value"`
+	Status    string    `json:"status"` // firing or resolved
+	StartedAt time.Time `json:"started_at"`
+	Time      time.Time `json:"time"`
+}
+
+// BatchProgress progress of a batch command, sent once per finished server
+type BatchProgress struct {
+	BatchID  string `json:"batch_id"`
+	ServerID uint   `json:"server_id"`
+	ExitCode int    `json:"exit_code"`
+	Success  bool   `json:"success"`
+	Done     int    `json:"done"`
+	Total    int    `json:"total"`
 }
 
 const (
@@ -54,6 +80,12 @@ func WebsocketFunc() gin.HandlerFunc {
 	}
 }
 
+// UpgradeConnection upgrade request to WebSocket with the shared upgrader,
+// used by dedicated channels such as the web terminal
+func UpgradeConnection(c *gin.Context) (*websocket.Conn, error) {
+	return upgrader.Upgrade(c.Writer, c.Request, nil)
+}
+
 // handle WebSocket connection
 func handleWebSocketConnection(c *gin.Context, username string) {
 	conn, err := upgrader.Upgrade(c.Writer, c.Request, nil)
@@ -143,6 +175,13 @@ func StartHeartbeat(ctx context.Context, conn *websocket.Conn) {
 	}
 }
 
+// ClientCount number of connected WebSocket clients
+func ClientCount() int {
+	wsPool.mutex.RLock()
+	defer wsPool.mutex.RUnlock()
+	return len(wsPool.Connections)
+}
+
 func SendMessage(msg Message) {
 	wsPool.mutex.Lock()
 	defer wsPool.mutex.Unlock()